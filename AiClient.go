@@ -2,12 +2,22 @@ package main
 
 import (
 	"AI/astar"
+	"AI/config"
 	"AI/constants"
+	"AI/daemon"
+	"AI/loadtest"
+	"AI/logfile"
+	"AI/logging"
 	"AI/login"
 	"AI/models"
 	pb "AI/pb_output"
+	"AI/replay"
+	"AI/sim"
+	"AI/telemetry"
+	"AI/tournament"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/ByteArena/box2d"
 	"github.com/gin-gonic/gin"
@@ -20,8 +30,11 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -53,7 +66,7 @@ const (
 	COLLISION_MASK_FOR_TRAP_BULLET       = (COLLISION_CATEGORY_CONTROLLED_PLAYER)
 	//COLLISION_MASK_FOR_BARRIER           = (COLLISION_CATEGORY_PUMPKIN)
 	//COLLISION_MASK_FOR_PUMPKIN           = (COLLISION_CATEGORY_BARRIER)
-	COLLISION_MASK_FOR_BARRIER     = (COLLISION_CATEGORY_BARRIER)
+	COLLISION_MASK_FOR_BARRIER     = (COLLISION_CATEGORY_BARRIER | COLLISION_CATEGORY_CONTROLLED_PLAYER) //双方的mask都包含对方时box2d才生成contact
 	COLLISION_MASK_FOR_PUMPKIN     = (COLLISION_CATEGORY_PUMPKIN)
 	COLLISION_MASK_FOR_SPEED_SHOES = (COLLISION_CATEGORY_CONTROLLED_PLAYER)
 )
@@ -85,24 +98,45 @@ type wsRespPb struct {
 	Data        []byte `json:"data,omitempty"`
 }
 
+//下行goroutine解析出的数据, 通过Client.downsyncEvents交给上行goroutine处理, 两者之间不共享其他可变状态
+type downsyncEvent struct {
+	BoundRoomId        int
+	BattleColliderInfo *pb.BattleColliderInfo
+	RoomDownsyncFrame  *pb.RoomDownsyncFrame
+	Raw                []byte //解码前的pb数据, 用于录像
+	ReceivedAt         time.Time
+}
+
+//下行帧在上行goroutine处理前最多缓存的数量, 超出时下行goroutine阻塞等待
+const downsyncEventBufferSize = 256
+
+//除特别说明的字段外, Client的状态只由上行goroutine读写
 type Client struct {
 	Id                    int //roomId
 	LastRoomDownsyncFrame *pb.RoomDownsyncFrame
 	BattleState           int
 	c                     *websocket.Conn
+	writeMutex            sync.Mutex //gorilla/websocket不允许并发写
 	Player                *pb.Player
 	CollidableWorld       *box2d.B2World
 	Barrier               map[int32]*models.Barrier
 	PlayerCollidableBody  *box2d.B2Body `json:"-"`
+	WallClippings         int           //correctWallClipping修正的次数
 
-	Radian float64
+	Radian float64 //最近一次移动的朝向, 由pathFinding.LastStep计算
 	Dir    models.Direction
 
+	AckingFrameId int32 //已收到的最新下行帧id, 随上行帧回传给服务器
+
+	LastReconciledFrameId int32          //最近一次与服务器校对坐标的下行帧id
+	sentPositions         []sentPosition //最近上行的坐标, 按发送顺序, 见reconcilePosition
+	PositionBlends        int            //reconcilePosition向服务器坐标插值的次数
+	PositionSnaps         int            //reconcilePosition瞬移到服务器坐标的次数
+
 	TmxIns *models.TmxMap
 
-	//上一帧时宝物的数量(因为现在每当一个宝物被吃掉时, 后端downFrame.Treasures会带上它的信息,保存该参数用于判断有没有宝物被吃掉)
-	RemovedTreasuresNum         int
-	LastFrameRemovedTreasureNum int
+	//每当一个宝物被吃掉时, 后端在增量帧的Treasures中带上它的信息. 目标宝物被吃掉后由checkReFindPath重新寻路
+	targetTreasureEaten bool
 
 	//寻路抽象(Incomplete) --kobako
 	pathFinding *models.PathFinding
@@ -110,210 +144,677 @@ type Client struct {
 
 	BotSpeed    *int32
 	StayedCount int
+	LastScore   int32 //最近一帧中自己的分数, 分数增加时计入吃到的宝物
+
+	UpsyncEncoding string //constants.UPSYNC_ENCODING_JSON or constants.UPSYNC_ENCODING_PB
+	Ai             config.AiConfig
+	Idle           bool                  //进入战斗后不寻路也不移动, 只上行原地的坐标, 用于压测中模拟挂机的玩家
+	Ticker         *models.TickScheduler //OnServerFrame由下行goroutine调用, 其余由上行goroutine调用
+
+	downsyncEvents chan downsyncEvent
+	done           chan struct{} //run结束时关闭, 避免上行goroutine退出后下行goroutine阻塞在downsyncEvents上
+	stop           chan struct{} //由Stop关闭, 使run提前结束
+	stopOnce       sync.Once
+
+	BotName   string
+	logger    *zap.Logger     //带有bot名和玩家id, run开始后不再修改, 上行goroutine中使用tickLogger
+	telemetry *telemetry.Hub  //为nil时不推送
+	recorder  *replay.Writer  //为nil时不录像, 由上行goroutine按处理顺序写入
+	stats     *loadtest.Stats //为nil时不统计
+
+	OnInvalidToken func() //服务器以INVALID_TOKEN关闭连接时由下行goroutine调用
+
+	statusMutex sync.Mutex //status由上行goroutine每帧更新, 供其他goroutine读取
+	status      ClientStatus
+	stage       *debugStage //收到BattleColliderInfo后设置一次, 之后不再修改
 }
 
-func spawnBot(botName string, expectedRoomId int, botManager *models.BotManager) {
-	defer botManager.ReleaseBot(botName)
+//通过telemetry.Hub推送的事件内容
+type telemetryWorldView struct {
+	FrameId        int32                  `json:"frameId"`
+	BattleState    int                    `json:"battleState"`
+	Self           models.Vec2D           `json:"self"`
+	Players        map[int32]*pb.Player   `json:"players"`
+	Traps          map[int32]*pb.Trap     `json:"traps"`
+	Bullets        map[int32]*pb.Bullet   `json:"bullets"`
+	Treasures      map[int32]models.Point `json:"treasures"` //尚未被吃掉的宝物所在的离散点
+	TreasureCoords map[int32]models.Vec2D `json:"treasureCoords"`
+}
+
+type telemetryTarget struct {
+	TreasureId int32       `json:"treasureId"`
+	Point      astar.Point `json:"point"`
+}
+
+type telemetryPath struct {
+	PointPath []astar.Point  `json:"pointPath"`
+	CoordPath []models.Vec2D `json:"coordPath"`
+}
 
-	log.SetFlags(0)
+//Client状态的快照, 可在任意goroutine中通过Client.Status读取
+type ClientStatus struct {
+	RoomId      int     `json:"roomId"`
+	PlayerId    int32   `json:"playerId"`
+	BattleState int     `json:"battleState"`
+	Score       int32   `json:"score"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	FrameId     int32   `json:"frameId"`
+}
+
+//每个bot可单独指定的参数, 由/spawnBot的query决定
+type spawnBotOptions struct {
+	UpsyncEncoding string
+	UpsyncRate     int //每秒上行帧数
+	Ai             config.AiConfig
+	Record         bool          //录像写入replay.dir
+	Lifetime       time.Duration //bot在房间中停留的时间
+	Idle           bool          //见Client.Idle
+	Stats          *loadtest.Stats
+}
 
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
+//调用前须已通过beginSpawn占用名额, ctx结束时bot提前断开
+func (server *botServer) spawnBot(ctx context.Context, s *shard, lease *models.BotLease, options spawnBotOptions) {
+	defer server.spawns.Done()
+	botName := lease.BotName
+	expectedRoomId := lease.RoomId
+	botLogger := zap.L().With(logging.Bot(botName), logging.Shard(s.config.Name))
+	defer func() {
+		if err := s.botManager.ReleaseBot(lease); err != nil {
+			botLogger.Warn("Release bot", zap.Int64("leaseId", lease.LeaseId), zap.Error(err))
+		}
+	}()
 
-	u := url.URL{Scheme: "ws", Host: constants.SERVER.HOST + constants.SERVER.PORT, Path: "/tsrht"}
+	botSpawns.Inc()
+	gameServer := s.config.GameServer
+	u := url.URL{Scheme: gameServer.WsScheme(), Host: fmt.Sprintf("%s:%d", gameServer.Host, gameServer.Port), Path: gameServer.WsPath}
 	q := u.Query()
 
-	//TODO: Error handle
-	intAuthToken, playerId := login.GetIntAuthTokenByBotName(botName)
+	token, err := s.login.Login(lease.Account.PhoneNum, lease.Account.PhoneCountryCode)
+	if err != nil {
+		botLogger.Warn("Login", zap.Error(err))
+		botLoginFailures.Inc()
+		options.Stats.OnLoginFailure(err)
+		return
+	}
 
 	//local
-	q.Set("intAuthToken", intAuthToken)
+	q.Set("intAuthToken", token.IntAuthToken)
 	if expectedRoomId > 0 {
 		q.Set("expectedRoomId", strconv.Itoa(expectedRoomId))
 	}
 	u.RawQuery = q.Encode()
 
-	fmt.Println("WS connect to " + u.String())
+	select {
+	case <-lease.Expired():
+		botLogger.Info("Lease expired before connecting", zap.Int64("leaseId", lease.LeaseId))
+		return
+	case <-ctx.Done():
+		botLogger.Info("Cancelled before connecting")
+		return
+	default:
+	}
+
+	botLogger = botLogger.With(logging.PlayerId(int32(token.PlayerId)))
+	//不记录带token的完整url
+	botLogger.Info("Connecting", zap.String("host", u.Host), zap.Int("expectedRoomId", expectedRoomId))
 
 	//ref to the NewClient and DefaultDialer.Dial https://github.com/gorilla/websocket/issues/54
-	c, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	c, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), nil)
 	if err != nil {
-		log.Panic("dial:", err)
+		//握手被拒绝多半是缓存的token已失效, 下次重新登录
+		if resp != nil {
+			s.login.Invalidate(lease.Account.PhoneNum, lease.Account.PhoneCountryCode)
+		}
+		botLogger.Warn("Dial", zap.Error(err))
+		botDialFailures.Inc()
+		options.Stats.OnDialFailure(err)
+		return
 	}
 	defer c.Close()
+	options.Stats.OnConnected()
+
+	client := newClient(c, int32(token.PlayerId), options)
+	client.BotName = botName
+	client.setLogger(botLogger)
+	if options.Record {
+		recorder, path, err := createRecorder(server.config.Replay.Dir, client, options)
+		if err != nil {
+			botLogger.Warn("Create replay", zap.Error(err))
+		} else {
+			botLogger.Info("Recording replay", zap.String("path", path))
+			client.recorder = recorder
+			defer func() {
+				if err := recorder.Close(); err != nil {
+					botLogger.Warn("Close replay", zap.String("path", path), zap.Error(err))
+				}
+			}()
+		}
+	}
+	client.telemetry = server.telemetry
+	client.OnInvalidToken = func() {
+		s.login.Invalidate(lease.Account.PhoneNum, lease.Account.PhoneCountryCode)
+	}
+	server.registry.add(s, lease, client)
+	defer server.registry.remove(lease)
+	activeBots.Inc()
+	defer activeBots.Dec()
+	lifetimeCtx, cancel := context.WithTimeout(ctx, options.Lifetime)
+	defer cancel()
+	client.run(lifetimeCtx, lease.Expired())
+}
+
+func createRecorder(dir string, client *Client, options spawnBotOptions) (*replay.Writer, string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, "", err
+	}
+	meta := replay.Meta{
+		BotName:        client.BotName,
+		PlayerId:       client.Player.Id,
+		UpsyncRate:     options.UpsyncRate,
+		UpsyncEncoding: options.UpsyncEncoding,
+		Ai:             options.Ai,
+		StartedAt:      time.Now(),
+	}
+	path := filepath.Join(dir, replay.FileName(meta.BotName, meta.PlayerId, meta.StartedAt))
+	recorder, err := replay.Create(path, meta)
+	return recorder, path, err
+}
 
+func newClient(c *websocket.Conn, playerId int32, options spawnBotOptions) *Client {
 	client := &Client{
 		LastRoomDownsyncFrame: nil,
 		BattleState:           -1,
 		c:                     c,
-		Player:                &pb.Player{Id: int32(playerId)},
+		Player:                &pb.Player{Id: playerId},
 		Barrier:               make(map[int32]*models.Barrier),
 		Radian:                math.Pi / 2,
 		Dir:                   models.Direction{Dx: 0, Dy: 1},
 		pathFinding:           new(models.PathFinding),
 		StayedCount:           0,
+		UpsyncEncoding:        options.UpsyncEncoding,
+		Ai:                    options.Ai,
+		Idle:                  options.Idle,
+		stats:                 options.Stats,
+		Ticker:                models.NewTickScheduler(options.UpsyncRate),
+		downsyncEvents:        make(chan downsyncEvent, downsyncEventBufferSize),
+		done:                  make(chan struct{}),
+		stop:                  make(chan struct{}),
 	}
-
 	client.Started = false
-	killSignal := int32(0)
 	client.BotSpeed = new(int32)
+	client.setLogger(zap.L().With(logging.PlayerId(playerId)))
+	return client
+}
 
-	upsyncLoopFunc := func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Println("Recovered from panic in upsync", r)
-				fmt.Printf("panic in upsync: %v \n", string(debug.Stack()))
-			}
-		}()
+//须在run之前调用
+func (client *Client) setLogger(logger *zap.Logger) {
+	client.logger = logger
+	client.pathFinding.Log = logger
+}
 
-		for {
-			if swapped := atomic.CompareAndSwapInt32(&killSignal, 1, 1); swapped {
-				log.Println("Upsync exit")
-				return
-			}
-			client.controller()
-			client.checkReFindPath()
-			client.upsyncFrameData()
-			time.Sleep(time.Second / 20)
+//只在上行goroutine中调用, 带有当前的房间号和帧号
+func (client *Client) tickLogger() *zap.Logger {
+	return client.logger.With(logging.RoomId(client.Id), logging.FrameId(client.AckingFrameId))
+}
+
+//发出close帧后等待服务器回应的最长时间
+const wsCloseTimeout = time.Second
+
+//运行上下行两个goroutine, ctx结束(bot寿命到期或进程退出)或abort被关闭时关闭连接并等待它们退出
+func (client *Client) run(ctx context.Context, abort <-chan struct{}) {
+	killSignal := int32(0)
+
+	upsyncDone := make(chan struct{})
+	go func() {
+		defer close(upsyncDone)
+		client.upsyncLoop(&killSignal)
+	}()
+	downsyncDone := make(chan struct{})
+	go func() {
+		defer close(downsyncDone)
+		client.downsyncLoop(&killSignal)
+	}()
+
+	reason := DISCONNECT_LIFETIME
+	select {
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			reason = DISCONNECT_CANCELLED
 		}
+	case <-abort:
+		reason = DISCONNECT_LEASE_EXPIRED
+	case <-client.stop:
+		reason = DISCONNECT_STOPPED
+	case <-downsyncDone:
+		reason = DISCONNECT_SERVER
+		client.stats.OnEarlyDisconnect()
+	case <-upsyncDone:
+		reason = DISCONNECT_UPSYNC
+		client.stats.OnEarlyDisconnect()
 	}
+	client.logger.Info("Disconnecting", zap.String("reason", reason))
+	botDisconnects.With(reason).Inc()
+	atomic.StoreInt32(&killSignal, 1)
+	close(client.done)
+	<-upsyncDone
+
+	//先正常关闭websocket, 服务器回应close帧后下行goroutine的ReadJSON会返回, 超时后直接关闭连接
+	err := client.writeControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsCloseTimeout))
+	if err == nil {
+		select {
+		case <-downsyncDone:
+		case <-time.After(wsCloseTimeout):
+		}
+	}
+	client.c.Close()
+	<-downsyncDone
+}
 
-	downSyncLoopFunc := func() {
-		defer func() {
-			if r := recover(); r != nil {
-				log.Println("Recovered from panic in downsync", r)
-			}
-		}()
+//进程退出前的最后手段: 不发close帧直接关闭连接
+func (client *Client) forceClose() {
+	client.c.Close()
+}
+
+func (client *Client) writeControl(messageType int, data []byte, deadline time.Time) error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	return client.c.WriteControl(messageType, data, deadline)
+}
+
+func (client *Client) upsyncLoop(killSignal *int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			client.logger.Error("Recovered from panic in upsync", zap.Any("panic", r), zap.String("stack", string(debug.Stack())))
+		}
+	}()
+
+	steps := 0
+	for {
+		if swapped := atomic.CompareAndSwapInt32(killSignal, 1, 1); swapped {
+			client.logger.Debug("Upsync exit")
+			return
+		}
+		client.consumeDownsyncEvents()
+		dt := client.advance(steps)
+		client.upsyncFrameData(dt)
+		client.publishStatus()
+		steps = client.Ticker.Wait()
+	}
+}
 
-		for {
-			if swapped := atomic.CompareAndSwapInt32(&killSignal, 1, 1); swapped {
-				log.Println("Downsync exit")
-				return
+func (client *Client) downsyncLoop(killSignal *int32) {
+	defer func() {
+		if r := recover(); r != nil {
+			client.logger.Error("Recovered from panic in downsync", zap.Any("panic", r), zap.String("stack", string(debug.Stack())))
+		}
+	}()
+
+	c := client.c
+	for {
+		if swapped := atomic.CompareAndSwapInt32(killSignal, 1, 1); swapped {
+			client.logger.Debug("Downsync exit")
+			return
+		}
+
+		var resp *wsResp
+		resp = new(wsResp)
+		err := c.ReadJSON(resp)
+		if err != nil {
+			//连接出错后后续的读取都会失败, 不再重试
+			client.logger.Info("Websocket read", zap.Error(err))
+			if websocket.IsCloseError(err, int(login.RET_CODE_INVALID_TOKEN)) && client.OnInvalidToken != nil {
+				client.OnInvalidToken()
 			}
+			return
+		}
 
-			var resp *wsResp
-			resp = new(wsResp)
-			err := c.ReadJSON(resp)
+		switch resp.Act {
+		case "RoomDownsyncFrame":
+			var respPb *wsRespPb
+			respPb = new(wsRespPb)
+			err := c.ReadJSON(respPb)
+			if err != nil {
+				client.logger.Warn("Decode downsync frame", zap.Error(err))
+				decodeErrors.With(resp.Act).Inc()
+				client.stats.OnError("decode", err)
+				continue
+			}
+			if err := client.decodeProtoBuf(respPb.Data); err != nil {
+				client.logger.Warn("Decode RoomDownsyncFrame", zap.Error(err))
+				decodeErrors.With(resp.Act).Inc()
+				client.stats.OnError("decode", err)
+			}
+		case "HeartbeatRequirements":
+			var respPb *HeartbeatRequirementsData
+			respPb = new(HeartbeatRequirementsData)
+			err := json.Unmarshal(resp.Data, respPb)
+			if err != nil {
+				client.logger.Warn("Decode heartbeat requirements", zap.Error(err))
+				decodeErrors.With(resp.Act).Inc()
+				client.stats.OnError("decode", err)
+				continue
+			}
+			battleColliderInfo := new(pb.BattleColliderInfo)
+			err = proto.Unmarshal(respPb.BattleColliderInfo, battleColliderInfo)
 			if err != nil {
-				log.Println("websocket read json err", err)
+				client.logger.Warn("Decode BattleColliderInfo", zap.Error(err))
+				decodeErrors.With("BattleColliderInfo").Inc()
+				client.stats.OnError("decode", err)
+				continue
 			}
+			client.pushDownsyncEvent(downsyncEvent{
+				BoundRoomId:        respPb.BoundRoomId,
+				BattleColliderInfo: battleColliderInfo,
+				Raw:                respPb.BattleColliderInfo,
+				ReceivedAt:         time.Now(),
+			})
+		}
+	}
+}
 
-			switch resp.Act {
-			case "RoomDownsyncFrame":
-				var respPb *wsRespPb
-				respPb = new(wsRespPb)
-				err := c.ReadJSON(respPb)
-				if err != nil {
-					log.Println("Err unmarshalling downsync respPb:", err)
-				}
-				client.decodeProtoBuf(respPb.Data)
-			case "HeartbeatRequirements":
-				var respPb *HeartbeatRequirementsData
-				respPb = new(HeartbeatRequirementsData)
-				err := json.Unmarshal(resp.Data, respPb)
-				if err != nil {
-					log.Println("Err unmarshalling heartbeat respPb:", err)
-				}
-				var battleColliderInfo pb.BattleColliderInfo
-				err = proto.Unmarshal(respPb.BattleColliderInfo, &battleColliderInfo)
-				if err != nil {
-					log.Println("Err unmarshalling data:", err)
-				}
-				//初始化地图资源
-				tmx := models.TmxMap{
-					Width:      int(battleColliderInfo.StageDiscreteW),
-					Height:     int(battleColliderInfo.StageDiscreteH),
-					TileWidth:  int(battleColliderInfo.StageTileW),
-					TileHeight: int(battleColliderInfo.StageTileH),
-				}
-				//tmx, _ := models.InitMapStaticResource("./map/map/pacman/map.tmx")
-				client.TmxIns = &tmx
+//可在任意goroutine中调用, 重复调用无副作用
+func (client *Client) Stop() {
+	client.stopOnce.Do(func() {
+		close(client.stop)
+	})
+}
 
-				log.Println("collideMap init", tmx)
-				collideMap := models.InitCollideMapNeo(&tmx, battleColliderInfo.StrToPolygon2DListMap)
-				client.pathFinding.SetCollideMap(collideMap)
-				client.playerBattleColliderAck()
-			}
+func (client *Client) Status() ClientStatus {
+	client.statusMutex.Lock()
+	defer client.statusMutex.Unlock()
+	return client.status
+}
+
+func (client *Client) DebugStage() *debugStage {
+	client.statusMutex.Lock()
+	defer client.statusMutex.Unlock()
+	return client.stage
+}
+
+func (client *Client) publishStatus() {
+	status := ClientStatus{
+		RoomId:      client.Id,
+		PlayerId:    client.Player.Id,
+		BattleState: client.BattleState,
+		X:           client.Player.X,
+		Y:           client.Player.Y,
+		FrameId:     client.AckingFrameId,
+	}
+	if client.LastRoomDownsyncFrame != nil {
+		if player, ok := client.LastRoomDownsyncFrame.Players[client.Player.Id]; ok {
+			status.Score = player.Score
 		}
 	}
+	client.statusMutex.Lock()
+	client.status = status
+	client.statusMutex.Unlock()
+}
 
-	go upsyncLoopFunc()
-	go downSyncLoopFunc()
+func (client *Client) pushDownsyncEvent(event downsyncEvent) {
+	select {
+	case client.downsyncEvents <- event:
+	case <-client.done:
+	}
+}
 
-	elapsedTime := 0
+//在上行goroutine中按接收顺序处理下行goroutine交来的数据
+func (client *Client) consumeDownsyncEvents() {
 	for {
-		elapsedTime = elapsedTime + 1
-		if elapsedTime > 65 {
-			atomic.CompareAndSwapInt32(&killSignal, 0, 1)
+		select {
+		case event := <-client.downsyncEvents:
+			client.recordDownsyncEvent(event)
+			if event.BattleColliderInfo != nil {
+				client.Id = event.BoundRoomId
+				client.initBattleCollider(event.BattleColliderInfo)
+				client.playerBattleColliderAck()
+			}
+			if event.RoomDownsyncFrame != nil {
+				client.applyRoomDownsyncFrame(event.RoomDownsyncFrame)
+				//第一帧是全量帧, 须先交给controller初始化, 否则会被初始化碰撞地图期间堆积的增量帧覆盖
+				if !client.Started {
+					return
+				}
+			}
+		default:
 			return
 		}
-		time.Sleep(time.Second)
 	}
 }
 
-func main() {
-	startServer(15351)
+func (client *Client) recordDownsyncEvent(event downsyncEvent) {
+	if client.recorder == nil {
+		return
+	}
+	var err error
+	if event.BattleColliderInfo != nil {
+		err = client.recorder.WriteBattleColliderInfo(event.ReceivedAt, event.BoundRoomId, event.Raw)
+	} else if event.RoomDownsyncFrame != nil {
+		err = client.recorder.WriteDownsyncFrame(event.ReceivedAt, event.Raw)
+	}
+	client.checkRecorderErr(err)
 }
 
-func startServer(port int) {
-	var botManager *models.BotManager
-	{
-		botManager = new(models.BotManager)
-		botManager.SetBots([]string{"bot1", "bot2", "bot3", "bot4"})
+//写入出错时停止录像, 不影响bot继续运行
+func (client *Client) checkRecorderErr(err error) {
+	if err != nil {
+		client.tickLogger().Warn("Stop recording replay", zap.Error(err))
+		client.recorder.Close()
+		client.recorder = nil
+	}
+}
+
+func (client *Client) initBattleCollider(battleColliderInfo *pb.BattleColliderInfo) {
+	//初始化地图资源
+	tmx := models.TmxMap{
+		Width:      int(battleColliderInfo.StageDiscreteW),
+		Height:     int(battleColliderInfo.StageDiscreteH),
+		TileWidth:  int(battleColliderInfo.StageTileW),
+		TileHeight: int(battleColliderInfo.StageTileH),
 	}
+	//tmx, _ := models.InitMapStaticResource("./map/map/pacman/map.tmx")
+	client.TmxIns = &tmx
+
+	client.tickLogger().Info("Initializing collide map", zap.String("stage", battleColliderInfo.StageName), zap.Int("width", tmx.Width), zap.Int("height", tmx.Height))
+	collideMap := models.InitCollideMapNeo(&tmx, battleColliderInfo.StrToPolygon2DListMap)
+	client.pathFinding.SetCollideMap(collideMap)
+	client.initCollidableWorld(battleColliderInfo)
+
+	stage := newDebugStage(battleColliderInfo, &tmx, collideMap)
+	client.statusMutex.Lock()
+	client.stage = stage
+	client.statusMutex.Unlock()
+}
 
-	r := gin.Default()
-	r.GET("/spawnBot", func(c *gin.Context) {
-		expectedRoomId, err := strconv.Atoi(c.Query("expectedRoomId"))
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "path of the config file, the profile is picked by $ServerEnv")
+	botPoolPath := flag.String("botPool", "", "path of the bot pool config, reloaded on SIGHUP if changed, overrides bot.poolPath of the config")
+	daemonMode := flag.Bool("daemon", false, "detach and run in the background, requires -pidFile and a file as log.output, stdout and stderr go to <pidFile>.stderr")
+	pidFile := flag.String("pidFile", "", "write the pid to the file, refusing to start while the process in it is still running")
+	simulate := flag.String("simulate", "", "run an offline match on the tmx map and print the scores instead of starting the server")
+	simConfig := sim.DefaultConfig()
+	simBots := flag.String("simBots", STRATEGY_CLIENT+","+STRATEGY_CLIENT, "comma separated strategies of the offline match: client, idle, straight or a strategy of the config")
+	flag.DurationVar(&simConfig.Duration, "simDuration", simConfig.Duration, "simulated length of the offline match")
+	flag.Int64Var(&simConfig.Seed, "simSeed", simConfig.Seed, "seed of the random treasures and traps of the offline match")
+	flag.IntVar(&simConfig.RandomTreasures, "simTreasures", simConfig.RandomTreasures, "number of random treasures added to the offline match")
+	flag.IntVar(&simConfig.RandomTraps, "simTraps", simConfig.RandomTraps, "number of random traps added to the offline match")
+	tournamentStrategies := flag.String("tournament", "", "comma separated strategies to rank by a round-robin tournament of offline matches, instead of starting the server")
+	tournamentMap := flag.String("tournamentMap", "map/map/pacman/map.tmx", "tmx map of the tournament matches")
+	tournamentConfig := tournament.Config{KFactor: tournament.DEFAULT_K_FACTOR}
+	flag.IntVar(&tournamentConfig.Rounds, "tournamentRounds", 1, "rounds of the tournament, each pair of strategies plays twice per round with swapped starting positions")
+	tournamentResults := flag.String("tournamentResults", "tournament.json", "file accumulating the ratings and matches across tournaments")
+	loadTestMix := flag.String("loadTest", "", "run a load test against the game server with the comma separated behaviour mix, e.g. \"client:8,idle:2\", instead of serving the http api")
+	loadTestConfig := loadtest.DefaultConfig(STRATEGY_CLIENT)
+	flag.IntVar(&loadTestConfig.Bots, "loadBots", loadTestConfig.Bots, "number of bots of the load test")
+	flag.IntVar(&loadTestConfig.BotsPerRoom, "loadBotsPerRoom", loadTestConfig.BotsPerRoom, "bots per room of the load test")
+	flag.IntVar(&loadTestConfig.FirstRoomId, "loadFirstRoomId", loadTestConfig.FirstRoomId, "first room of the load test, the following rooms are used in order")
+	flag.DurationVar(&loadTestConfig.RampUp, "loadRampUp", loadTestConfig.RampUp, "time between the first and the last bot of the load test connecting")
+	flag.Float64Var(&loadTestConfig.ConnectRate, "loadConnectRate", loadTestConfig.ConnectRate, "max bots connecting per second during the load test, 0 for unlimited")
+	flag.DurationVar(&loadTestConfig.Duration, "loadDuration", loadTestConfig.Duration, "time each bot of the load test stays in its room")
+	flag.StringVar(&loadTestConfig.Shard, "loadShard", "", "shard of the load test, inferred from the rooms by default")
+	flag.StringVar(&loadTestConfig.Tag, "loadTag", "", "only use bot accounts with the tag for the load test")
+	loadTestReport := flag.String("loadReport", "", "also write the load test report as json to the file")
+	replayPath := flag.String("replay", "", "feed a replay file recorded by a bot through the AI and verify it produces the recorded upsyncs, instead of starting the server")
+	flag.Parse()
+	cfg, err := config.Load(*configPath, os.Getenv("ServerEnv"), os.Getenv)
+	if err != nil {
+		log.Fatal("Load config: ", err)
+	}
+	if *botPoolPath != "" {
+		cfg.Bot.PoolPath = *botPoolPath
+	}
+	if *daemonMode && !daemon.IsChild() {
+		if *pidFile == "" || !cfg.Log.IsFile() {
+			log.Fatal("Daemon mode requires -pidFile and a file as log.output")
+		}
+		pid, err := daemon.Start(os.Args[1:], *pidFile, daemon.DEFAULT_START_TIMEOUT)
 		if err != nil {
-			fmt.Println("请求中没有或者转换expectedRoomId出错")
-			c.JSON(200, gin.H{
-				"ret": 1001,
-				"err": "请求中没有或者转换expectedRoomId出错",
-			})
-		} else {
-			botName, err := botManager.GetLeisureBot()
-			if err != nil {
-				fmt.Println("获取空闲bot出错: " + err.Error())
-				c.JSON(200, gin.H{
-					"ret":     1001,
-					"botName": "获取空闲bot出错: " + err.Error(),
-				})
-			} else {
-				go spawnBot(botName, expectedRoomId, botManager)
-				fmt.Printf("Get bot: %s, expectedRoomId: %d \n", botName, expectedRoomId)
-				c.JSON(200, gin.H{
-					"ret":     1000,
-					"botName": botName,
-				})
+			log.Fatal("Start daemon: ", err)
+		}
+		fmt.Printf("Started daemon %d, logging to %s, stderr to %s\n", pid, cfg.Log.Output, daemon.StderrPath(*pidFile))
+		return
+	}
+	logger, logFile, err := logging.New(cfg.Log)
+	if err != nil {
+		log.Fatal("Create logger: ", err)
+	}
+	defer logFile.Close()
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+	zap.RedirectStdLog(logger)
+	logger.Info("Loaded config", zap.String("serverEnv", cfg.ServerEnv), zap.String("path", *configPath), zap.Any("config", cfg))
+	if *pidFile != "" {
+		if err := daemon.WritePidFile(*pidFile); err != nil {
+			logger.Fatal("Write pid file", zap.Error(err))
+		}
+		defer func() {
+			if err := daemon.RemovePidFile(*pidFile); err != nil {
+				logger.Warn("Remove pid file", zap.Error(err))
 			}
+		}()
+	}
+	if *simulate != "" {
+		if err := runSimulation(*simulate, *simBots, simConfig, cfg, os.Stdout); err != nil {
+			logger.Fatal("Simulate", zap.Error(err))
 		}
-	})
+		return
+	}
+	if *tournamentStrategies != "" {
+		tournamentConfig.Strategies = splitStrategies(*tournamentStrategies)
+		tournamentConfig.Seed = simConfig.Seed
+		tournamentConfig.Sim = simConfig
+		if err := runTournament(*tournamentMap, tournamentConfig, *tournamentResults, cfg, os.Stdout); err != nil {
+			logger.Fatal("Tournament", zap.Error(err))
+		}
+		return
+	}
+	if *replayPath != "" {
+		if err := runReplay(*replayPath, os.Stdout); err != nil {
+			logger.Fatal("Replay", zap.Error(err))
+		}
+		return
+	}
+	applyConfig(cfg)
+	if *loadTestMix != "" {
+		mix, err := loadtest.ParseMix(*loadTestMix)
+		if err != nil {
+			logger.Fatal("Load test", zap.Error(err))
+		}
+		loadTestConfig.Mix = mix
+		server, err := newBotServer(cfg)
+		if err != nil {
+			zap.L().Fatal("Load bot pool", zap.Error(err))
+		}
+		if err := server.runLoadTestCli(loadTestConfig, *loadTestReport, os.Stdout); err != nil {
+			logger.Fatal("Load test", zap.Error(err))
+		}
+		return
+	}
+	startServer(cfg, logFile)
+}
+
+//constants.SERVER和login.DefaultClient被多处直接使用, 在启动时用配置覆盖一次
+func applyConfig(cfg *config.Config) {
+	constants.SERVER = cfg.GameServer.NetConf()
+	login.DefaultClient.MaxAttempts = cfg.Login.MaxAttempts
+	login.DefaultClient.Backoff = cfg.Login.Backoff
+	login.DefaultClient.MaxBackoff = cfg.Login.MaxBackoff
+	login.DefaultClient.HttpClient.Timeout = cfg.Login.HttpTimeout
+}
+
+//加载bot池并启动回收过期lease的goroutine
+func newBotServer(cfg *config.Config) (*botServer, error) {
+	shards := newShards(cfg)
+	if err := loadBotPools(shards); err != nil {
+		return nil, err
+	}
+	for _, s := range shards {
+		shardName := s.config.Name
+		s.botManager.OnLeaseExpired = func(lease models.BotLease) {
+			zap.L().Warn("Reclaimed bot", logging.Bot(lease.BotName), logging.Shard(shardName), zap.Int64("leaseId", lease.LeaseId), logging.RoomId(lease.RoomId), zap.Time("startedAt", lease.StartedAt))
+		}
+		s.botManager.StartReaper(cfg.Bot.ReapInterval, nil)
+	}
+
+	server := &botServer{
+		config:    cfg,
+		shards:    shards,
+		registry:  newBotRegistry(),
+		telemetry: telemetry.NewHub(),
+		startedAt: time.Now(),
+	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+	return server, nil
+}
+
+//SIGHUP时重新打开logFile并重新加载有改动的bot池, 收到SIGTERM或SIGINT后等待bot断开再返回
+func startServer(cfg *config.Config, logFile *logfile.Writer) {
+	server, err := newBotServer(cfg)
+	if err != nil {
+		zap.L().Fatal("Load bot pool", zap.Error(err))
+	}
+	shards := server.shards
+
+	r := gin.New()
+	r.Use(logging.GinLogger(zap.L()), logging.GinRecovery(zap.L()))
+	server.registerApi(r)
+	server.registerDebugViewer(r)
 
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
+		Addr:    fmt.Sprintf(":%d", cfg.Listen.Port),
 		Handler: r,
 	}
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Println("Listening: %s\n", zap.Error(err))
+			zap.L().Error("Listen", zap.Error(err))
+		}
+	}()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := logFile.Reopen(); err != nil {
+				zap.L().Error("Reopen log file", zap.Error(err))
+			}
+			if err := loadBotPools(shards); err != nil {
+				zap.L().Error("Reload bot pool", zap.Error(err))
+			}
 		}
 	}()
-	var gracefulStop = make(chan os.Signal)
-	signal.Notify(gracefulStop, syscall.SIGTERM)
-	signal.Notify(gracefulStop, syscall.SIGINT)
+
+	var gracefulStop = make(chan os.Signal, 1)
+	signal.Notify(gracefulStop, syscall.SIGTERM, syscall.SIGINT)
 	sig := <-gracefulStop
-	log.Println("Shutdown Server ...")
-	log.Println("caught sig", sig)
-	log.Println("Wait for 5 second to finish processing")
-	clean()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	zap.L().Info("Shutting down, draining the running bots", zap.Stringer("signal", sig), zap.Duration("deadline", cfg.Shutdown.Deadline))
+	if terminated := server.shutdown(cfg.Shutdown.Deadline); len(terminated) > 0 {
+		zap.L().Warn("Forcibly terminated bots", zap.Strings("bots", terminated))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.HttpDeadline)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Println("Server Shutdown:", zap.Error(err))
+		zap.L().Error("Shutdown http server", zap.Error(err))
 	}
-	log.Println("Server exiting")
-	os.Exit(0)
+	zap.L().Info("Server exiting")
 }
 
 //通过当前玩家的坐标, 和treasureMap来计算start, end point, 用于寻路, 重新初始化walkInfo
@@ -334,6 +835,7 @@ func reFindPath(tmx *models.TmxMap, client *Client, excludeTreasureID map[int32]
 	var endPoint astar.Point
 	{
 		var min float64 = 999999
+		var targetId int32
 		playerVec := models.Vec2D{
 			X: client.Player.X,
 			Y: client.Player.Y,
@@ -354,8 +856,10 @@ func reFindPath(tmx *models.TmxMap, client *Client, excludeTreasureID map[int32]
 					notInExcluedMap = false
 				}
 			}
-			if dist < min && notInExcluedMap {
+			//距离相同时取id较小的, 使结果不依赖map的遍历顺序, 录像才能重放出相同的上行指令
+			if notInExcluedMap && (dist < min || (dist == min && id < targetId)) {
 				min = dist
+				targetId = id
 				endPoint = treasurePoint
 				client.pathFinding.UpdateTargetTreasureId(id)
 			}
@@ -366,8 +870,11 @@ func reFindPath(tmx *models.TmxMap, client *Client, excludeTreasureID map[int32]
 
 	//fmt.Printf("++++++ start point %v, end point %v\n", startPoint, endPoint)
 	//fmt.Printf("++++++ current point %v\n", client.pathFinding.CurrentCoord)
-	pointPath := client.pathFinding.FindPointPath(startPoint, endPoint)
-	fmt.Printf("The point path: %v\n", pointPath)
+	replans.Inc()
+	pointPath, err := client.pathFinding.FindPointPath(startPoint, endPoint)
+	if err != nil {
+		client.tickLogger().Warn("Path search failed", zap.Int32("treasureId", client.pathFinding.TargetTreasureId), zap.Any("start", startPoint), zap.Any("goal", endPoint), zap.Error(err))
+	}
 
 	//将离散的路径转为连续坐标, 初始化walkInfo, 每次controller的时候调用
 	var path []models.Vec2D
@@ -380,6 +887,22 @@ func reFindPath(tmx *models.TmxMap, client *Client, excludeTreasureID map[int32]
 		})
 	}
 	client.pathFinding.SetNewCoordPath(path)
+	if len(path) == 0 {
+		client.tickLogger().Debug("No path to the target treasure", zap.Int32("treasureId", client.pathFinding.TargetTreasureId), zap.Any("start", startPoint), zap.Any("goal", endPoint))
+	} else {
+		client.tickLogger().Debug("Replanned", zap.Int32("treasureId", client.pathFinding.TargetTreasureId), zap.Any("pointPath", pointPath))
+	}
+
+	if client.telemetry.HasSubscribers() {
+		client.emitTelemetry(telemetry.KIND_TARGET, &telemetryTarget{
+			TreasureId: client.pathFinding.TargetTreasureId,
+			Point:      endPoint,
+		})
+		client.emitTelemetry(telemetry.KIND_PATH, &telemetryPath{
+			PointPath: append([]astar.Point(nil), pointPath...),
+			CoordPath: append([]models.Vec2D(nil), path...),
+		})
+	}
 }
 
 func (client *Client) initTreasureAndPlayers() {
@@ -387,29 +910,11 @@ func (client *Client) initTreasureAndPlayers() {
 	//根据第一帧的数据来设置好玩家的位置, 以及宝物的位置,以服务器为准
 	initFullFrame := client.LastRoomDownsyncFrame
 
-	//Init treasures
-	client.LastFrameRemovedTreasureNum = 0
-
 	//Sign on map
 	tmx := client.TmxIns
 
-	{ //Init ContinuousPosMap
-		//将离散的点转换成连续的点, 用于确认道具的位置(遍历每个点判断相对距离最短)
-		var continuousPosMap [][]models.Vec2D
-		continuousPosMap = make([][]models.Vec2D, tmx.Height)
-		for i := 0; i < tmx.Height; i++ {
-			continuousPosMap[i] = make([]models.Vec2D, tmx.Width)
-		}
-		for i := 0; i < tmx.Height; i++ {
-			for j := 0; j < tmx.Width; j++ {
-				gid := i*tmx.Width + j
-				x, y := tmx.GetCoordByGid(gid)
-				continuousPosMap[i][j].X = x
-				continuousPosMap[i][j].Y = y
-			}
-		}
-		tmx.ContinuousPosMap = continuousPosMap
-	}
+	//将离散的点转换成连续的点, 用于确认道具的位置(遍历每个点判断相对距离最短)
+	tmx.InitContinuousPosMap()
 
 	var treasureDiscreteMap map[int32]models.Point
 	{
@@ -427,8 +932,6 @@ func (client *Client) initTreasureAndPlayers() {
 	client.pathFinding.SetTreasureMap(treasureDiscreteMap)
 	//client.pathFinding.TreasureMap = treasureDiscreteMap
 
-	fmt.Printf("INIT Treasure: %v \n", client.pathFinding.TreasureMap)
-
 	//mark
 	var playerPoint astar.Point
 	{
@@ -444,8 +947,6 @@ func (client *Client) initTreasureAndPlayers() {
 		}
 	}
 
-	fmt.Printf("++++++ player point: %v \n", playerPoint)
-
 	//找出最近的一个宝物, 标记为client.pathFinding.TargetTreasureId
 	minDistance := 99999.0
 	for k, v := range treasureDiscreteMap {
@@ -454,47 +955,51 @@ func (client *Client) initTreasureAndPlayers() {
 			Y: v.Y,
 		}
 		dist := astar.DistBetween(vPoint, playerPoint)
-		if dist < minDistance {
+		if dist < minDistance || (dist == minDistance && k < client.pathFinding.TargetTreasureId) {
 			minDistance = dist
 			client.pathFinding.UpdateTargetTreasureId(k)
 			//client.pathFinding.TargetTreasureId = k
 		}
 	}
 
-	fmt.Printf("++++++ minDistance %f, %v \n", minDistance, playerPoint)
+	client.tickLogger().Debug("Initialized treasures", zap.Int("treasures", len(treasureDiscreteMap)), zap.Any("playerPoint", playerPoint), zap.Float64("minDistance", minDistance))
 
 	reFindPath(tmx, client, nil)
 }
 
-func (client *Client) checkReFindPath() {
-	// 仅当 (当前帧的宝物数量比上一帧少 && 目标宝物id被吃掉)  的时候重新寻路
-	if client.LastRoomDownsyncFrame == nil || client.LastRoomDownsyncFrame.RefFrameId == 0 || client.BattleState != IN_BATTLE {
+//一个tick中可能应用多个下行帧, 每一帧中被吃掉的宝物都要在应用时处理, 不能只看最后一帧
+func (client *Client) removeEatenTreasures(frame *pb.RoomDownsyncFrame) {
+	if frame.RefFrameId == 0 || client.BattleState != IN_BATTLE {
 		return
 	}
-	var needReFindPath = false
-	if len(client.LastRoomDownsyncFrame.Treasures) != client.LastFrameRemovedTreasureNum {
-		//fmt.Printf("last number %d, now number %d \n", client.LastFrameRemovedTreasureNum, len(client.LastRoomDownsyncFrame.Treasures))
-		client.LastFrameRemovedTreasureNum = len(client.LastRoomDownsyncFrame.Treasures)
-
-		for id, _ := range client.LastRoomDownsyncFrame.Treasures {
-			//删除以减轻后续最短距离计算量
-			delete(client.pathFinding.TreasureMap, id)
-			if id == client.pathFinding.TargetTreasureId {
-				needReFindPath = true
-			}
+	for id := range frame.Treasures {
+		//删除以减轻后续最短距离计算量
+		delete(client.pathFinding.TreasureMap, id)
+		if id == client.pathFinding.TargetTreasureId {
+			client.targetTreasureEaten = true
 		}
 	}
+}
+
+func (client *Client) checkReFindPath() {
+	// 仅当目标宝物被吃掉(见removeEatenTreasures)或者卡住的时候重新寻路
+	if client.LastRoomDownsyncFrame == nil || client.LastRoomDownsyncFrame.RefFrameId == 0 || client.BattleState != IN_BATTLE {
+		return
+	}
+	needReFindPath := client.targetTreasureEaten
+	client.targetTreasureEaten = false
 
 	var excludeTreasureID map[int32]bool
 	// 防止server漏判吃草导致挂机
 	if !needReFindPath && atomic.LoadInt32(client.BotSpeed) > 0 &&
-		(client.pathFinding.NextGoalIndex >= len(client.pathFinding.CoordPath) || client.StayedCount > 20) {
+		(client.pathFinding.NextGoalIndex >= len(client.pathFinding.CoordPath) || client.StayedCount > client.Ai.StuckFrames) {
 		//fmt.Println("prevent stop by not eat treasure")
 		excludeTreasureID = make(map[int32]bool)
 		needReFindPath = true
 		excludeTreasureID[client.pathFinding.TargetTreasureId] = true
-		if client.StayedCount > 20 {
-			fmt.Println("prevent stop by StayedCount")
+		if client.StayedCount > client.Ai.StuckFrames {
+			client.tickLogger().Info("Stuck, replanning", zap.Int("stayedCount", client.StayedCount))
+			stuckDetections.Inc()
 			client.StayedCount = 0
 		}
 	}
@@ -514,28 +1019,146 @@ func (client *Client) checkReFindPath() {
 	}
 }
 
-func (client *Client) controller() {
+//按固定步长推进steps步, 返回推进的秒数. 0步时也要处理新到的下行帧, 只是不移动
+func (client *Client) advance(steps int) float64 {
+	if steps == 0 {
+		client.think(0)
+		return 0
+	}
+	dt := client.Ticker.Interval.Seconds()
+	for i := 0; i < steps; i++ {
+		client.think(dt)
+	}
+	return float64(steps) * dt
+}
+
+//每一步在处理完下行帧之后, 上行之前调用
+func (client *Client) think(dt float64) {
+	client.controller(dt)
+	if client.Idle {
+		return
+	}
+	client.checkReFindPath()
+	client.correctWallClipping()
+}
+
+//dt为这一步推进的秒数, 为0时不移动
+func (client *Client) controller(dt float64) {
 	if client.LastRoomDownsyncFrame == nil {
 		return
 	}
 	if !client.Started && client.LastRoomDownsyncFrame.Id > 0 { // 初始帧
 		client.Started = true
-		log.Println("Game Start")
 		client.BattleState = IN_BATTLE
 		client.Player.X = client.LastRoomDownsyncFrame.Players[client.Player.Id].X
 		client.Player.Y = client.LastRoomDownsyncFrame.Players[client.Player.Id].Y
 		//初始化需要寻找的宝物和玩家位置
 		client.initTreasureAndPlayers()
-		fmt.Printf("Init coord: %.2f, %.2f\n", client.Player.X, client.Player.Y)
 		client.pathFinding.SetCurrentCoord(client.Player.X, client.Player.Y)
-		fmt.Printf("Receive id: %d, treasure length %d, refId: %d \n", client.LastRoomDownsyncFrame.Id, len(client.LastRoomDownsyncFrame.Treasures), client.LastRoomDownsyncFrame.RefFrameId)
-	} else {
-		step := float64(atomic.LoadInt32(client.BotSpeed)) / 20
-		pathFindingMove(client, step)
+		client.tickLogger().Info("Battle started", zap.Float64("x", client.Player.X), zap.Float64("y", client.Player.Y), zap.Int("treasures", len(client.LastRoomDownsyncFrame.Treasures)))
+	} else if !client.Idle {
+		client.reconcilePosition()
+		if dt > 0 {
+			step := float64(atomic.LoadInt32(client.BotSpeed)) * dt
+			pathFindingMove(client, step)
+		}
 	}
 
 }
 
+//最多保留的上行坐标数, 以20帧每秒上行时可容忍约3秒的往返延迟
+const maxSentPositions = 64
+
+type sentPosition struct {
+	AckingFrameId int32
+	Pos           models.Vec2D
+}
+
+//记录本tick上行的坐标, 与upsyncCmd的内容一致
+func (client *Client) rememberSentPosition() {
+	if client.BattleState != IN_BATTLE {
+		return
+	}
+	if len(client.sentPositions) == maxSentPositions {
+		client.sentPositions = append(client.sentPositions[:0], client.sentPositions[1:]...)
+	}
+	client.sentPositions = append(client.sentPositions, sentPosition{
+		AckingFrameId: client.AckingFrameId,
+		Pos: models.Vec2D{
+			X: client.Player.X,
+			Y: client.Player.Y,
+		},
+	})
+}
+
+//以服务器为准: 被碰撞推开或被陷阱击退时, 本地坐标会与服务器不一致, 需要校正.
+//服务器帧中的坐标落后本地一个往返延迟, 因此与服务器生成该帧前可能收到的上行坐标比较, 取最接近的一个,
+//偏差即服务器对该上行的修正, 叠加到当前坐标上. 偏差不超过PositionSnapTolerance时只插值, 沿原路径继续走; 否则瞬移并重新寻路
+func (client *Client) reconcilePosition() {
+	frame := client.LastRoomDownsyncFrame
+	if client.BattleState != IN_BATTLE || frame.Id <= client.LastReconciledFrameId {
+		return
+	}
+	client.LastReconciledFrameId = frame.Id
+	serverPlayer, ok := frame.Players[client.Player.Id]
+	if !ok {
+		return
+	}
+	serverPos := models.Vec2D{
+		X: serverPlayer.X,
+		Y: serverPlayer.Y,
+	}
+	localPos := models.Vec2D{
+		X: client.Player.X,
+		Y: client.Player.Y,
+	}
+	//还没有上行过时直接与当前坐标比较
+	sentPos, matched := localPos, -1
+	dist := models.Distance(&serverPos, &localPos)
+	for i, sent := range client.sentPositions {
+		//确认了该帧或之后的帧时才发出的上行, 服务器生成该帧时还没有收到
+		if sent.AckingFrameId >= frame.Id {
+			break
+		}
+		if d := models.Distance(&serverPos, &sent.Pos); matched < 0 || d < dist {
+			sentPos, matched, dist = sent.Pos, i, d
+		}
+	}
+	//服务器按顺序处理上行, 之后的帧不会再对应更早的上行
+	if matched > 0 {
+		client.sentPositions = append(client.sentPositions[:0], client.sentPositions[matched:]...)
+		matched = 0
+	}
+	if dist <= client.Ai.PositionReconcileTolerance {
+		return
+	}
+	factor := client.Ai.PositionBlendFactor
+	snap := dist > client.Ai.PositionSnapTolerance
+	if snap {
+		factor = 1
+	}
+	dx := (serverPos.X - sentPos.X) * factor
+	dy := (serverPos.Y - sentPos.Y) * factor
+	client.Player.X += dx
+	client.Player.Y += dy
+	//服务器还没处理的上行也视为已修正, 否则在它们被处理前的每一帧都会重复修正
+	if matched == 0 {
+		for i := range client.sentPositions {
+			client.sentPositions[i].Pos.X += dx
+			client.sentPositions[i].Pos.Y += dy
+		}
+	}
+	client.tickLogger().Debug("Reconciled position", zap.Any("server", serverPos), zap.Any("sent", sentPos), zap.Any("local", localPos), zap.Float64("distance", dist), zap.Bool("snap", snap))
+	client.pathFinding.SetCurrentCoord(client.Player.X, client.Player.Y)
+	if !snap {
+		client.PositionBlends++
+		return
+	}
+	client.PositionSnaps++
+	client.StayedCount = 0
+	reFindPath(client.TmxIns, client, nil)
+}
+
 func pathFindingMove(client *Client, step float64) {
 	client.pathFinding.Move(step)
 	if client.BattleState == IN_BATTLE &&
@@ -546,73 +1169,239 @@ func pathFindingMove(client *Client, step float64) {
 	client.Player.X = client.pathFinding.CurrentCoord.X
 	client.Player.Y = client.pathFinding.CurrentCoord.Y
 	client.pathFinding.SetCurrentCoord(client.Player.X, client.Player.Y)
+	//没有移动时保持上一次的朝向, 避免停下时动画被重置
+	if radian, ok := client.pathFinding.LastStepRadian(); ok {
+		client.Radian = radian
+		client.Dir = models.DirectionByRadian(radian)
+	}
 }
 
 //lastPos := Position{};
 
-func (client *Client) upsyncFrameData() {
-	if client.BattleState == IN_BATTLE {
-		newFrame := &struct {
-			Id            int32            `json:"id"`
-			X             float64          `json:"x"`
-			Y             float64          `json:"y"`
-			Dir           models.Direction `json:"dir"`
-			AckingFrameId int32            `json:"AckingFrameId"`
-		}{client.Player.Id, client.Player.X, client.Player.Y, models.Direction{}, client.LastRoomDownsyncFrame.Id}
-
-		//fmt.Println(newFrame.AckingFrameId)
+//本tick要上行的指令, 不在战斗中时为nil
+func (client *Client) upsyncCmd() *pb.PlayerUpsyncCmd {
+	if client.BattleState != IN_BATTLE {
+		return nil
+	}
+	return &pb.PlayerUpsyncCmd{
+		Id:            client.Player.Id,
+		X:             client.Player.X,
+		Y:             client.Player.Y,
+		AckingFrameId: client.AckingFrameId,
+		Dir: &pb.Direction{
+			Dx: client.Dir.Dx,
+			Dy: client.Dir.Dy,
+		},
+	}
+}
 
-		newFrameByte, err := json.Marshal(newFrame)
-		if err != nil {
-			log.Println("json Marshal:", err)
-			return
+//dt为本tick推进的秒数, 随上行指令写入录像
+func (client *Client) upsyncFrameData(dt float64) {
+	if cmd := client.upsyncCmd(); cmd != nil {
+		client.rememberSentPosition()
+		if client.UpsyncEncoding == constants.UPSYNC_ENCODING_PB {
+			client.upsyncFrameDataPb(cmd)
+		} else {
+			client.upsyncFrameDataJson(cmd)
 		}
-		req := &wsReq{
-			MsgId: 1,
-			Act:   "PlayerUpsyncCmd",
-			Data:  newFrameByte,
-		}
-		reqByte, err := json.Marshal(req)
-		err = client.c.WriteMessage(websocket.TextMessage, reqByte)
-		if err != nil {
-			log.Println("write:", err)
-			return
+		client.emitTelemetry(telemetry.KIND_UPSYNC, cmd)
+		if client.recorder != nil {
+			client.checkRecorderErr(client.recorder.WriteUpsync(time.Now(), dt, cmd))
 		}
 	}
 }
 
+func (client *Client) upsyncFrameDataJson(cmd *pb.PlayerUpsyncCmd) {
+	newFrame := &struct {
+		Id            int32            `json:"id"`
+		X             float64          `json:"x"`
+		Y             float64          `json:"y"`
+		Dir           models.Direction `json:"dir"`
+		AckingFrameId int32            `json:"AckingFrameId"`
+	}{cmd.Id, cmd.X, cmd.Y, models.Direction{Dx: cmd.Dir.Dx, Dy: cmd.Dir.Dy}, cmd.AckingFrameId}
+
+	//fmt.Println(newFrame.AckingFrameId)
+
+	newFrameByte, err := json.Marshal(newFrame)
+	if err != nil {
+		client.tickLogger().Error("Encode upsync json", zap.Error(err))
+		return
+	}
+	req := &wsReq{
+		MsgId: 1,
+		Act:   "PlayerUpsyncCmd",
+		Data:  newFrameByte,
+	}
+	reqByte, err := json.Marshal(req)
+	err = client.writeMessage(websocket.TextMessage, reqByte)
+	if err != nil {
+		client.tickLogger().Warn("Write upsync", zap.Error(err))
+		client.stats.OnError("write", err)
+		return
+	}
+	client.stats.OnUpsync()
+}
+
+//与upsyncFrameDataJson发送相同的内容, 但整个请求以二进制的pb.WsReq发出, 省去json编解码的开销
+func (client *Client) upsyncFrameDataPb(cmd *pb.PlayerUpsyncCmd) {
+	newFrameByte, err := proto.Marshal(cmd)
+	if err != nil {
+		client.tickLogger().Error("Encode upsync", zap.Error(err))
+		return
+	}
+	req := &pb.WsReq{
+		MsgId: 1,
+		Act:   "PlayerUpsyncCmd",
+		Data:  newFrameByte,
+	}
+	reqByte, err := proto.Marshal(req)
+	if err != nil {
+		client.tickLogger().Error("Encode upsync", zap.Error(err))
+		return
+	}
+	err = client.writeMessage(websocket.BinaryMessage, reqByte)
+	if err != nil {
+		client.tickLogger().Warn("Write upsync", zap.Error(err))
+		client.stats.OnError("write", err)
+		return
+	}
+	client.stats.OnUpsync()
+}
+
+//离线模拟和重放录像时没有连接, 直接丢弃
+func (client *Client) writeMessage(messageType int, data []byte) error {
+	if client.c == nil {
+		return nil
+	}
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	return client.c.WriteMessage(messageType, data)
+}
+
 func (client *Client) playerBattleColliderAck() {
 	req := &wsReq{
 		MsgId: 1,
 		Act:   "PlayerBattleColliderAck",
 	}
 	reqByte, err := json.Marshal(req)
-	err = client.c.WriteMessage(websocket.TextMessage, reqByte)
+	err = client.writeMessage(websocket.TextMessage, reqByte)
 	if err != nil {
-		log.Println("write:", err)
+		client.tickLogger().Warn("Write PlayerBattleColliderAck", zap.Error(err))
 		return
 	}
 }
 
 //kobako: 从下行帧解析宝物信息是否减少
-func (client *Client) decodeProtoBuf(message []byte) {
-	roomDownSyncFrame := pb.RoomDownsyncFrame{}
-	err := proto.Unmarshal(message, &roomDownSyncFrame)
-	if err != nil {
-		fmt.Println("解析room_downsync_frame出错了!")
-		log.Panic(err)
+//解析失败时返回错误, 不交给上行goroutine
+func (client *Client) decodeProtoBuf(message []byte) error {
+	roomDownSyncFrame := new(pb.RoomDownsyncFrame)
+	if err := proto.Unmarshal(message, roomDownSyncFrame); err != nil {
+		return err
 	}
-	client.LastRoomDownsyncFrame = &roomDownSyncFrame
-	atomic.StoreInt32(client.BotSpeed, roomDownSyncFrame.Players[int32(client.Player.Id)].Speed)
+	downsyncFrames.Inc()
+	client.Ticker.OnServerFrame(roomDownSyncFrame.SentAt)
+	client.stats.OnDownsyncFrame(client.Ticker.FrameJitterMillis(roomDownSyncFrame.SentAt))
+	client.pushDownsyncEvent(downsyncEvent{
+		RoomDownsyncFrame: roomDownSyncFrame,
+		Raw:               message,
+		ReceivedAt:        time.Now(),
+	})
+	return nil
+}
 
+func (client *Client) emitTelemetry(kind string, data interface{}) {
+	client.telemetry.Publish(telemetry.Event{
+		Kind:    kind,
+		BotName: client.BotName,
+		RoomId:  client.Id,
+		Data:    data,
+	})
 }
 
-func ErrFatal(err error) {
-	if err != nil {
-		log.Fatal("ErrFatal", zap.NamedError("err", err))
+//bot眼中的世界: 下行帧本身在解码后不再被修改, 可以直接引用, TreasureMap会被上行goroutine修改, 需要复制
+func (client *Client) emitWorldView() {
+	if !client.telemetry.HasSubscribers() {
+		return
 	}
+	frame := client.LastRoomDownsyncFrame
+	view := &telemetryWorldView{
+		FrameId:     frame.Id,
+		BattleState: client.BattleState,
+		Self: models.Vec2D{
+			X: client.Player.X,
+			Y: client.Player.Y,
+		},
+		Players:        frame.Players,
+		Traps:          frame.Traps,
+		Bullets:        frame.Bullets,
+		Treasures:      make(map[int32]models.Point, len(client.pathFinding.TreasureMap)),
+		TreasureCoords: make(map[int32]models.Vec2D, len(client.pathFinding.TreasureMap)),
+	}
+	for id, pt := range client.pathFinding.TreasureMap {
+		view.Treasures[id] = pt
+		if client.TmxIns != nil && client.TmxIns.ContinuousPosMap != nil {
+			view.TreasureCoords[id] = client.TmxIns.ContinuousPosMap[pt.Y][pt.X]
+		}
+	}
+	client.emitTelemetry(telemetry.KIND_WORLD_VIEW, view)
+}
+
+func (client *Client) applyRoomDownsyncFrame(roomDownSyncFrame *pb.RoomDownsyncFrame) {
+	client.LastRoomDownsyncFrame = roomDownSyncFrame
+	//帧可能乱序到达, 只确认更新的帧
+	if roomDownSyncFrame.Id > client.AckingFrameId {
+		client.AckingFrameId = roomDownSyncFrame.Id
+	}
+	client.removeEatenTreasures(roomDownSyncFrame)
+	if player, ok := roomDownSyncFrame.Players[client.Player.Id]; ok {
+		atomic.StoreInt32(client.BotSpeed, player.Speed)
+		if player.Score > client.LastScore {
+			//全量帧中的宝物是剩下的而不是被吃掉的
+			if roomDownSyncFrame.RefFrameId != 0 {
+				treasuresCollected.Add(collectedTreasureCount(roomDownSyncFrame, player, player.Score-client.LastScore))
+			}
+			client.LastScore = player.Score
+		}
+	}
+	client.emitWorldView()
 }
 
-func clean() {
-	log.Println("About to clean up the resources occupied by this server-process.")
+//增量帧只带被吃掉的宝物, 不带吃掉它的玩家: 按距离由近到远取宝物, 直到它们的分数凑够玩家分数的增量,
+//这样同一帧里多个玩家各自吃到的宝物也能分开计数
+func collectedTreasureCount(frame *pb.RoomDownsyncFrame, player *pb.Player, scoreDelta int32) int64 {
+	pos := models.Vec2D{X: player.X, Y: player.Y}
+	type candidate struct {
+		score    int32
+		distance float64
+	}
+	candidates := make([]candidate, 0, len(frame.Treasures))
+	for _, treasure := range frame.Treasures {
+		if treasure.Score <= 0 {
+			continue
+		}
+		treasurePos := models.Vec2D{X: treasure.X, Y: treasure.Y}
+		candidates = append(candidates, candidate{treasure.Score, models.Distance(&pos, &treasurePos)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	var count int64
+	for _, c := range candidates {
+		if scoreDelta <= 0 {
+			break
+		}
+		scoreDelta -= c.score
+		count++
+	}
+	//后端没有下发被吃掉的宝物或其分数时至少算一个
+	if count == 0 {
+		count = 1
+	}
+	return count
+}
+
+func ErrFatal(err error) {
+	if err != nil {
+		zap.L().Fatal("ErrFatal", zap.Error(err))
+	}
 }
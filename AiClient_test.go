@@ -0,0 +1,826 @@
+package main
+
+import (
+	"AI/astar"
+	"AI/config"
+	"AI/constants"
+	"AI/fakeserver"
+	"AI/logging"
+	"AI/login"
+	"AI/metrics"
+	"AI/models"
+	pb "AI/pb_output"
+	"AI/replay"
+	"AI/telemetry"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const fakeTreasureId = 1
+
+//8x8的空地图, 只有一个远离所有格子的障碍物, 宝物在最后一个格子上
+func newFakeStage() *fakeserver.Stage {
+	barrier := &pb.Polygon2D{
+		Anchor: &pb.Vec2D{X: 100000, Y: 100000},
+		Points: []*pb.Vec2D{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}},
+	}
+	colliderInfo := &pb.BattleColliderInfo{
+		StageName:      "fake",
+		StageDiscreteW: 8,
+		StageDiscreteH: 8,
+		StageTileW:     64,
+		StageTileH:     32,
+		StrToPolygon2DListMap: map[string]*pb.Polygon2DList{
+			"Barrier": {Polygon2DList: []*pb.Polygon2D{barrier}},
+		},
+	}
+	stage := fakeserver.NewStage(colliderInfo, nil, nil)
+	treasureX, treasureY := stage.Tmx.GetCoordByGid(63)
+	stage.Treasures = []*pb.Treasure{{Id: fakeTreasureId, LocalIdInBattle: fakeTreasureId, X: treasureX, Y: treasureY, Score: 1}}
+	return stage
+}
+
+func startFakeServer(stage *fakeserver.Stage) (*fakeserver.Server, *httptest.Server) {
+	server := fakeserver.NewServer(stage)
+	httpServer := httptest.NewServer(server)
+	return server, httpServer
+}
+
+//上下行goroutine同时运行, 需配合`go test -race`
+func TestClientLoopsAgainstFakeServer(t *testing.T) {
+	stage := newFakeStage()
+	server, httpServer := startFakeServer(stage)
+	defer httpServer.Close()
+	defer server.Close()
+
+	token, err := login.NewClient(httpServer.URL).Login("bot1", login.DEFAULT_PHONE_COUNTRY_CODE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsUrl := "ws" + strings.TrimPrefix(httpServer.URL, "http") + fakeserver.WS_PATH + "?" + url.Values{"intAuthToken": {token.IntAuthToken}}.Encode()
+	c, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	client := newClient(c, int32(token.PlayerId), spawnBotOptions{
+		UpsyncEncoding: constants.UPSYNC_ENCODING_PB,
+		UpsyncRate:     constants.DEFAULT_UPSYNC_RATE,
+		Ai:             config.Default().Ai,
+	})
+	hub := telemetry.NewHub()
+	client.BotName = "bot1"
+	client.telemetry = hub
+	subscriber := hub.Subscribe(nil)
+	kinds := make(map[string]int)
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		for e := range subscriber.C {
+			//与上行goroutine并发序列化, 检查推送的数据没有被继续修改
+			if _, err := json.Marshal(e); err != nil {
+				t.Errorf("marshal %s event: %v", e.Kind, err)
+			}
+			kinds[e.Kind]++
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	client.run(ctx, nil)
+	hub.Unsubscribe(subscriber)
+	close(subscriber.C)
+	<-consumed
+	if stage := client.DebugStage(); stage == nil || len(stage.CollideMap) != 8 || len(stage.Barriers) != 1 {
+		t.Errorf("unexpected debug stage %v", stage)
+	}
+	for _, kind := range []string{telemetry.KIND_WORLD_VIEW, telemetry.KIND_TARGET, telemetry.KIND_PATH, telemetry.KIND_UPSYNC} {
+		if kinds[kind] == 0 {
+			t.Errorf("no %s telemetry event", kind)
+		}
+	}
+
+	//服务器先回应close帧, 之后才在读goroutine中记录状态码
+	var player fakeserver.PlayerSnapshot
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		player, _ = server.Player(int32(token.PlayerId))
+		if player.CloseCode != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if player.Upsyncs < 5 {
+		t.Fatalf("expected at least 5 upsync commands, got %d", player.Upsyncs)
+	}
+	cmd := player.LastUpsync
+	if cmd.Id != int32(token.PlayerId) || cmd.AckingFrameId <= 0 {
+		t.Errorf("unexpected upsync command %v", cmd)
+	}
+	start := stage.StartingPosition(1)
+	if cmd.X == start.X && cmd.Y == start.Y {
+		t.Errorf("bot never moved from (%.2f, %.2f)", start.X, start.Y)
+	}
+	if cmd.Dir == nil || (cmd.Dir.Dx == 0 && cmd.Dir.Dy == 0) {
+		t.Errorf("expected a facing direction, got %v", cmd.Dir)
+	}
+	if player.CloseCode != websocket.CloseNormalClosure {
+		t.Errorf("expected a normal websocket close, got %d", player.CloseCode)
+	}
+}
+
+func newTestBotServer(t *testing.T, gameServerUrl string, botNames ...string) *botServer {
+	u, err := url.Parse(gameServerUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.GameServer.Host = u.Hostname()
+	cfg.GameServer.Port, _ = strconv.Atoi(u.Port())
+	cfg.GameServer.WsPath = fakeserver.WS_PATH
+	cfg.Bot.Lifetime = 5 * time.Second
+	cfg.Bot.LeaseTimeout = 10 * time.Second
+	server := &botServer{
+		config:    cfg,
+		shards:    newShards(cfg),
+		registry:  newBotRegistry(),
+		telemetry: telemetry.NewHub(),
+		startedAt: time.Now(),
+	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+	server.shards[0].botManager.SetBots(botNames)
+	return server
+}
+
+//从/spawnBot开始, 经过登录和websocket, 到bot在fake server上吃到宝物, 最后随进程退出正常断开
+func TestSpawnBotEndToEnd(t *testing.T) {
+	stage, err := fakeserver.LoadStage("map/map/pacman/map.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameServer, gameHttpServer := startFakeServer(stage)
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	server := newTestBotServer(t, gameHttpServer.URL, "bot1", "bot2")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerApi(r)
+
+	//指标是全局的, 只比较本测试前后的差值
+	spawns, frames, collected := botSpawns.Value(), downsyncFrames.Value(), treasuresCollected.Value()
+	replanned, cancelled := replans.Value(), botDisconnects.With(DISCONNECT_CANCELLED).Value()
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/spawnBot?expectedRoomId=5", nil))
+		resp := struct {
+			Ret     int    `json:"ret"`
+			BotName string `json:"botName"`
+			Shard   string `json:"shard"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Ret != RET_OK || resp.Shard != config.DEFAULT_SHARD_NAME {
+			t.Fatalf("spawnBot: %s", w.Body.String())
+		}
+	}
+
+	var players []fakeserver.PlayerSnapshot
+	deadline := time.Now().Add(4 * time.Second)
+	for time.Now().Before(deadline) {
+		players = gameServer.Players()
+		scored := 0
+		for _, player := range players {
+			if player.Score > 0 {
+				scored++
+			}
+		}
+		//分数随下一个下行帧才到达bot
+		if len(players) == 2 && scored == 2 && treasuresCollected.Value()-collected >= 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(players) != 2 {
+		t.Fatalf("expected 2 players on the game server, got %+v", players)
+	}
+	for _, player := range players {
+		if player.RoomId != 5 || player.Upsyncs == 0 || player.Score == 0 {
+			t.Errorf("unexpected player %+v", player)
+		}
+	}
+	if busy, _ := server.shards[0].botManager.Stats(); busy != 2 {
+		t.Errorf("expected 2 busy bots, got %d", busy)
+	}
+	if active := activeBots.Value(); active != 2 {
+		t.Errorf("expected 2 active bots, got %d", active)
+	}
+
+	if terminated := server.shutdown(3 * time.Second); len(terminated) != 0 {
+		t.Errorf("bots %v were forcibly terminated", terminated)
+	}
+	if busy, idle := server.shards[0].botManager.Stats(); busy != 0 || idle != 2 {
+		t.Errorf("expected all bots to be released, got busy %d idle %d", busy, idle)
+	}
+	if gameServer.SmsLoginCount() != 2 {
+		t.Errorf("expected 2 sms logins, got %d", gameServer.SmsLoginCount())
+	}
+
+	if botSpawns.Value()-spawns != 2 || downsyncFrames.Value() == frames || replans.Value() == replanned || activeBots.Value() != 0 {
+		t.Errorf("unexpected bot metrics, spawns %d, frames %d, replans %d, active %d", botSpawns.Value()-spawns, downsyncFrames.Value()-frames, replans.Value()-replanned, activeBots.Value())
+	}
+	if treasuresCollected.Value()-collected < 2 || botDisconnects.With(DISCONNECT_CANCELLED).Value()-cancelled != 2 {
+		t.Errorf("expected both bots to collect treasures and be cancelled, got %d and %d", treasuresCollected.Value()-collected, botDisconnects.With(DISCONNECT_CANCELLED).Value()-cancelled)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != metrics.CONTENT_TYPE {
+		t.Errorf("unexpected content type %q", w.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{"\nai_bot_spawns_total ", "\nai_bot_active 0\n", `ai_bot_disconnects_total{reason="cancelled"} `, `ai_astar_expansions_bucket{le="+Inf"} `, "\nai_astar_duration_seconds_count "} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("expected %q in /metrics:\n%s", line, w.Body.String())
+		}
+	}
+}
+
+//bot的日志都带有bot名, 分片和玩家id, 上行goroutine中的还带有房间号和帧号
+func TestSpawnBotLogsFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	stage, err := fakeserver.LoadStage("map/map/pacman/map.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameServer, gameHttpServer := startFakeServer(stage)
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	server := newTestBotServer(t, gameHttpServer.URL, "bot1")
+	server.config.Bot.Lifetime = time.Second
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerApi(r)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/spawnBot?expectedRoomId=5", nil))
+	if !strings.Contains(w.Body.String(), `"ret":1000`) {
+		t.Fatalf("spawnBot: %s", w.Body.String())
+	}
+	deadline := time.Now().Add(4 * time.Second)
+	for time.Now().Before(deadline) && logs.FilterMessage("Disconnecting").Len() == 0 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	server.shutdown(3 * time.Second)
+
+	player := gameServer.Players()[0]
+	started := logs.FilterMessage("Battle started").All()
+	if len(started) != 1 {
+		t.Fatalf("expected a single battle start, got %v", logs.All())
+	}
+	fields := started[0].ContextMap()
+	if fields[logging.FIELD_BOT] != "bot1" || fields[logging.FIELD_SHARD] != config.DEFAULT_SHARD_NAME || fields[logging.FIELD_PLAYER_ID] != player.PlayerId ||
+		fields[logging.FIELD_ROOM_ID] != int64(5) || fields[logging.FIELD_FRAME_ID].(int32) <= 0 {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	disconnecting := logs.FilterMessage("Disconnecting").All()
+	if len(disconnecting) != 1 || disconnecting[0].ContextMap()["reason"] != DISCONNECT_LIFETIME || disconnecting[0].ContextMap()[logging.FIELD_BOT] != "bot1" {
+		t.Errorf("expected the bot to disconnect at the end of its lifetime, got %v", disconnecting)
+	}
+}
+
+//两个bot在fake server上比赛, 只有一个录像, 返回录像文件的路径
+func recordFakeMatch(t *testing.T, dir string) string {
+	stage, err := fakeserver.LoadStage("map/map/pacman/map.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameServer, gameHttpServer := startFakeServer(stage)
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	server := newTestBotServer(t, gameHttpServer.URL, "bot1", "bot2")
+	server.config.Replay.Dir = dir
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerApi(r)
+	for _, query := range []string{"record=1", "record=false"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/spawnBot?expectedRoomId=5&"+query, nil))
+		if !strings.Contains(w.Body.String(), `"ret":1000`) {
+			t.Fatalf("spawnBot: %s", w.Body.String())
+		}
+	}
+	deadline := time.Now().Add(4 * time.Second)
+	for time.Now().Before(deadline) {
+		if players := gameServer.Players(); len(players) == 2 && players[0].Score > 0 && players[1].Score > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if terminated := server.shutdown(3 * time.Second); len(terminated) != 0 {
+		t.Fatalf("bots %v were forcibly terminated", terminated)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.replay"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected a single replay, got %v %v", files, err)
+	}
+	return files[0]
+}
+
+//录像中应依次有BattleColliderInfo, 全量帧和之后的增量帧与上行指令
+func TestSpawnBotRecordsReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := recordFakeMatch(t, dir)
+
+	meta, records, err := replay.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.PlayerId == 0 || !strings.HasPrefix(filepath.Base(path), meta.BotName+"-") || meta.UpsyncRate != config.Default().Tick.UpsyncRate {
+		t.Errorf("unexpected meta %+v of %s", meta, path)
+	}
+	if len(records) == 0 {
+		t.Fatal("empty replay")
+	}
+	roomId, info, err := records[0].BattleColliderInfo()
+	if err != nil || roomId != 5 || info.StageName != "pacman" {
+		t.Fatalf("expected the BattleColliderInfo first, got room %d %v %v", roomId, info, err)
+	}
+	var frames, upsyncs int
+	//记录按处理顺序写入, 下行帧的时间是收到的时间, 只在同类记录之间有序
+	lastAt := make(map[byte]time.Duration)
+	for _, record := range records[1:] {
+		if record.At < lastAt[record.Kind] {
+			t.Errorf("records of kind %d out of order at %v", record.Kind, record.At)
+		}
+		lastAt[record.Kind] = record.At
+		switch record.Kind {
+		case replay.KIND_DOWNSYNC_FRAME:
+			frame, err := record.DownsyncFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frames == 0 && (frame.RefFrameId != 0 || len(frame.Treasures) == 0) {
+				t.Errorf("expected the full frame first, got %d ref %d", frame.Id, frame.RefFrameId)
+			}
+			if frames > 0 && frame.RefFrameId != frame.Id-1 {
+				t.Errorf("expected a diff frame, got %d ref %d", frame.Id, frame.RefFrameId)
+			}
+			frames++
+		case replay.KIND_UPSYNC:
+			dt, cmd, err := record.Upsync()
+			if err != nil || cmd.Id != meta.PlayerId || dt < 0 {
+				t.Fatalf("unexpected upsync %v %v %v", dt, cmd, err)
+			}
+			if frames == 0 {
+				t.Errorf("upsync before any downsync frame")
+			}
+			upsyncs++
+		default:
+			t.Errorf("unexpected record kind %d", record.Kind)
+		}
+	}
+	if frames < 2 || upsyncs == 0 {
+		t.Errorf("expected frames and upsyncs to be recorded, got %d frames %d upsyncs", frames, upsyncs)
+	}
+}
+
+func TestShutdownReportsUndrainedBots(t *testing.T) {
+	cfg := config.Default()
+	server := &botServer{
+		config:   cfg,
+		shards:   newShards(cfg),
+		registry: newBotRegistry(),
+	}
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+	server.shards[0].botManager.SetBots([]string{"bot1", "bot2"})
+
+	//bot1卡在登录中, 不响应取消
+	lease, err := server.shards[0].botManager.AcquireBot(1, "", time.Minute)
+	if err != nil || server.beginSpawn(1) != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	//bot2收到取消后退出
+	if server.beginSpawn(1) != nil {
+		t.Fatal("beginSpawn failed before shutdown")
+	}
+	go func() {
+		<-server.ctx.Done()
+		server.spawns.Done()
+	}()
+
+	terminated := server.shutdown(100 * time.Millisecond)
+	if len(terminated) != 1 || terminated[0] != lease.BotName {
+		t.Errorf("expected %s to be reported, got %v", lease.BotName, terminated)
+	}
+	if server.beginSpawn(1) != errShuttingDown {
+		t.Errorf("expected spawns to be rejected while shutting down")
+	}
+}
+
+//check_daemon.sh依赖/healthz, 开始退出后应返回503
+func TestHealthz(t *testing.T) {
+	server := newTestBotServer(t, "http://localhost:9992", "bot1")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerApi(r)
+	healthz := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		resp := make(map[string]interface{})
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("healthz: %s", w.Body.String())
+		}
+		return w.Code, resp
+	}
+
+	code, resp := healthz()
+	if code != 200 || resp["ret"] != float64(RET_OK) || resp["pid"] != float64(os.Getpid()) || resp["idle"] != float64(1) || resp["draining"] != false {
+		t.Errorf("unexpected healthz %d %v", code, resp)
+	}
+	server.shutdown(100 * time.Millisecond)
+	if code, resp = healthz(); code != 503 || resp["ret"] != float64(RET_FAILED) || resp["draining"] != true {
+		t.Errorf("expected 503 while shutting down, got %d %v", code, resp)
+	}
+}
+
+//服务器帧中的坐标落后一个往返延迟, 单纯的延迟不应触发校正; 被推开时先插值, 偏差过大时才瞬移并重新寻路
+func TestReconcilePositionWithLaggingServer(t *testing.T) {
+	client := newClient(nil, 1, spawnBotOptions{Ai: config.Default().Ai})
+	client.initBattleCollider(newFakeStage().ColliderInfo)
+	client.TmxIns.InitContinuousPosMap()
+	client.BattleState = IN_BATTLE
+	client.Started = true
+	client.Player.X, client.Player.Y = 100, 100
+	//每帧10px即20帧每秒时200px/s, 4帧的延迟下服务器落后40px, 超过positionReconcileTolerance
+	const step, lagFrames = 10.0, 4
+	serverFrame := func(id int32, pos *pb.Player) {
+		client.applyRoomDownsyncFrame(&pb.RoomDownsyncFrame{
+			Id:      id,
+			Players: map[int32]*pb.Player{client.Player.Id: pos},
+		})
+		client.reconcilePosition()
+	}
+	var sent []pb.Player
+	for id := int32(1); id <= 20; id++ {
+		//第id帧由服务器在收到lagFrames帧之前的上行后生成
+		server := pb.Player{X: 100, Y: 100}
+		if i := int(id) - 1 - lagFrames; i >= 0 {
+			server = sent[i]
+		}
+		serverFrame(id, &server)
+		client.Player.X += step
+		client.rememberSentPosition()
+		sent = append(sent, pb.Player{X: client.Player.X, Y: client.Player.Y})
+	}
+	if client.PositionBlends != 0 || client.PositionSnaps != 0 || client.Player.X != 100+20*step || client.Player.Y != 100 {
+		t.Fatalf("expected the lag to be tolerated, got %d blends, %d snaps at (%.1f, %.1f)", client.PositionBlends, client.PositionSnaps, client.Player.X, client.Player.Y)
+	}
+
+	//服务器把第16个上行的坐标推开60px, 只向其插值一半且不重新寻路
+	pushed := sent[20-1-lagFrames]
+	pushed.Y += 60
+	serverFrame(21, &pushed)
+	if client.PositionBlends != 1 || client.PositionSnaps != 0 || client.Player.X != 100+20*step || client.Player.Y != 130 {
+		t.Fatalf("expected a blend to (%.1f, 130), got %d blends, %d snaps at (%.1f, %.1f)", 100+20*step, client.PositionBlends, client.PositionSnaps, client.Player.X, client.Player.Y)
+	}
+	//服务器还没处理的上行已随插值修正, 同一个推开量不会被重复计入
+	pushed = sent[21-1-lagFrames]
+	pushed.Y += 300
+	serverFrame(22, &pushed)
+	if client.PositionSnaps != 1 || client.Player.Y != 400 || client.pathFinding.CurrentCoord.Y != 400 {
+		t.Errorf("expected a snap to y 400, got %d snaps at (%.1f, %.1f)", client.PositionSnaps, client.Player.X, client.Player.Y)
+	}
+}
+
+//上行goroutine异常退出后run应立即结束, 而不是等到寿命到期
+func TestRunEndsWhenUpsyncExits(t *testing.T) {
+	server, httpServer := startFakeServer(newFakeStage())
+	defer httpServer.Close()
+	defer server.Close()
+
+	token, err := login.NewClient(httpServer.URL).Login("bot1", login.DEFAULT_PHONE_COUNTRY_CODE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsUrl := "ws" + strings.TrimPrefix(httpServer.URL, "http") + fakeserver.WS_PATH + "?" + url.Values{"intAuthToken": {token.IntAuthToken}}.Encode()
+	c, _, err := websocket.DefaultDialer.Dial(wsUrl, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	client := newClient(c, int32(token.PlayerId), spawnBotOptions{UpsyncRate: constants.DEFAULT_UPSYNC_RATE, Ai: config.Default().Ai})
+	//第一次等待下一个tick时panic
+	client.Ticker = nil
+	disconnects := botDisconnects.With(DISCONNECT_UPSYNC).Value()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	startedAt := time.Now()
+	client.run(ctx, nil)
+	if elapsed := time.Since(startedAt); elapsed > 5*time.Second || botDisconnects.With(DISCONNECT_UPSYNC).Value()-disconnects != 1 {
+		t.Errorf("expected run to end with reason %s, took %v", DISCONNECT_UPSYNC, elapsed)
+	}
+}
+
+//畸形的下行消息只计数, 不能覆盖已有的地图和最后一帧, 也不能让bot退出
+func TestDownsyncSkipsMalformedMessages(t *testing.T) {
+	stage := newFakeStage()
+	colliderInfo, err := proto.Marshal(stage.ColliderInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := stage.StartingPosition(1)
+	frame, err := proto.Marshal(&pb.RoomDownsyncFrame{
+		Id:        1,
+		Players:   map[int32]*pb.Player{1: {Id: 1, X: start.X, Y: start.Y, Speed: 100}},
+		Treasures: map[int32]*pb.Treasure{fakeTreasureId: stage.Treasures[0]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustMarshal := func(v interface{}) []byte {
+		bytes, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes
+	}
+	heartbeat := func(colliderInfo []byte) []byte {
+		return mustMarshal(&wsResp{Act: "HeartbeatRequirements", Data: mustMarshal(&HeartbeatRequirementsData{BoundRoomId: 3, BattleColliderInfo: colliderInfo})})
+	}
+	frameAct := mustMarshal(&wsResp{Act: "RoomDownsyncFrame"})
+	messages := [][]byte{
+		heartbeat(colliderInfo),
+		frameAct, mustMarshal(&wsRespPb{Act: "RoomDownsyncFrame", Data: frame}),
+		frameAct, []byte(`{"data":`),
+		frameAct, mustMarshal(&wsRespPb{Act: "RoomDownsyncFrame", Data: []byte{0xff, 0xff}}),
+		mustMarshal(&wsResp{Act: "HeartbeatRequirements", Data: json.RawMessage(`"oops"`)}),
+		heartbeat([]byte{0xff, 0xff}),
+	}
+	upgrader := websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, message := range messages {
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		}
+		//读到bot的close帧后回应并返回
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer httpServer.Close()
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	frameErrors, heartbeatErrors, colliderErrors := decodeErrors.With("RoomDownsyncFrame").Value(), decodeErrors.With("HeartbeatRequirements").Value(), decodeErrors.With("BattleColliderInfo").Value()
+	cancelled := botDisconnects.With(DISCONNECT_CANCELLED).Value()
+	client := newClient(c, 1, spawnBotOptions{UpsyncRate: constants.DEFAULT_UPSYNC_RATE, Ai: config.Default().Ai})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.run(ctx, nil)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if client.Status().FrameId == 1 && decodeErrors.With("RoomDownsyncFrame").Value()-frameErrors == 2 &&
+			decodeErrors.With("HeartbeatRequirements").Value()-heartbeatErrors == 1 && decodeErrors.With("BattleColliderInfo").Value()-colliderErrors == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	//再等几个tick让上行goroutine处理完可能错误交出的数据
+	time.Sleep(5 * client.Ticker.Interval)
+	cancel()
+	<-done
+
+	if client.LastRoomDownsyncFrame == nil || client.LastRoomDownsyncFrame.Id != 1 || len(client.LastRoomDownsyncFrame.Players) != 1 {
+		t.Errorf("expected the last frame to be kept, got %v", client.LastRoomDownsyncFrame)
+	}
+	if client.Id != 3 || client.TmxIns == nil || client.TmxIns.Width != 8 {
+		t.Errorf("expected the map of room 3 to be kept, got room %d and %+v", client.Id, client.TmxIns)
+	}
+	if stage := client.DebugStage(); stage == nil || len(stage.CollideMap) != 8 {
+		t.Errorf("unexpected debug stage %v", stage)
+	}
+	if botDisconnects.With(DISCONNECT_CANCELLED).Value()-cancelled != 1 {
+		t.Errorf("expected the bot to run until cancelled")
+	}
+}
+
+//寻路被放弃时由bot自己的logger记录起点和终点, 而不是直接打印到标准输出
+func TestReFindPathLogsAbandonedSearch(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	client := newClient(nil, 1, spawnBotOptions{Ai: config.Default().Ai})
+	client.setLogger(zap.New(core).With(logging.Bot("bot1")))
+	client.initBattleCollider(newFakeStage().ColliderInfo)
+	client.TmxIns.InitContinuousPosMap()
+	//60x60的空地, 宝物被障碍物围住, 搜索完所有可达的格子之前就会超过上限
+	collideMap := make(astar.Map, 60)
+	for y := range collideMap {
+		collideMap[y] = make([]int, 60)
+	}
+	goal := astar.Point{X: 50, Y: 50}
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if dx != 0 || dy != 0 {
+				collideMap[goal.Y+dy][goal.X+dx] = astar.BARRIER
+			}
+		}
+	}
+	client.pathFinding.SetCollideMap(collideMap)
+	client.pathFinding.SetTreasureMap(map[int32]models.Point{1: {X: goal.X, Y: goal.Y}})
+	reFindPath(client.TmxIns, client, nil)
+
+	entries := logs.FilterMessage("Path search failed").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected the abandoned search to be logged once, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields[logging.FIELD_BOT] != "bot1" || fields["error"] != astar.ErrTooManyTries.Error() || fields["goal"] != goal {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if _, ok := fields["start"]; !ok || len(client.pathFinding.CoordPath) != 0 {
+		t.Errorf("expected the start to be logged and no path, got %v and %v", fields, client.pathFinding.CoordPath)
+	}
+}
+
+func TestCollectedTreasureCount(t *testing.T) {
+	player := &pb.Player{Id: 1, X: 0, Y: 0}
+	cases := []struct {
+		name       string
+		treasures  map[int32]*pb.Treasure
+		scoreDelta int32
+		count      int64
+	}{
+		{"one", map[int32]*pb.Treasure{1: {Id: 1, X: 5, Score: 1}}, 1, 1},
+		{"several", map[int32]*pb.Treasure{1: {Id: 1, X: 5, Score: 1}, 2: {Id: 2, Y: 5, Score: 1}, 3: {Id: 3, X: 3, Score: 1}}, 3, 3},
+		{"high score", map[int32]*pb.Treasure{1: {Id: 1, X: 5, Score: 5}}, 5, 1},
+		//同一帧里另一个玩家在远处吃掉的宝物不算
+		{"shared frame", map[int32]*pb.Treasure{1: {Id: 1, X: 5, Score: 1}, 2: {Id: 2, X: 500, Score: 1}, 3: {Id: 3, Y: 8, Score: 2}}, 3, 2},
+		{"no treasures", nil, 2, 1},
+		{"no scores", map[int32]*pb.Treasure{1: {Id: 1, X: 5}}, 1, 1},
+	}
+	for _, c := range cases {
+		frame := &pb.RoomDownsyncFrame{Id: 2, RefFrameId: 1, Treasures: c.treasures}
+		if count := collectedTreasureCount(frame, player, c.scoreDelta); count != c.count {
+			t.Errorf("%s: expected %d treasures, got %d", c.name, c.count, count)
+		}
+	}
+}
+
+//一个tick中应用的多个增量帧里被吃掉的宝物都要移除, 目标宝物在中间的帧里被吃掉时也要重新寻路
+func TestConsumeDownsyncEventsRemovesTreasuresOfEveryFrame(t *testing.T) {
+	client := newClient(nil, 1, spawnBotOptions{UpsyncRate: constants.DEFAULT_UPSYNC_RATE})
+	client.BattleState = IN_BATTLE
+	client.Started = true
+	client.pathFinding.SetTreasureMap(map[int32]models.Point{1: {X: 1}, 2: {X: 2}, 3: {X: 3}})
+	client.pathFinding.UpdateTargetTreasureId(2)
+	for id := int32(2); id <= 3; id++ {
+		client.pushDownsyncEvent(downsyncEvent{RoomDownsyncFrame: &pb.RoomDownsyncFrame{
+			Id:         id,
+			RefFrameId: id - 1,
+			Treasures:  map[int32]*pb.Treasure{id: {Id: id}},
+		}})
+	}
+	client.consumeDownsyncEvents()
+	if _, ok := client.pathFinding.TreasureMap[1]; !ok || len(client.pathFinding.TreasureMap) != 1 || !client.targetTreasureEaten {
+		t.Errorf("expected treasures 2 and 3 to be removed and the target to be eaten, got %v, eaten %v", client.pathFinding.TreasureMap, client.targetTreasureEaten)
+	}
+}
+
+func getJson(t *testing.T, r *gin.Engine, target string, v interface{}) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s: %v, %s", target, err, w.Body.String())
+	}
+}
+
+type listBotsResp struct {
+	Ret  int       `json:"ret"`
+	Bots []botInfo `json:"bots"`
+}
+
+type capacityResp struct {
+	Ret       int                       `json:"ret"`
+	Total     int                       `json:"total"`
+	Busy      int                       `json:"busy"`
+	Idle      int                       `json:"idle"`
+	Connected int                       `json:"connected"`
+	Shards    map[string]*shardCapacity `json:"shards"`
+}
+
+//批量派出, 列出, 停止bot以及容量统计, 空闲bot不足时批量派出一个都不占用
+func TestBotApi(t *testing.T) {
+	gameServer, gameHttpServer := startFakeServer(newFakeStage())
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	server := newTestBotServer(t, gameHttpServer.URL, "bot1", "bot2", "bot3")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerApi(r)
+
+	var failed struct {
+		Ret int    `json:"ret"`
+		Err string `json:"err"`
+	}
+	for _, target := range []string{"/spawnBots?count=2", "/spawnBots?expectedRoomId=5&count=0", "/spawnBots?expectedRoomId=5&count=4", "/stopBot?botName=bot1"} {
+		failed.Ret = 0
+		getJson(t, r, target, &failed)
+		if failed.Ret != RET_FAILED || failed.Err == "" {
+			t.Errorf("%s: expected a failure, got %+v", target, failed)
+		}
+	}
+	var capacity capacityResp
+	getJson(t, r, "/capacity", &capacity)
+	if capacity.Total != 3 || capacity.Busy != 0 || capacity.Idle != 3 {
+		t.Fatalf("expected the leases of the failed batch to be released, got %+v", capacity)
+	}
+
+	var spawned struct {
+		Ret      int      `json:"ret"`
+		BotNames []string `json:"botNames"`
+		Shard    string   `json:"shard"`
+	}
+	getJson(t, r, "/spawnBots?expectedRoomId=5&count=2", &spawned)
+	if spawned.Ret != RET_OK || len(spawned.BotNames) != 2 || spawned.Shard != config.DEFAULT_SHARD_NAME {
+		t.Fatalf("unexpected spawnBots response %+v", spawned)
+	}
+	var bots listBotsResp
+	deadline := time.Now().Add(4 * time.Second)
+	for time.Now().Before(deadline) {
+		getJson(t, r, "/bots", &bots)
+		if len(bots.Bots) == 2 && bots.Bots[0].Connected && bots.Bots[1].Connected {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(bots.Bots) != 2 || !bots.Bots[0].Connected || !bots.Bots[1].Connected || bots.Bots[0].Status == nil || bots.Bots[0].BotName > bots.Bots[1].BotName {
+		t.Fatalf("expected both bots to be listed as connected, got %+v", bots)
+	}
+	getJson(t, r, "/capacity", &capacity)
+	if capacity.Busy != 2 || capacity.Idle != 1 || capacity.Connected != 2 || capacity.Shards[config.DEFAULT_SHARD_NAME].Connected != 2 {
+		t.Errorf("unexpected capacity %+v", capacity)
+	}
+	getJson(t, r, "/bots?shard=unknown", &bots)
+	if bots.Ret != RET_OK || len(bots.Bots) != 0 {
+		t.Errorf("expected no bots of an unknown shard, got %+v", bots)
+	}
+
+	var stopped struct {
+		Ret     int    `json:"ret"`
+		BotName string `json:"botName"`
+	}
+	getJson(t, r, "/stopBot?botName="+spawned.BotNames[0], &stopped)
+	if stopped.Ret != RET_OK || stopped.BotName != spawned.BotNames[0] {
+		t.Fatalf("unexpected stopBot response %+v", stopped)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		getJson(t, r, "/bots", &bots)
+		if len(bots.Bots) == 1 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if len(bots.Bots) != 1 || bots.Bots[0].BotName != spawned.BotNames[1] {
+		t.Errorf("expected only %s to be left, got %+v", spawned.BotNames[1], bots)
+	}
+	if terminated := server.shutdown(3 * time.Second); len(terminated) != 0 {
+		t.Errorf("bots %v were forcibly terminated", terminated)
+	}
+}
@@ -1,11 +1,13 @@
 package astar
 
 import (
+	"AI/metrics"
 	"errors"
 	"fmt"
 	mapset "github.com/deckarep/golang-set"
 	. "github.com/logrusorgru/aurora"
 	"math"
+	"time"
 )
 
 type Map = [][]int //Itself is the pointer
@@ -21,6 +23,13 @@ const (
 	GOAL    = 3
 )
 
+//搜索超过3000次扩展时放弃, 桶覆盖到4096
+var (
+	searchExpansions = metrics.NewHistogram("ai_astar_expansions", "Nodes expanded by one A* search.", metrics.ExponentialBuckets(1, 2, 13))
+	searchSeconds    = metrics.NewHistogram("ai_astar_duration_seconds", "Duration of one A* search.", metrics.ExponentialBuckets(0.0001, 2, 14))
+	searchNoPath     = metrics.NewCounter("ai_astar_no_path_total", "A* searches that found no path, including the ones given up.")
+)
+
 func findPoint(m Map, value int) (Point, error) {
 	for row := range m {
 		for col := range m[row] {
@@ -54,7 +63,8 @@ func minimum(openSet mapset.Set, fScore map[string]float64) (string, Point) {
 	for i := range openSet.Iterator().C {
 		if pt, ok := i.(Point); ok {
 			score := fScore[hash(pt)]
-			if score <= min {
+			//fScore相同时按坐标取, 使结果不依赖set的遍历顺序
+			if score < min || (score == min && (pt.Y < point.Y || (pt.Y == point.Y && pt.X < point.X))) {
 				min = score
 				key = hash(pt)
 				point = pt
@@ -110,8 +120,13 @@ func isBarrier(m Map, pt Point) bool {
 	return pt.X < 0 || pt.Y < 0 || len(m) <= pt.Y || len(m[pt.Y]) <= pt.X || m[pt.Y][pt.X] == BARRIER
 }
 
-func AstarByStartAndGoalPoint(m Map, start Point, goal Point) []Point {
+//扩展的节点超过上限时放弃搜索, 通常说明地图或调用方有问题
+var ErrTooManyTries = errors.New("Had tried too many times, there may be some logic error in your code!")
+
+//找不到路径时返回空的路径, 搜索被放弃时另外返回ErrTooManyTries, 由调用方记录日志
+func AstarByStartAndGoalPoint(m Map, start Point, goal Point) ([]Point, error) {
 	//fmt.Printf("Astar start: start at: %v, goal at: %v", start, goal)
+	startedAt := time.Now()
 
 	openSet := mapset.NewSet(start)
 	closeSet := mapset.NewSet()
@@ -125,8 +140,7 @@ func AstarByStartAndGoalPoint(m Map, start Point, goal Point) []Point {
 	for openSet.Cardinality() > 0 {
 		count = count + 1
 		if count > 3000 {
-			fmt.Println("TOOOOOOOOOO many try times Astar failed")
-			err = errors.New("Had tried too many times, there may be some logic error in your code!")
+			err = ErrTooManyTries
 			break
 		}
 
@@ -166,20 +180,19 @@ func AstarByStartAndGoalPoint(m Map, start Point, goal Point) []Point {
 		} //end for
 	}
 
-	if err != nil {
-		fmt.Println(err)
-	} else {
-		//fmt.Println("path: ", path)
+	searchExpansions.Observe(float64(count))
+	searchSeconds.Observe(time.Since(startedAt).Seconds())
+	if len(path) == 0 {
+		searchNoPath.Inc()
 	}
-
 	//reverse
 	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
 		path[i], path[j] = path[j], path[i]
 	}
-	return path
+	return path, err
 }
 
-func AstarByMap(m Map) []Point {
+func AstarByMap(m Map) ([]Point, error) {
 	start, _ := findPoint(m, START)
 	goal, _ := findPoint(m, GOAL)
 	return AstarByStartAndGoalPoint(m, start, goal)
@@ -199,7 +212,6 @@ func PrintMap(m Map) {
 		}
 		fmt.Println()
 	}
-	m[0][0] = 99
 }
 
 func PrintArray(array []int, width int, height int) {
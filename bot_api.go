@@ -0,0 +1,445 @@
+package main
+
+import (
+	"AI/config"
+	"AI/constants"
+	"AI/logging"
+	"AI/models"
+	"AI/telemetry"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RET_OK     = 1000
+	RET_FAILED = 1001
+)
+
+//bot server进程内各个请求共享的状态
+type botServer struct {
+	config    *config.Config
+	shards    []*shard
+	registry  *botRegistry
+	telemetry *telemetry.Hub
+	startedAt time.Time
+
+	//进程退出时取消, 所有bot随之断开
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	spawnMutex sync.Mutex
+	draining   bool           //开始退出后不再接受spawn
+	spawns     sync.WaitGroup //每个spawnBot goroutine一个
+
+	loadTestMutex sync.Mutex
+	loadTest      *loadTestRun //最近一次压测, 结束后仍保留以便查询报告
+}
+
+type runningBot struct {
+	shard  *shard
+	lease  *models.BotLease
+	client *Client
+}
+
+//已经连上游戏服务器的bot, 以botName为key
+type botRegistry struct {
+	mutex sync.Mutex
+	bots  map[string]*runningBot
+}
+
+func newBotRegistry() *botRegistry {
+	return &botRegistry{
+		bots: make(map[string]*runningBot),
+	}
+}
+
+func (r *botRegistry) add(s *shard, lease *models.BotLease, client *Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.bots[lease.BotName] = &runningBot{
+		shard:  s,
+		lease:  lease,
+		client: client,
+	}
+}
+
+//只移除属于该lease的记录, 同名bot可能已被强制回收并重新分配
+func (r *botRegistry) remove(lease *models.BotLease) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if bot, ok := r.bots[lease.BotName]; ok && bot.lease.LeaseId == lease.LeaseId {
+		delete(r.bots, lease.BotName)
+	}
+}
+
+func (r *botRegistry) get(botName string) (*runningBot, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	bot, ok := r.bots[botName]
+	return bot, ok
+}
+
+func (r *botRegistry) all() []*runningBot {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	bots := make([]*runningBot, 0, len(r.bots))
+	for _, bot := range r.bots {
+		bots = append(bots, bot)
+	}
+	return bots
+}
+
+type botInfo struct {
+	BotName   string        `json:"botName"`
+	Shard     string        `json:"shard"`
+	LeaseId   int64         `json:"leaseId"`
+	Tags      []string      `json:"tags"`
+	StartedAt int64         `json:"startedAt"`
+	Deadline  int64         `json:"deadline"`
+	Connected bool          `json:"connected"`
+	Status    *ClientStatus `json:"status,omitempty"`
+}
+
+func (server *botServer) registerApi(r *gin.Engine) {
+	r.GET("/spawnBot", server.handleSpawnBot)
+	r.GET("/spawnBots", server.handleSpawnBots)
+	r.GET("/bots", server.handleListBots)
+	r.GET("/stopBot", server.handleStopBot)
+	r.GET("/capacity", server.handleCapacity)
+	r.GET("/shards", server.handleListShards)
+	r.GET("/botTelemetry", server.handleBotTelemetry)
+	r.GET("/roomTelemetry", server.handleRoomTelemetry)
+	r.GET("/loadTest/start", server.handleStartLoadTest)
+	r.GET("/loadTest/status", server.handleLoadTestStatus)
+	r.GET("/loadTest/stop", server.handleStopLoadTest)
+	r.GET("/metrics", server.handleMetrics)
+	r.GET("/healthz", server.handleHealthz)
+}
+
+func (server *botServer) parseSpawnBotOptions(c *gin.Context, s *shard) spawnBotOptions {
+	options := spawnBotOptions{
+		UpsyncEncoding: c.DefaultQuery("upsyncEncoding", s.config.UpsyncEncoding),
+		UpsyncRate:     server.config.Tick.UpsyncRate,
+		Ai:             server.config.Ai,
+		Record:         server.config.Replay.Record,
+		Lifetime:       server.config.Bot.Lifetime,
+	}
+	if options.UpsyncEncoding != constants.UPSYNC_ENCODING_PB {
+		options.UpsyncEncoding = constants.UPSYNC_ENCODING_JSON
+	}
+	if upsyncRate, err := strconv.Atoi(c.Query("upsyncRate")); err == nil && upsyncRate > 0 && upsyncRate <= server.config.Tick.MaxUpsyncRate {
+		options.UpsyncRate = upsyncRate
+	}
+	if record, err := strconv.ParseBool(c.Query("record")); err == nil {
+		options.Record = record
+	}
+	return options
+}
+
+func (server *botServer) handleSpawnBot(c *gin.Context) {
+	expectedRoomId, err := strconv.Atoi(c.Query("expectedRoomId"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "请求中没有或者转换expectedRoomId出错",
+		})
+		return
+	}
+	s, err := findShard(server.shards, c.Query("shard"), expectedRoomId)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": err.Error(),
+		})
+		return
+	}
+	if err := server.beginSpawn(1); err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": err.Error(),
+		})
+		return
+	}
+	options := server.parseSpawnBotOptions(c, s)
+	lease, err := s.botManager.AcquireBot(expectedRoomId, c.Query("tag"), server.config.Bot.LeaseTimeout)
+	if err != nil {
+		zap.L().Warn("Acquire bot", logging.Shard(s.config.Name), zap.Int("expectedRoomId", expectedRoomId), zap.Error(err))
+		server.spawns.Done()
+		c.JSON(200, gin.H{
+			"ret":     RET_FAILED,
+			"botName": "获取空闲bot出错: " + err.Error(),
+		})
+		return
+	}
+	go server.spawnBot(server.ctx, s, lease, options)
+	zap.L().Info("Spawning bot", logging.Bot(lease.BotName), logging.Shard(s.config.Name), zap.Int("expectedRoomId", expectedRoomId), zap.Int64("leaseId", lease.LeaseId))
+	c.JSON(200, gin.H{
+		"ret":      RET_OK,
+		"botName":  lease.BotName,
+		"shard":    s.config.Name,
+		"leaseId":  lease.LeaseId,
+		"deadline": lease.Deadline.Unix(),
+	})
+}
+
+//一次把count个bot放进同一个房间, 空闲bot不足时一个都不派出
+func (server *botServer) handleSpawnBots(c *gin.Context) {
+	expectedRoomId, err := strconv.Atoi(c.Query("expectedRoomId"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "请求中没有或者转换expectedRoomId出错",
+		})
+		return
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count <= 0 {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "请求中没有或者转换count出错",
+		})
+		return
+	}
+	s, err := findShard(server.shards, c.Query("shard"), expectedRoomId)
+	if err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": err.Error(),
+		})
+		return
+	}
+	if err := server.beginSpawn(count); err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": err.Error(),
+		})
+		return
+	}
+	options := server.parseSpawnBotOptions(c, s)
+	leases := make([]*models.BotLease, 0, count)
+	for len(leases) < count {
+		lease, err := s.botManager.AcquireBot(expectedRoomId, c.Query("tag"), server.config.Bot.LeaseTimeout)
+		if err != nil {
+			for _, acquired := range leases {
+				s.botManager.ReleaseBot(acquired)
+			}
+			server.spawns.Add(-count)
+			c.JSON(200, gin.H{
+				"ret": RET_FAILED,
+				"err": fmt.Sprintf("获取%d个空闲bot出错, 只有%d个: %v", count, len(leases), err),
+			})
+			return
+		}
+		leases = append(leases, lease)
+	}
+	botNames := make([]string, len(leases))
+	for i, lease := range leases {
+		botNames[i] = lease.BotName
+		go server.spawnBot(server.ctx, s, lease, options)
+	}
+	zap.L().Info("Spawning bots", zap.Strings("bots", botNames), logging.Shard(s.config.Name), zap.Int("expectedRoomId", expectedRoomId))
+	c.JSON(200, gin.H{
+		"ret":      RET_OK,
+		"botNames": botNames,
+		"shard":    s.config.Name,
+	})
+}
+
+func (server *botServer) handleListBots(c *gin.Context) {
+	var leases []models.BotLease
+	var shardNames []string
+	for _, s := range server.shards {
+		if name := c.Query("shard"); name != "" && name != s.config.Name {
+			continue
+		}
+		for _, lease := range s.botManager.Leases() {
+			leases = append(leases, lease)
+			shardNames = append(shardNames, s.config.Name)
+		}
+	}
+	bots := make([]botInfo, len(leases))
+	for i, lease := range leases {
+		bots[i] = botInfo{
+			BotName:   lease.BotName,
+			Shard:     shardNames[i],
+			LeaseId:   lease.LeaseId,
+			Tags:      lease.Account.Tags,
+			StartedAt: lease.StartedAt.Unix(),
+			Deadline:  lease.Deadline.Unix(),
+		}
+		if running, ok := server.registry.get(lease.BotName); ok && running.lease.LeaseId == lease.LeaseId {
+			status := running.client.Status()
+			bots[i].Connected = true
+			bots[i].Status = &status
+		}
+	}
+	sort.Slice(bots, func(i, j int) bool {
+		return bots[i].BotName < bots[j].BotName
+	})
+	c.JSON(200, gin.H{
+		"ret":  RET_OK,
+		"bots": bots,
+	})
+}
+
+func (server *botServer) handleStopBot(c *gin.Context) {
+	botName := c.Query("botName")
+	running, ok := server.registry.get(botName)
+	if !ok {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "bot " + botName + " 没有在运行",
+		})
+		return
+	}
+	running.client.Stop()
+	c.JSON(200, gin.H{
+		"ret":     RET_OK,
+		"botName": botName,
+		"leaseId": running.lease.LeaseId,
+	})
+}
+
+type shardCapacity struct {
+	Total     int `json:"total"`
+	Busy      int `json:"busy"`
+	Idle      int `json:"idle"`
+	Connected int `json:"connected"`
+}
+
+//总数以及每个分片的bot数量
+func (server *botServer) handleCapacity(c *gin.Context) {
+	shards := make(map[string]*shardCapacity)
+	var total shardCapacity
+	for _, s := range server.shards {
+		busy, idle := s.botManager.Stats()
+		shards[s.config.Name] = &shardCapacity{
+			Total: busy + idle,
+			Busy:  busy,
+			Idle:  idle,
+		}
+		total.Busy += busy
+		total.Idle += idle
+	}
+	for _, running := range server.registry.all() {
+		shards[running.shard.config.Name].Connected++
+		total.Connected++
+	}
+	c.JSON(200, gin.H{
+		"ret":       RET_OK,
+		"total":     total.Busy + total.Idle,
+		"busy":      total.Busy,
+		"idle":      total.Idle,
+		"connected": total.Connected,
+		"draining":  server.isDraining(),
+		"shards":    shards,
+		"at":        time.Now().Unix(),
+	})
+}
+
+//供check_daemon.sh和负载均衡探活, 开始退出后返回503
+func (server *botServer) handleHealthz(c *gin.Context) {
+	status, ret := 200, RET_OK
+	if server.isDraining() {
+		status, ret = 503, RET_FAILED
+	}
+	idle := 0
+	for _, s := range server.shards {
+		_, shardIdle := s.botManager.Stats()
+		idle += shardIdle
+	}
+	c.JSON(status, gin.H{
+		"ret":       ret,
+		"pid":       os.Getpid(),
+		"uptime":    time.Since(server.startedAt).Round(time.Second).String(),
+		"connected": len(server.registry.all()),
+		"idle":      idle,
+		"draining":  server.isDraining(),
+	})
+}
+
+type shardInfo struct {
+	Name           string `json:"name"`
+	BaseUrl        string `json:"baseUrl"`
+	WsPath         string `json:"wsPath"`
+	MinRoomId      int    `json:"minRoomId"`
+	MaxRoomId      int    `json:"maxRoomId"`
+	BotPoolPath    string `json:"botPoolPath"`
+	UpsyncEncoding string `json:"upsyncEncoding"`
+}
+
+func (server *botServer) handleListShards(c *gin.Context) {
+	shards := make([]shardInfo, len(server.shards))
+	for i, s := range server.shards {
+		shards[i] = shardInfo{
+			Name:           s.config.Name,
+			BaseUrl:        s.config.GameServer.BaseUrl(),
+			WsPath:         s.config.GameServer.WsPath,
+			MinRoomId:      s.config.MinRoomId,
+			MaxRoomId:      s.config.MaxRoomId,
+			BotPoolPath:    s.config.BotPoolPath,
+			UpsyncEncoding: s.config.UpsyncEncoding,
+		}
+	}
+	c.JSON(200, gin.H{
+		"ret":    RET_OK,
+		"shards": shards,
+	})
+}
+
+//以Server-Sent Events推送某个bot的telemetry.Event, 事件名为Event.Kind
+func (server *botServer) handleBotTelemetry(c *gin.Context) {
+	botName := c.Query("botName")
+	if botName == "" {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "请求中没有botName",
+		})
+		return
+	}
+	server.streamTelemetry(c, func(e telemetry.Event) bool {
+		return e.BotName == botName
+	})
+}
+
+//以Server-Sent Events推送某个房间中所有bot的telemetry.Event
+func (server *botServer) handleRoomTelemetry(c *gin.Context) {
+	roomId, err := strconv.Atoi(c.Query("roomId"))
+	if err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "请求中没有或者转换roomId出错",
+		})
+		return
+	}
+	server.streamTelemetry(c, func(e telemetry.Event) bool {
+		return e.RoomId == roomId
+	})
+}
+
+func (server *botServer) streamTelemetry(c *gin.Context, filter func(telemetry.Event) bool) {
+	subscriber := server.telemetry.Subscribe(filter)
+	defer server.telemetry.Unsubscribe(subscriber)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-subscriber.C:
+			c.SSEvent(e.Kind, e)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-server.ctx.Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"AI/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+//run结束的原因, 即ai_bot_disconnects_total的reason标签
+const (
+	DISCONNECT_LIFETIME      = "lifetime"      //寿命到期
+	DISCONNECT_CANCELLED     = "cancelled"     //进程退出或压测停止
+	DISCONNECT_LEASE_EXPIRED = "lease_expired" //lease超时被回收
+	DISCONNECT_STOPPED       = "stopped"       ///stopBot
+	DISCONNECT_SERVER        = "server"        //服务器断开或读取出错
+	DISCONNECT_UPSYNC        = "upsync"        //上行goroutine异常退出
+)
+
+//A*的指标见astar包
+var (
+	botSpawns          = metrics.NewCounter("ai_bot_spawns_total", "Bots that started logging in.")
+	botLoginFailures   = metrics.NewCounter("ai_bot_login_failures_total", "Bots that failed to log in.")
+	botDialFailures    = metrics.NewCounter("ai_bot_dial_failures_total", "Bots that failed to open the websocket.")
+	botDisconnects     = metrics.NewCounterVec("ai_bot_disconnects_total", "Websocket connections closed, by reason.", "reason")
+	activeBots         = metrics.NewGauge("ai_bot_active", "Bots currently connected to a game server.")
+	downsyncFrames     = metrics.NewCounter("ai_bot_downsync_frames_total", "RoomDownsyncFrames received.")
+	decodeErrors       = metrics.NewCounterVec("ai_bot_decode_errors_total", "Downsync messages that failed to decode, by message.", "message")
+	replans            = metrics.NewCounter("ai_bot_replans_total", "Paths recomputed to a new target treasure.")
+	stuckDetections    = metrics.NewCounter("ai_bot_stuck_detections_total", "Times a bot stayed still for more than ai.stuckFrames ticks.")
+	treasuresCollected = metrics.NewCounter("ai_bot_treasures_collected_total", "Treasures collected by bots, each score increase attributed to the nearest treasures removed in the same frame.")
+)
+
+func (server *botServer) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.CONTENT_TYPE)
+	c.Status(200)
+	metrics.Default.WriteText(c.Writer)
+}
@@ -3,12 +3,14 @@
 basedir=$( cd "$( dirname "${BASH_SOURCE[0]}" )" && pwd )
 
 PID_FILE="$basedir/treasure-hunter-x-bot-server.pid"
+PORT=${PORT:-15351}
 if [ -f $PID_FILE ]; then
   pid=$( cat "$PID_FILE" )
   if [ -z $pid ]; then
     echo "There's no pid stored in $PID_FILE."
   else 
-    ps aux | grep "$pid"
+    curl -fsS "http://localhost:$PORT/healthz" || exit 1
+    echo
   fi
 else 
   echo "There's no PidFile $PID_FILE."
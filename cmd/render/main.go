@@ -0,0 +1,96 @@
+//渲染文本格式的碰撞地图, 给定起点和终点时叠加A*寻路的结果.
+//
+//	go run ./cmd/render -map collide.txt -start 0,0 -goal 7,7 -png out.png
+package main
+
+import (
+	"AI/astar"
+	"AI/render"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+func parsePoint(s string) (*astar.Point, error) {
+	if s == "" {
+		return nil, nil
+	}
+	pt := new(astar.Point)
+	if _, err := fmt.Sscanf(s, "%d,%d", &pt.X, &pt.Y); err != nil {
+		return nil, fmt.Errorf("invalid point %q, expected \"x,y\"", s)
+	}
+	return pt, nil
+}
+
+func main() {
+	mapPath := flag.String("map", "", "text collide map, \"-\" or empty for stdin")
+	startArg := flag.String("start", "", "start point \"x,y\", overrides 'S' in the map")
+	goalArg := flag.String("goal", "", "goal point \"x,y\", overrides 'G' in the map")
+	treasuresArg := flag.String("treasures", "", "treasure points \"x,y;x,y\"")
+	pngPath := flag.String("png", "", "write a PNG image instead of ASCII")
+	cellSize := flag.Int("cell", 8, "pixels per tile of the PNG image")
+	flag.Parse()
+
+	var input io.Reader = os.Stdin
+	if *mapPath != "" && *mapPath != "-" {
+		f, err := os.Open(*mapPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		input = f
+	}
+	m, start, goal, err := render.ParseGrid(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	overlay := render.Overlay{
+		Start: start,
+		Goal:  goal,
+	}
+	if pt, err := parsePoint(*startArg); err != nil {
+		log.Fatal(err)
+	} else if pt != nil {
+		overlay.Start = pt
+	}
+	if pt, err := parsePoint(*goalArg); err != nil {
+		log.Fatal(err)
+	} else if pt != nil {
+		overlay.Goal = pt
+	}
+	if *treasuresArg != "" {
+		for _, s := range strings.Split(*treasuresArg, ";") {
+			pt, err := parsePoint(s)
+			if err != nil {
+				log.Fatal(err)
+			}
+			overlay.Treasures = append(overlay.Treasures, *pt)
+		}
+	}
+	if overlay.Start != nil && overlay.Goal != nil {
+		var err error
+		overlay.Path, err = astar.AstarByStartAndGoalPoint(m, *overlay.Start, *overlay.Goal)
+		if err != nil {
+			log.Println(err)
+		} else if len(overlay.Path) == 0 {
+			log.Println("There is no path to the goal")
+		}
+	}
+
+	if *pngPath == "" {
+		fmt.Print(render.ASCII(m, overlay))
+		return
+	}
+	f, err := os.Create(*pngPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := render.PNG(f, m, overlay, *cellSize); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+//逐条打印bot录像的内容, 用于排查问题.
+//
+//	go run ./cmd/replaydump -replay replays/bot1-10-20190501-120000.000.replay
+package main
+
+import (
+	"AI/replay"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+func dump(out io.Writer, meta replay.Meta, records []*replay.Record) error {
+	fmt.Fprintf(out, "bot %s, player %d, started at %s, upsync %d/s %s, ai %+v\n",
+		meta.BotName, meta.PlayerId, meta.StartedAt.Format("2006-01-02 15:04:05.000"), meta.UpsyncRate, meta.UpsyncEncoding, meta.Ai)
+	for _, record := range records {
+		at := float64(record.At) / 1e9
+		switch record.Kind {
+		case replay.KIND_BATTLE_COLLIDER_INFO:
+			roomId, info, err := record.BattleColliderInfo()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%9.3f collider room %d, stage %s %dx%d\n", at, roomId, info.StageName, info.StageDiscreteW, info.StageDiscreteH)
+		case replay.KIND_DOWNSYNC_FRAME:
+			frame, err := record.DownsyncFrame()
+			if err != nil {
+				return err
+			}
+			self := frame.Players[meta.PlayerId]
+			if self == nil {
+				fmt.Fprintf(out, "%9.3f downsync %d ref %d, %d treasures\n", at, frame.Id, frame.RefFrameId, len(frame.Treasures))
+			} else {
+				fmt.Fprintf(out, "%9.3f downsync %d ref %d, %d treasures, self (%.2f, %.2f) score %d\n", at, frame.Id, frame.RefFrameId, len(frame.Treasures), self.X, self.Y, self.Score)
+			}
+		case replay.KIND_UPSYNC:
+			dt, cmd, err := record.Upsync()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%9.3f upsync dt %.4f (%.2f, %.2f) acking %d\n", at, dt, cmd.X, cmd.Y, cmd.AckingFrameId)
+		default:
+			fmt.Fprintf(out, "%9.3f unknown kind %d, %d bytes\n", at, record.Kind, len(record.Data))
+		}
+	}
+	return nil
+}
+
+func main() {
+	path := flag.String("replay", "", "replay file written by a bot")
+	flag.Parse()
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	meta, records, err := replay.ReadFile(*path)
+	if err == io.ErrUnexpectedEOF {
+		log.Printf("%s is truncated, dumping %d complete records", *path, len(records))
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	if err := dump(os.Stdout, meta, records); err != nil {
+		log.Fatal(err)
+	}
+}
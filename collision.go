@@ -0,0 +1,164 @@
+package main
+
+import (
+	"AI/models"
+	pb "AI/pb_output"
+
+	"github.com/ByteArena/box2d"
+	"go.uber.org/zap"
+)
+
+const (
+	PLAYER_COLLIDER_RADIUS = 12 //与后端以及models.ComputeColliderMapByCollision2dNeo一致
+	BARRIER_POLYGON_KEY    = "Barrier"
+
+	//推出障碍物时多留出的距离, 避免下一个tick仍然接触
+	wallClippingSlop = 0.5
+	//夹在两个障碍物之间时每个tick最多推出的次数
+	maxWallClippingCorrections = 4
+)
+
+//box2d在第一次创建contact时才初始化全局的contact注册表, 且没有加锁, 多个bot同时初始化会产生data race.
+//启动时先让两个重叠的圆产生一次contact, 之后各bot的world只读取注册表
+func init() {
+	world := box2d.MakeB2World(box2d.MakeB2Vec2(0, 0))
+	for _, bodyType := range []uint8{box2d.B2BodyType.B2_staticBody, box2d.B2BodyType.B2_dynamicBody} {
+		bodyDef := box2d.MakeB2BodyDef()
+		bodyDef.Type = bodyType
+		shape := box2d.MakeB2CircleShape()
+		shape.M_radius = 1
+		fixtureDef := box2d.MakeB2FixtureDef()
+		fixtureDef.Shape = &shape
+		world.CreateBody(&bodyDef).CreateFixtureFromDef(&fixtureDef)
+	}
+	world.M_contactManager.FindNewContacts()
+}
+
+//相邻顶点过近时box2d会panic, 去掉重复的顶点以及与第一个顶点重合的最后一个顶点
+func barrierVertices(polygon *pb.Polygon2D) []box2d.B2Vec2 {
+	minDistanceSquared := box2d.B2_linearSlop * box2d.B2_linearSlop * 4
+	var vertices []box2d.B2Vec2
+	for _, pt := range polygon.Points {
+		vertex := box2d.MakeB2Vec2(pt.X, pt.Y)
+		if len(vertices) > 0 && box2d.B2Vec2DistanceSquared(vertices[len(vertices)-1], vertex) <= minDistanceSquared {
+			continue
+		}
+		vertices = append(vertices, vertex)
+	}
+	for len(vertices) > 1 && box2d.B2Vec2DistanceSquared(vertices[0], vertices[len(vertices)-1]) <= minDistanceSquared {
+		vertices = vertices[:len(vertices)-1]
+	}
+	return vertices
+}
+
+//障碍物为静态的chain loop(多边形可能是凹的或超过8个顶点), 玩家为动态的圆, 只用于检测接触, 从不调用Solve
+func (client *Client) initCollidableWorld(battleColliderInfo *pb.BattleColliderInfo) {
+	world := box2d.MakeB2World(box2d.MakeB2Vec2(0, 0))
+	client.CollidableWorld = &world
+	client.Barrier = make(map[int32]*models.Barrier)
+
+	for index, polygon := range battleColliderInfo.StrToPolygon2DListMap[BARRIER_POLYGON_KEY].GetPolygon2DList() {
+		vertices := barrierVertices(polygon)
+		if polygon.Anchor == nil || len(vertices) < 3 {
+			continue
+		}
+		bodyDef := box2d.MakeB2BodyDef()
+		bodyDef.Type = box2d.B2BodyType.B2_staticBody
+		bodyDef.Position = box2d.MakeB2Vec2(polygon.Anchor.X, polygon.Anchor.Y)
+		body := client.CollidableWorld.CreateBody(&bodyDef)
+
+		shape := box2d.MakeB2ChainShape()
+		shape.CreateLoop(vertices, len(vertices))
+		fixtureDef := box2d.MakeB2FixtureDef()
+		fixtureDef.Shape = &shape
+		fixtureDef.Filter.CategoryBits = COLLISION_CATEGORY_BARRIER
+		fixtureDef.Filter.MaskBits = COLLISION_MASK_FOR_BARRIER
+		body.CreateFixtureFromDef(&fixtureDef)
+
+		boundary := &models.Polygon2D{
+			Anchor: &models.Vec2D{X: polygon.Anchor.X, Y: polygon.Anchor.Y},
+		}
+		for _, vertex := range vertices {
+			boundary.Points = append(boundary.Points, models.CreateVec2DFromB2Vec2(vertex))
+		}
+		id := int32(index + 1)
+		client.Barrier[id] = &models.Barrier{
+			X:              polygon.Anchor.X,
+			Y:              polygon.Anchor.Y,
+			Boundary:       boundary,
+			CollidableBody: body,
+		}
+	}
+
+	bodyDef := box2d.MakeB2BodyDef()
+	bodyDef.Type = box2d.B2BodyType.B2_dynamicBody
+	bodyDef.AllowSleep = false //睡眠的body不会更新contact
+	bodyDef.Position = box2d.MakeB2Vec2(client.Player.X, client.Player.Y)
+	client.PlayerCollidableBody = client.CollidableWorld.CreateBody(&bodyDef)
+	shape := box2d.MakeB2CircleShape()
+	shape.M_radius = PLAYER_COLLIDER_RADIUS
+	fixtureDef := box2d.MakeB2FixtureDef()
+	fixtureDef.Shape = &shape
+	fixtureDef.Filter.CategoryBits = COLLISION_CATEGORY_CONTROLLED_PLAYER
+	fixtureDef.Filter.MaskBits = COLLISION_MASK_FOR_CONTROLLED_PLAYER
+	client.PlayerCollidableBody.CreateFixtureFromDef(&fixtureDef)
+}
+
+//把玩家碰撞体移到当前坐标, 返回与障碍物最深的重叠需要沿哪个方向推出多远
+func (client *Client) barrierPenetration() (push models.Vec2D, ok bool) {
+	body := client.PlayerCollidableBody
+	pos := box2d.MakeB2Vec2(client.Player.X, client.Player.Y)
+	models.MoveDynamicBody(body, &pos, 0)
+	//SetTransform只更新了broad phase, 不Step直接找出新的contact并计算manifold
+	client.CollidableWorld.M_contactManager.FindNewContacts()
+	client.CollidableWorld.M_contactManager.Collide()
+
+	deepest := 0.0
+	for edge := body.GetContactList(); edge != nil; edge = edge.Next {
+		contact := edge.Contact
+		if !contact.IsTouching() {
+			continue
+		}
+		worldManifold := box2d.MakeB2WorldManifold()
+		contact.GetWorldManifold(&worldManifold)
+		//Normal由A指向B, 统一为由障碍物指向玩家
+		normal := worldManifold.Normal
+		if contact.GetFixtureA().GetBody() == body {
+			normal = normal.OperatorNegate()
+		}
+		for i := 0; i < contact.GetManifold().PointCount; i++ {
+			if depth := -worldManifold.Separations[i]; depth > deepest {
+				deepest = depth
+				push = models.Vec2D{
+					X: normal.X * (depth + wallClippingSlop),
+					Y: normal.Y * (depth + wallClippingSlop),
+				}
+			}
+		}
+	}
+	return push, deepest > 0
+}
+
+//上行前用本地碰撞检测修正穿墙: 玩家与障碍物重叠时沿法线推出, 以免上行服务器会拒绝或回拉的坐标
+func (client *Client) correctWallClipping() bool {
+	if client.PlayerCollidableBody == nil || client.BattleState != IN_BATTLE {
+		return false
+	}
+	corrected := false
+	for i := 0; i < maxWallClippingCorrections; i++ {
+		push, ok := client.barrierPenetration()
+		if !ok {
+			break
+		}
+		client.Player.X += push.X
+		client.Player.Y += push.Y
+		corrected = true
+	}
+	if !corrected {
+		return false
+	}
+	client.WallClippings++
+	client.tickLogger().Debug("Corrected wall clipping", zap.Float64("x", client.Player.X), zap.Float64("y", client.Player.Y))
+	client.pathFinding.SetCurrentCoord(client.Player.X, client.Player.Y)
+	return true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"AI/models"
+	pb "AI/pb_output"
+	"math"
+	"testing"
+)
+
+//(0,0)到(100,100)的正方形障碍物, 首尾重复的顶点和重复的相邻顶点应被忽略
+func newCollisionTestClient(x, y float64) *Client {
+	client := newClient(nil, 1, spawnBotOptions{})
+	client.BattleState = IN_BATTLE
+	client.Player.X = x
+	client.Player.Y = y
+	client.initCollidableWorld(&pb.BattleColliderInfo{
+		StrToPolygon2DListMap: map[string]*pb.Polygon2DList{
+			BARRIER_POLYGON_KEY: {Polygon2DList: []*pb.Polygon2D{{
+				Anchor: &pb.Vec2D{X: 0, Y: 0},
+				Points: []*pb.Vec2D{{X: 0, Y: 0}, {X: 100, Y: 0}, {X: 100, Y: 0}, {X: 100, Y: 100}, {X: 0, Y: 100}, {X: 0, Y: 0}},
+			}}},
+		},
+	})
+	return client
+}
+
+func TestCorrectWallClipping(t *testing.T) {
+	client := newCollisionTestClient(105, 50)
+	if len(client.Barrier) != 1 || len(client.Barrier[1].Boundary.Points) != 4 {
+		t.Fatalf("unexpected barriers %v", client.Barrier)
+	}
+	if !client.correctWallClipping() {
+		t.Fatal("expected the overlap with the right edge to be corrected")
+	}
+	if client.Player.X < 100+PLAYER_COLLIDER_RADIUS || client.Player.X > 100+PLAYER_COLLIDER_RADIUS+1 || math.Abs(client.Player.Y-50) > 1e-6 {
+		t.Errorf("expected to be pushed right out of the barrier, got (%.2f, %.2f)", client.Player.X, client.Player.Y)
+	}
+	if client.pathFinding.CurrentCoord.X != client.Player.X || client.WallClippings != 1 {
+		t.Errorf("path finding was not moved with the player")
+	}
+
+	//推出后不再接触
+	if client.correctWallClipping() {
+		t.Errorf("expected no more corrections at (%.2f, %.2f)", client.Player.X, client.Player.Y)
+	}
+}
+
+func TestCorrectWallClippingAtCorner(t *testing.T) {
+	client := newCollisionTestClient(-5, 105)
+	if !client.correctWallClipping() {
+		t.Fatal("expected the overlap with the corner to be corrected")
+	}
+	corner := models.Vec2D{X: 0, Y: 100}
+	if d := models.Distance(&corner, &models.Vec2D{X: client.Player.X, Y: client.Player.Y}); d < PLAYER_COLLIDER_RADIUS {
+		t.Errorf("still %.2f away from the corner", d)
+	}
+}
+
+func TestCorrectWallClippingLeavesFreePlayers(t *testing.T) {
+	client := newCollisionTestClient(150, 50)
+	if client.correctWallClipping() || client.Player.X != 150 || client.Player.Y != 50 {
+		t.Errorf("expected no correction, got (%.2f, %.2f)", client.Player.X, client.Player.Y)
+	}
+	//战斗开始前不修正
+	client = newCollisionTestClient(105, 50)
+	client.BattleState = WAITING
+	if client.correctWallClipping() {
+		t.Errorf("expected no correction before the battle starts")
+	}
+}
@@ -0,0 +1,444 @@
+package config
+
+import (
+	"AI/constants"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SERVER_ENV_TEST = "TEST"
+	SERVER_ENV_PROD = "PROD"
+)
+
+//覆盖配置项的环境变量都以此为前缀, 如AI_GAME_SERVER_HOST
+const ENV_PREFIX = "AI_"
+
+type GameServerConfig struct {
+	Protocol string `yaml:"protocol" env:"GAME_SERVER_PROTOCOL"`
+	Host     string `yaml:"host" env:"GAME_SERVER_HOST"`
+	Port     int    `yaml:"port" env:"GAME_SERVER_PORT"`
+	WsPath   string `yaml:"wsPath" env:"GAME_SERVER_WS_PATH"`
+}
+
+func (g GameServerConfig) NetConf() constants.NetConf {
+	return constants.NetConf{
+		PROTOCOL: g.Protocol,
+		HOST:     g.Host,
+		PORT:     fmt.Sprintf(":%d", g.Port),
+	}
+}
+
+//登录等HTTP接口的地址, 形如"http://localhost:9992"
+func (g GameServerConfig) BaseUrl() string {
+	return fmt.Sprintf("%s://%s:%d", g.Protocol, g.Host, g.Port)
+}
+
+func (g GameServerConfig) WsScheme() string {
+	if g.Protocol == "https" {
+		return "wss"
+	}
+	return "ws"
+}
+
+//一个游戏服务器分片, 有自己的登录和websocket地址以及bot池
+type ShardConfig struct {
+	Name string `yaml:"name"`
+	//省略的字段取顶层gameServer的值
+	GameServer  GameServerConfig `yaml:"gameServer"`
+	BotPoolPath string           `yaml:"botPoolPath"` //省略时取bot.poolPath
+	//省略时取tick.upsyncEncoding, 游戏服务器能解析二进制帧后再设为pb
+	UpsyncEncoding string `yaml:"upsyncEncoding"`
+	//[MinRoomId, MaxRoomId]内的房间属于该分片, 用于/spawnBot没有指定shard时推断. MaxRoomId为0时没有上限, 两者都为0时不参与推断
+	MinRoomId int `yaml:"minRoomId"`
+	MaxRoomId int `yaml:"maxRoomId"`
+}
+
+func (s ShardConfig) HasRoomRange() bool {
+	return s.MinRoomId != 0 || s.MaxRoomId != 0
+}
+
+func (s ShardConfig) ContainsRoom(roomId int) bool {
+	return s.HasRoomRange() && roomId >= s.MinRoomId && (s.MaxRoomId == 0 || roomId <= s.MaxRoomId)
+}
+
+type ShutdownConfig struct {
+	Deadline     time.Duration `yaml:"deadline" env:"SHUTDOWN_DEADLINE"`          //等待bot正常断开的最长时间, 之后强制关闭连接
+	HttpDeadline time.Duration `yaml:"httpDeadline" env:"SHUTDOWN_HTTP_DEADLINE"` //之后等待http请求处理完的最长时间
+}
+
+type ListenConfig struct {
+	Port int `yaml:"port" env:"LISTEN_PORT"`
+}
+
+type BotConfig struct {
+	PoolPath     string        `yaml:"poolPath" env:"BOT_POOL_PATH"` //见models.BotPoolConfig, SIGHUP时重新加载
+	Lifetime     time.Duration `yaml:"lifetime" env:"BOT_LIFETIME"`
+	LeaseTimeout time.Duration `yaml:"leaseTimeout" env:"BOT_LEASE_TIMEOUT"`
+	ReapInterval time.Duration `yaml:"reapInterval" env:"BOT_REAP_INTERVAL"`
+}
+
+type TickConfig struct {
+	UpsyncRate     int    `yaml:"upsyncRate" env:"UPSYNC_RATE"`
+	MaxUpsyncRate  int    `yaml:"maxUpsyncRate" env:"MAX_UPSYNC_RATE"`
+	UpsyncEncoding string `yaml:"upsyncEncoding" env:"UPSYNC_ENCODING"`
+}
+
+type LoginConfig struct {
+	MaxAttempts int           `yaml:"maxAttempts" env:"LOGIN_MAX_ATTEMPTS"`
+	Backoff     time.Duration `yaml:"backoff" env:"LOGIN_BACKOFF"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff" env:"LOGIN_MAX_BACKOFF"`
+	HttpTimeout time.Duration `yaml:"httpTimeout" env:"LOGIN_HTTP_TIMEOUT"`
+}
+
+type AiConfig struct {
+	//服务器坐标与对应的上行坐标的偏差超过PositionReconcileTolerance时进行校正: 偏差不超过PositionSnapTolerance时按PositionBlendFactor插值, 否则直接瞬移并重新寻路
+	PositionReconcileTolerance float64 `yaml:"positionReconcileTolerance" env:"POSITION_RECONCILE_TOLERANCE"`
+	PositionSnapTolerance      float64 `yaml:"positionSnapTolerance" env:"POSITION_SNAP_TOLERANCE"`
+	PositionBlendFactor        float64 `yaml:"positionBlendFactor" env:"POSITION_BLEND_FACTOR"`
+	//连续这么多帧没有移动时视为卡住, 重新寻路
+	StuckFrames int `yaml:"stuckFrames" env:"STUCK_FRAMES"`
+}
+
+//录像写入Dir, 每个bot一个文件, 见replay包. Record为默认值, 可由"/spawnBot?record="覆盖
+type ReplayConfig struct {
+	Dir    string `yaml:"dir" env:"REPLAY_DIR"`
+	Record bool   `yaml:"record" env:"REPLAY_RECORD"`
+}
+
+const (
+	LOG_FORMAT_CONSOLE = "console"
+	LOG_FORMAT_JSON    = "json"
+)
+
+var LOG_LEVELS = []string{"debug", "info", "warn", "error"}
+
+//Output为stdout, stderr或文件路径, 为文件时按MaxSizeMb和RotateInterval轮转, 见logfile包. 两者都为0时不轮转
+type LogConfig struct {
+	Level          string        `yaml:"level" env:"LOG_LEVEL"`
+	Format         string        `yaml:"format" env:"LOG_FORMAT"`
+	Output         string        `yaml:"output" env:"LOG_OUTPUT"`
+	MaxSizeMb      int           `yaml:"maxSizeMb" env:"LOG_MAX_SIZE_MB"`
+	RotateInterval time.Duration `yaml:"rotateInterval" env:"LOG_ROTATE_INTERVAL"`
+	MaxBackups     int           `yaml:"maxBackups" env:"LOG_MAX_BACKUPS"` //为0时全部保留
+	Compress       bool          `yaml:"compress" env:"LOG_COMPRESS"`
+}
+
+//输出到文件而不是stdout或stderr
+func (l LogConfig) IsFile() bool {
+	return l.Output != "stdout" && l.Output != "stderr"
+}
+
+type Config struct {
+	ServerEnv  string           `yaml:"-"`
+	GameServer GameServerConfig `yaml:"gameServer"`
+	Listen     ListenConfig     `yaml:"listen"`
+	Bot        BotConfig        `yaml:"bot"`
+	Tick       TickConfig       `yaml:"tick"`
+	Login      LoginConfig      `yaml:"login"`
+	Ai         AiConfig         `yaml:"ai"`
+	Shutdown   ShutdownConfig   `yaml:"shutdown"`
+	Replay     ReplayConfig     `yaml:"replay"`
+	Log        LogConfig        `yaml:"log"`
+	Shards     []ShardConfig    `yaml:"shards"` //为空时只有一个名为DEFAULT_SHARD_NAME的分片, 即顶层的gameServer和bot.poolPath
+	//AI的变体, 以名字为key, 在ai的基础上覆盖配置文件strategies中给出的项, 用于离线模拟和锦标赛
+	Strategies map[string]AiConfig `yaml:"-"`
+}
+
+const DEFAULT_SHARD_NAME = "default"
+
+//补全默认值后的所有分片
+func (c *Config) ShardList() []ShardConfig {
+	if len(c.Shards) == 0 {
+		return []ShardConfig{{
+			Name:           DEFAULT_SHARD_NAME,
+			GameServer:     c.GameServer,
+			BotPoolPath:    c.Bot.PoolPath,
+			UpsyncEncoding: c.Tick.UpsyncEncoding,
+		}}
+	}
+	shards := make([]ShardConfig, len(c.Shards))
+	for i, shard := range c.Shards {
+		if shard.GameServer.Protocol == "" {
+			shard.GameServer.Protocol = c.GameServer.Protocol
+		}
+		if shard.GameServer.Host == "" {
+			shard.GameServer.Host = c.GameServer.Host
+		}
+		if shard.GameServer.Port == 0 {
+			shard.GameServer.Port = c.GameServer.Port
+		}
+		if shard.GameServer.WsPath == "" {
+			shard.GameServer.WsPath = c.GameServer.WsPath
+		}
+		if shard.BotPoolPath == "" {
+			shard.BotPoolPath = c.Bot.PoolPath
+		}
+		if shard.UpsyncEncoding == "" {
+			shard.UpsyncEncoding = c.Tick.UpsyncEncoding
+		}
+		shards[i] = shard
+	}
+	return shards
+}
+
+//配置文件: 公共部分之外, profiles下以ServerEnv为key的部分会覆盖公共部分
+type configFile struct {
+	Config     `yaml:",inline"`
+	Profiles   map[string]interface{} `yaml:"profiles"`
+	Strategies map[string]interface{} `yaml:"strategies"`
+}
+
+func Default() *Config {
+	return &Config{
+		ServerEnv: SERVER_ENV_TEST,
+		GameServer: GameServerConfig{
+			Protocol: "http",
+			Host:     "localhost",
+			Port:     9992,
+			WsPath:   "/tsrht",
+		},
+		Listen: ListenConfig{
+			Port: 15351,
+		},
+		Bot: BotConfig{
+			PoolPath:     "configs/bot_pool.yaml",
+			Lifetime:     65 * time.Second,
+			LeaseTimeout: 95 * time.Second,
+			ReapInterval: 5 * time.Second,
+		},
+		Tick: TickConfig{
+			UpsyncRate:     constants.DEFAULT_UPSYNC_RATE,
+			MaxUpsyncRate:  constants.MAX_UPSYNC_RATE,
+			UpsyncEncoding: constants.UPSYNC_ENCODING,
+		},
+		Login: LoginConfig{
+			MaxAttempts: 4,
+			Backoff:     500 * time.Millisecond,
+			MaxBackoff:  8 * time.Second,
+			HttpTimeout: 10 * time.Second,
+		},
+		Ai: AiConfig{
+			PositionReconcileTolerance: 24,
+			PositionSnapTolerance:      96,
+			PositionBlendFactor:        0.5,
+			StuckFrames:                20,
+		},
+		Shutdown: ShutdownConfig{
+			Deadline:     10 * time.Second,
+			HttpDeadline: 5 * time.Second,
+		},
+		Replay: ReplayConfig{
+			Dir: "replays",
+		},
+		Log: LogConfig{
+			Level:          "info",
+			Format:         LOG_FORMAT_CONSOLE,
+			Output:         "stdout",
+			MaxSizeMb:      32,
+			RotateInterval: time.Hour,
+			MaxBackups:     12,
+			Compress:       true,
+		},
+	}
+}
+
+//依次应用默认值, 配置文件的公共部分, serverEnv对应的profile和环境变量, 然后校验. path为空时不读取配置文件
+func Load(path string, serverEnv string, getenv func(string) string) (*Config, error) {
+	if serverEnv == "" {
+		serverEnv = SERVER_ENV_TEST
+	}
+	if serverEnv != SERVER_ENV_TEST && serverEnv != SERVER_ENV_PROD {
+		return nil, fmt.Errorf("unknown ServerEnv %q, expected %s or %s", serverEnv, SERVER_ENV_TEST, SERVER_ENV_PROD)
+	}
+	file := &configFile{Config: *Default()}
+	if path != "" {
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(bytes, file); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	config := &file.Config
+	config.ServerEnv = serverEnv
+	if profile, ok := file.Profiles[serverEnv]; ok {
+		bytes, err := yaml.Marshal(profile)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(bytes, config); err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %v", path, serverEnv, err)
+		}
+	}
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	if err := applyEnv(reflect.ValueOf(config).Elem(), getenv); err != nil {
+		return nil, err
+	}
+	//在环境变量之后处理, 变体也继承环境变量对ai的覆盖
+	config.Strategies = make(map[string]AiConfig, len(file.Strategies))
+	for name, overrides := range file.Strategies {
+		ai := config.Ai
+		bytes, err := yaml.Marshal(overrides)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(bytes, &ai); err != nil {
+			return nil, fmt.Errorf("%s: strategy %s: %v", path, name, err)
+		}
+		config.Strategies[name] = ai
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func applyEnv(v reflect.Value, getenv func(string) string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, getenv); err != nil {
+				return err
+			}
+			continue
+		}
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		name = ENV_PREFIX + name
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("%s=%q: %v", name, value, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported kind %v", field.Kind())
+	}
+	return nil
+}
+
+//返回所有不合法的配置项
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.GameServer.Protocol == "http" || c.GameServer.Protocol == "https", "gameServer.protocol must be http or https, got %q", c.GameServer.Protocol)
+	check(c.GameServer.Host != "", "gameServer.host is empty")
+	check(c.GameServer.Port > 0 && c.GameServer.Port < 65536, "gameServer.port %d out of range", c.GameServer.Port)
+	check(strings.HasPrefix(c.GameServer.WsPath, "/"), "gameServer.wsPath must start with /, got %q", c.GameServer.WsPath)
+	shards := c.ShardList()
+	names := make(map[string]bool)
+	for i, shard := range shards {
+		check(shard.Name != "" && !names[shard.Name], "shards[%d].name %q is empty or duplicated", i, shard.Name)
+		names[shard.Name] = true
+		check(shard.GameServer.Protocol == "http" || shard.GameServer.Protocol == "https", "shard %s: gameServer.protocol must be http or https, got %q", shard.Name, shard.GameServer.Protocol)
+		check(shard.GameServer.Port > 0 && shard.GameServer.Port < 65536, "shard %s: gameServer.port %d out of range", shard.Name, shard.GameServer.Port)
+		check(strings.HasPrefix(shard.GameServer.WsPath, "/"), "shard %s: gameServer.wsPath must start with /, got %q", shard.Name, shard.GameServer.WsPath)
+		check(shard.UpsyncEncoding == constants.UPSYNC_ENCODING_PB || shard.UpsyncEncoding == constants.UPSYNC_ENCODING_JSON, "shard %s: upsyncEncoding must be %s or %s, got %q", shard.Name, constants.UPSYNC_ENCODING_PB, constants.UPSYNC_ENCODING_JSON, shard.UpsyncEncoding)
+		if shard.HasRoomRange() {
+			check(shard.MinRoomId > 0 && (shard.MaxRoomId == 0 || shard.MaxRoomId >= shard.MinRoomId), "shard %s: invalid room range [%d, %d]", shard.Name, shard.MinRoomId, shard.MaxRoomId)
+			for _, other := range shards[:i] {
+				overlapped := other.HasRoomRange() &&
+					(shard.MaxRoomId == 0 || shard.MaxRoomId >= other.MinRoomId) &&
+					(other.MaxRoomId == 0 || other.MaxRoomId >= shard.MinRoomId)
+				check(!overlapped, "room ranges of shards %s and %s overlap", other.Name, shard.Name)
+			}
+		}
+	}
+	check(c.Listen.Port > 0 && c.Listen.Port < 65536, "listen.port %d out of range", c.Listen.Port)
+	check(c.Bot.PoolPath != "", "bot.poolPath is empty")
+	check(c.Bot.Lifetime > 0, "bot.lifetime must be positive")
+	check(c.Bot.LeaseTimeout > c.Bot.Lifetime, "bot.leaseTimeout %v must be longer than bot.lifetime %v", c.Bot.LeaseTimeout, c.Bot.Lifetime)
+	check(c.Bot.ReapInterval > 0, "bot.reapInterval must be positive")
+	check(c.Tick.MaxUpsyncRate > 0, "tick.maxUpsyncRate must be positive")
+	check(c.Tick.UpsyncRate > 0 && c.Tick.UpsyncRate <= c.Tick.MaxUpsyncRate, "tick.upsyncRate %d must be in (0, %d]", c.Tick.UpsyncRate, c.Tick.MaxUpsyncRate)
+	check(c.Tick.UpsyncEncoding == constants.UPSYNC_ENCODING_PB || c.Tick.UpsyncEncoding == constants.UPSYNC_ENCODING_JSON, "tick.upsyncEncoding must be %s or %s, got %q", constants.UPSYNC_ENCODING_PB, constants.UPSYNC_ENCODING_JSON, c.Tick.UpsyncEncoding)
+	check(c.Login.MaxAttempts > 0, "login.maxAttempts must be positive")
+	check(c.Login.Backoff > 0 && c.Login.MaxBackoff >= c.Login.Backoff, "login.backoff must be positive and not longer than login.maxBackoff")
+	check(c.Login.HttpTimeout > 0, "login.httpTimeout must be positive")
+	checkAi := func(prefix string, ai AiConfig) {
+		check(ai.PositionReconcileTolerance >= 0, "%s.positionReconcileTolerance must not be negative", prefix)
+		check(ai.PositionSnapTolerance >= ai.PositionReconcileTolerance, "%s.positionSnapTolerance must not be less than %s.positionReconcileTolerance", prefix, prefix)
+		check(ai.PositionBlendFactor > 0 && ai.PositionBlendFactor <= 1, "%s.positionBlendFactor must be in (0, 1]", prefix)
+		check(ai.StuckFrames > 0, "%s.stuckFrames must be positive", prefix)
+	}
+	checkAi("ai", c.Ai)
+	strategyNames := make([]string, 0, len(c.Strategies))
+	for name := range c.Strategies {
+		strategyNames = append(strategyNames, name)
+	}
+	sort.Strings(strategyNames)
+	for _, name := range strategyNames {
+		check(name != "" && !strings.ContainsAny(name, ", "), "strategy name %q must be non-empty without commas or spaces", name)
+		checkAi("strategies."+name, c.Strategies[name])
+	}
+	check(c.Shutdown.Deadline > 0, "shutdown.deadline must be positive")
+	check(c.Shutdown.HttpDeadline > 0, "shutdown.httpDeadline must be positive")
+	check(c.Replay.Dir != "", "replay.dir is empty")
+	validLevel := false
+	for _, level := range LOG_LEVELS {
+		validLevel = validLevel || c.Log.Level == level
+	}
+	check(validLevel, "log.level must be one of %s, got %q", strings.Join(LOG_LEVELS, ", "), c.Log.Level)
+	check(c.Log.Format == LOG_FORMAT_CONSOLE || c.Log.Format == LOG_FORMAT_JSON, "log.format must be %s or %s, got %q", LOG_FORMAT_CONSOLE, LOG_FORMAT_JSON, c.Log.Format)
+	check(c.Log.Output != "", "log.output is empty")
+	check(c.Log.MaxSizeMb >= 0, "log.maxSizeMb must not be negative")
+	check(c.Log.RotateInterval >= 0, "log.rotateInterval must not be negative")
+	check(c.Log.MaxBackups >= 0, "log.maxBackups must not be negative")
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
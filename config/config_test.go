@@ -0,0 +1,175 @@
+package config
+
+import (
+	"AI/constants"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfilesAndEnv(t *testing.T) {
+	path := writeConfig(t, `
+gameServer:
+  host: test.example.com
+bot:
+  lifetime: 30s
+  leaseTimeout: 60s
+profiles:
+  PROD:
+    gameServer:
+      host: prod.example.com
+      protocol: https
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := Load(path, SERVER_ENV_TEST, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.GameServer.Host != "test.example.com" || config.GameServer.Port != 9992 || config.Bot.Lifetime != 30*time.Second {
+		t.Errorf("unexpected TEST config %+v", config)
+	}
+
+	env := map[string]string{
+		"AI_GAME_SERVER_PORT":      "443",
+		"AI_LOGIN_BACKOFF":         "1s",
+		"AI_POSITION_BLEND_FACTOR": "0.25",
+		"AI_REPLAY_RECORD":         "true",
+		"AI_LOG_LEVEL":             "debug",
+	}
+	config, err = Load(path, SERVER_ENV_PROD, func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerEnv != SERVER_ENV_PROD || config.GameServer.Host != "prod.example.com" || config.GameServer.WsScheme() != "wss" {
+		t.Errorf("PROD profile not applied: %+v", config.GameServer)
+	}
+	if config.GameServer.Port != 443 || config.Login.Backoff != time.Second || config.Ai.PositionBlendFactor != 0.25 || !config.Replay.Record || config.Log.Level != "debug" {
+		t.Errorf("env overrides not applied: %+v", config)
+	}
+	if conf := config.GameServer.NetConf(); conf.PORT != ":443" || conf.PROTOCOL != "https" {
+		t.Errorf("unexpected NetConf %+v", conf)
+	}
+}
+
+func TestLoadRejectsInvalidConfig(t *testing.T) {
+	path := writeConfig(t, `
+bot:
+  lifetime: 60s
+  leaseTimeout: 30s
+tick:
+  upsyncEncoding: xml
+log:
+  level: verbose
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, err := Load(path, SERVER_ENV_TEST, func(string) string { return "" })
+	if err == nil || !strings.Contains(err.Error(), "bot.leaseTimeout") || !strings.Contains(err.Error(), "tick.upsyncEncoding") || !strings.Contains(err.Error(), "log.level") {
+		t.Errorf("expected validation errors, got %v", err)
+	}
+	if _, err := Load(path, "STAGING", nil); err == nil {
+		t.Errorf("expected an unknown ServerEnv to be rejected")
+	}
+	typo := writeConfig(t, "gameServer:\n  hots: localhost\n")
+	defer os.RemoveAll(filepath.Dir(typo))
+	if _, err := Load(typo, SERVER_ENV_TEST, nil); err == nil {
+		t.Errorf("expected an unknown key to be rejected")
+	}
+	if _, err := Load("../configs/config.yaml", SERVER_ENV_PROD, func(string) string { return "" }); err != nil {
+		t.Errorf("shipped config: %v", err)
+	}
+}
+
+func TestShards(t *testing.T) {
+	path := writeConfig(t, `
+gameServer:
+  host: shared.example.com
+shards:
+  - name: east
+    minRoomId: 1
+    maxRoomId: 100
+  - name: west
+    gameServer: {host: west.example.com, wsPath: /ws}
+    botPoolPath: west.yaml
+    upsyncEncoding: pb
+    minRoomId: 101
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, err := Load(path, SERVER_ENV_TEST, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := config.ShardList()
+	if len(shards) != 2 || shards[0].GameServer.Host != "shared.example.com" || shards[0].BotPoolPath != config.Bot.PoolPath {
+		t.Errorf("shard defaults not applied: %+v", shards)
+	}
+	if shards[0].UpsyncEncoding != constants.UPSYNC_ENCODING_JSON || shards[1].UpsyncEncoding != constants.UPSYNC_ENCODING_PB {
+		t.Errorf("expected json by default and pb opted in by west, got %+v", shards)
+	}
+	if shards[1].GameServer.BaseUrl() != "http://west.example.com:9992" || shards[1].GameServer.WsPath != "/ws" {
+		t.Errorf("unexpected west shard %+v", shards[1])
+	}
+	if !shards[0].ContainsRoom(100) || shards[0].ContainsRoom(101) || !shards[1].ContainsRoom(1000000) {
+		t.Errorf("unexpected room ranges %+v", shards)
+	}
+
+	config.Shards[1].MinRoomId = 50
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Errorf("expected overlapping room ranges to be rejected, got %v", err)
+	}
+	if shards := Default().ShardList(); len(shards) != 1 || shards[0].Name != DEFAULT_SHARD_NAME {
+		t.Errorf("unexpected default shards %+v", shards)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	path := writeConfig(t, `
+ai:
+  stuckFrames: 10
+strategies:
+  patient:
+    stuckFrames: 40
+  eager: {}
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	env := map[string]string{"AI_POSITION_BLEND_FACTOR": "0.25"}
+	config, err := Load(path, SERVER_ENV_TEST, func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	patient, eager := config.Strategies["patient"], config.Strategies["eager"]
+	if len(config.Strategies) != 2 || patient.StuckFrames != 40 || eager.StuckFrames != 10 {
+		t.Errorf("unexpected strategies %+v", config.Strategies)
+	}
+	if patient.PositionBlendFactor != 0.25 || patient.PositionSnapTolerance != Default().Ai.PositionSnapTolerance {
+		t.Errorf("expected strategies to inherit ai and env overrides, got %+v", patient)
+	}
+
+	path = writeConfig(t, `
+strategies:
+  broken:
+    stuckFrames: 0
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	if _, err := Load(path, SERVER_ENV_TEST, func(string) string { return "" }); err == nil || !strings.Contains(err.Error(), "strategies.broken.stuckFrames") {
+		t.Errorf("expected an invalid strategy to be rejected, got %v", err)
+	}
+}
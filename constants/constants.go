@@ -1,6 +1,6 @@
 package constants
 
-// TODO: Read from config file!
+// "SERVER" is overwritten by "gameServer" of the config file at startup, see config/config.go.
 
 type NetConf struct{
   PROTOCOL string
@@ -21,3 +21,19 @@ var (
 	GET         = "/get"
 	LOGIN       = "/login"
 )
+
+// Encodings of "PlayerUpsyncCmd". JSON is the default since not every game server parses binary frames yet, "pb" is opted in per shard.
+const (
+  UPSYNC_ENCODING_JSON = "json"
+  UPSYNC_ENCODING_PB   = "pb"
+)
+
+var (
+  UPSYNC_ENCODING = UPSYNC_ENCODING_JSON
+)
+
+// Upsync frames per second of each bot, can be overridden by "/spawnBot?upsyncRate=".
+const (
+  DEFAULT_UPSYNC_RATE = 20
+  MAX_UPSYNC_RATE     = 60
+)
@@ -0,0 +1,134 @@
+//后台运行和pid文件. Go程序不能安全地fork, 后台运行通过在新的会话中重新执行自身实现
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//设置了该环境变量的进程是Start启动的后台进程
+const ENV_CHILD = "TREASURE_HUNTER_BOT_DAEMON"
+
+//等待后台进程写入pid文件的最长时间
+const DEFAULT_START_TIMEOUT = 10 * time.Second
+
+//后台进程的标准输出和标准错误追加写到pid文件旁的这个文件里, 保留zap自身的错误, 未恢复的panic和fatal error
+const STDERR_SUFFIX = ".stderr"
+
+func StderrPath(pidFile string) string {
+	return pidFile + STDERR_SUFFIX
+}
+
+func IsChild() bool {
+	return os.Getenv(ENV_CHILD) != ""
+}
+
+//pid文件不存在时返回os.ErrNotExist
+func ReadPid(path string) (int, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(bytes)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s: %q", path, bytes)
+	}
+	return pid, nil
+}
+
+func Alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+type AlreadyRunningError struct {
+	Path string
+	Pid  int
+}
+
+func (e *AlreadyRunningError) Error() string {
+	return fmt.Sprintf("process %d in pid file %s is still running", e.Pid, e.Path)
+}
+
+//写入当前进程的pid. pid文件中的进程仍在运行时返回*AlreadyRunningError, 进程已经退出的旧文件直接覆盖
+func WritePidFile(path string) error {
+	if pid, err := ReadPid(path); err == nil && pid != os.Getpid() && Alive(pid) {
+		return &AlreadyRunningError{Path: path, Pid: pid}
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+//只删除记录着当前进程的pid文件, 避免误删之后启动的进程的
+func RemovePidFile(path string) error {
+	pid, err := ReadPid(path)
+	if err != nil {
+		return err
+	}
+	if pid != os.Getpid() {
+		return fmt.Errorf("pid file %s belongs to process %d", path, pid)
+	}
+	return os.Remove(path)
+}
+
+//以args重新执行当前程序, 脱离终端在新的会话中运行, 标准输入指向/dev/null, 标准输出和标准错误写到StderrPath(pidFile).
+//后台进程须在timeout内把自己的pid写入pidFile, 在此之前退出或超时都视为启动失败
+func Start(args []string, pidFile string, timeout time.Duration) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer null.Close()
+	stderrPath := StderrPath(pidFile)
+	stderr, err := os.OpenFile(stderrPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer stderr.Close()
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), ENV_CHILD+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = null, stderr, stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exited")
+			}
+			return 0, fmt.Errorf("daemon %d failed to start: %v, see %s", pid, err, stderrPath)
+		case <-deadline:
+			cmd.Process.Kill()
+			return 0, fmt.Errorf("daemon %d did not write pid file %s in %v", pid, pidFile, timeout)
+		case <-ticker.C:
+			if written, err := ReadPid(pidFile); err == nil && written == pid {
+				return pid, nil
+			}
+		}
+	}
+}
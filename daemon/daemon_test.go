@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//由TestStart作为后台进程执行, 写入pid文件后等待被杀掉
+func TestDaemonChild(t *testing.T) {
+	if !IsChild() {
+		t.Skip("only run as the daemon of TestStart")
+	}
+	if os.Getenv("DAEMON_TEST_FAIL") != "" {
+		fmt.Fprintln(os.Stderr, "daemon test failed")
+		os.Exit(3)
+	}
+	if err := WritePidFile(os.Getenv("DAEMON_TEST_PID_FILE")); err != nil {
+		os.Exit(4)
+	}
+	time.Sleep(time.Minute)
+	os.Exit(0)
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestStart(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	pidFile := filepath.Join(dir, "bot.pid")
+	os.Setenv("DAEMON_TEST_PID_FILE", pidFile)
+	defer os.Unsetenv("DAEMON_TEST_PID_FILE")
+
+	pid, err := Start([]string{"-test.run=^TestDaemonChild$"}, pidFile, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Alive(pid) {
+		t.Fatalf("daemon %d is not running", pid)
+	}
+	if err := WritePidFile(pidFile); err == nil {
+		t.Errorf("expected the running daemon to be detected")
+	} else if running, ok := err.(*AlreadyRunningError); !ok || running.Pid != pid {
+		t.Errorf("unexpected error %v", err)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+	deadline := time.Now().Add(5 * time.Second)
+	for Alive(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if Alive(pid) {
+		t.Fatalf("daemon %d is still running", pid)
+	}
+
+	os.Setenv("DAEMON_TEST_FAIL", "1")
+	defer os.Unsetenv("DAEMON_TEST_FAIL")
+	if _, err := Start([]string{"-test.run=^TestDaemonChild$"}, pidFile, 5*time.Second); err == nil {
+		t.Errorf("expected a daemon exiting at once to fail to start")
+	}
+	//崩溃的输出留在pid文件旁, 不被丢弃
+	if bytes, err := ioutil.ReadFile(StderrPath(pidFile)); err != nil || !strings.Contains(string(bytes), "daemon test failed") {
+		t.Errorf("expected the stderr of the daemon to be kept, got %q %v", bytes, err)
+	}
+}
+
+func TestPidFile(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "bot.pid")
+
+	if _, err := ReadPid(path); !os.IsNotExist(err) {
+		t.Errorf("expected a missing pid file, got %v", err)
+	}
+	//已经退出的进程留下的旧文件
+	if err := ioutil.WriteFile(path, []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := ReadPid(path); err != nil || pid != os.Getpid() {
+		t.Errorf("expected our pid, got %d %v", pid, err)
+	}
+	if err := RemovePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	other := strconv.Itoa(os.Getppid())
+	ioutil.WriteFile(path, []byte(other), 0644)
+	if err := RemovePidFile(path); err == nil {
+		t.Errorf("expected the pid file of another process to be kept")
+	}
+	ioutil.WriteFile(path, []byte("garbage"), 0644)
+	if _, err := ReadPid(path); err == nil {
+		t.Errorf("expected an invalid pid file to be rejected")
+	}
+}
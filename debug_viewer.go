@@ -0,0 +1,92 @@
+package main
+
+import (
+	"AI/astar"
+	"AI/models"
+	pb "AI/pb_output"
+	_ "embed"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+//go:embed web/debug_viewer.html
+var debugViewerHtml []byte
+
+//调试页面用到的静态地图数据, 坐标与下行帧一致
+type debugStage struct {
+	StageName  string           `json:"stageName"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	TileWidth  int              `json:"tileWidth"`
+	TileHeight int              `json:"tileHeight"`
+	CollideMap astar.Map        `json:"collideMap"`
+	TileCoords [][]models.Vec2D `json:"tileCoords"` //[row][col]对应的连续坐标
+	Barriers   [][]models.Vec2D `json:"barriers"`   //每个障碍物多边形的顶点, 已加上Anchor
+}
+
+//collideMap在寻路时只读, 可以与上行goroutine共享
+func newDebugStage(battleColliderInfo *pb.BattleColliderInfo, tmx *models.TmxMap, collideMap astar.Map) *debugStage {
+	stage := &debugStage{
+		StageName:  battleColliderInfo.StageName,
+		Width:      tmx.Width,
+		Height:     tmx.Height,
+		TileWidth:  tmx.TileWidth,
+		TileHeight: tmx.TileHeight,
+		CollideMap: collideMap,
+		TileCoords: make([][]models.Vec2D, tmx.Height),
+	}
+	for i := 0; i < tmx.Height; i++ {
+		stage.TileCoords[i] = make([]models.Vec2D, tmx.Width)
+		for j := 0; j < tmx.Width; j++ {
+			x, y := tmx.GetCoordByGid(i*tmx.Width + j)
+			stage.TileCoords[i][j] = models.Vec2D{X: x, Y: y}
+		}
+	}
+	if barrierGroup, ok := battleColliderInfo.StrToPolygon2DListMap["Barrier"]; ok {
+		for _, polygon := range barrierGroup.Polygon2DList {
+			points := make([]models.Vec2D, len(polygon.Points))
+			for i, pt := range polygon.Points {
+				points[i] = models.Vec2D{
+					X: pt.X + polygon.Anchor.X,
+					Y: pt.Y + polygon.Anchor.Y,
+				}
+			}
+			stage.Barriers = append(stage.Barriers, points)
+		}
+	}
+	return stage
+}
+
+func (server *botServer) registerDebugViewer(r *gin.Engine) {
+	r.GET("/debug", server.handleDebugViewer)
+	r.GET("/debugStage", server.handleDebugStage)
+}
+
+//页面通过/bots选择bot, 通过/debugStage取地图, 再通过/botTelemetry实时更新
+func (server *botServer) handleDebugViewer(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", debugViewerHtml)
+}
+
+func (server *botServer) handleDebugStage(c *gin.Context) {
+	botName := c.Query("botName")
+	running, ok := server.registry.get(botName)
+	if !ok {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "bot " + botName + " 没有在运行",
+		})
+		return
+	}
+	stage := running.client.DebugStage()
+	if stage == nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "bot " + botName + " 还没有收到BattleColliderInfo",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"ret":   RET_OK,
+		"stage": stage,
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"AI/models"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDebugViewerServesEmbeddedPage(t *testing.T) {
+	server := newTestBotServer(t, "http://localhost:9992")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerDebugViewer(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/debug", nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if len(debugViewerHtml) == 0 || !bytes.Equal(w.Body.Bytes(), debugViewerHtml) || !bytes.Contains(w.Body.Bytes(), []byte("<canvas")) {
+		t.Errorf("expected the embedded page with a canvas, got %d bytes", w.Body.Len())
+	}
+}
+
+func TestDebugStage(t *testing.T) {
+	server := newTestBotServer(t, "http://localhost:9992")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerDebugViewer(r)
+	debugStage := func(botName string) (ret int, stage *debugStage) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/debugStage?botName="+botName, nil))
+		resp := struct {
+			Ret   int         `json:"ret"`
+			Stage *debugStage `json:"stage"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", w.Body.String(), err)
+		}
+		return resp.Ret, resp.Stage
+	}
+
+	if ret, _ := debugStage("unknown"); ret != RET_FAILED {
+		t.Errorf("expected an unknown bot to fail, got %d", ret)
+	}
+	//还没有收到BattleColliderInfo
+	client := newClient(nil, 1, spawnBotOptions{})
+	lease := &models.BotLease{LeaseId: 1, BotName: "bot1"}
+	server.registry.add(server.shards[0], lease, client)
+	if ret, _ := debugStage("bot1"); ret != RET_FAILED {
+		t.Errorf("expected a bot without a stage to fail, got %d", ret)
+	}
+	client.initBattleCollider(newFakeStage().ColliderInfo)
+	if ret, stage := debugStage("bot1"); ret != RET_OK || stage == nil || len(stage.CollideMap) != 8 || len(stage.TileCoords) != 8 || len(stage.Barriers) != 1 {
+		t.Errorf("unexpected stage %d %+v", ret, stage)
+	}
+}
@@ -0,0 +1,293 @@
+package fakeserver
+
+import (
+	"AI/login"
+	"AI/models"
+	pb "AI/pb_output"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+)
+
+//以下字段除conn和writeMutex外都由Server.mutex保护
+type roomPlayer struct {
+	roomId        int
+	player        *pb.Player
+	conn          *websocket.Conn
+	writeMutex    sync.Mutex //gorilla/websocket不允许并发写
+	connected     bool
+	acked         bool //收到PlayerBattleColliderAck后才下发RoomDownsyncFrame
+	sentFullFrame bool
+	upsyncs       int
+	lastUpsync    *pb.PlayerUpsyncCmd
+	closeCode     int
+}
+
+func (p *roomPlayer) snapshotLocked() PlayerSnapshot {
+	return PlayerSnapshot{
+		PlayerId:   p.player.Id,
+		RoomId:     p.roomId,
+		X:          p.player.X,
+		Y:          p.player.Y,
+		Score:      p.player.Score,
+		Upsyncs:    p.upsyncs,
+		LastUpsync: p.lastUpsync,
+		Connected:  p.connected,
+		CloseCode:  p.closeCode,
+	}
+}
+
+func (p *roomPlayer) writeJson(v interface{}) error {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	return p.conn.WriteJSON(v)
+}
+
+//与后端一致, 每一帧都先发一条只有act的json, 再发一条data为protobuf的json
+func (p *roomPlayer) writeFrame(frameBytes []byte) error {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	if err := p.conn.WriteJSON(&wsResp{Ret: int32(login.RET_CODE_OK), Act: "RoomDownsyncFrame"}); err != nil {
+		return err
+	}
+	return p.conn.WriteJSON(&wsRespPb{Ret: int32(login.RET_CODE_OK), Act: "RoomDownsyncFrame", Data: frameBytes})
+}
+
+func (p *roomPlayer) writeClose(code int) {
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	p.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+}
+
+//除stop外的字段由Server.mutex保护
+type room struct {
+	id               int
+	server           *Server
+	players          map[int32]*roomPlayer
+	joinCount        int
+	treasures        map[int32]*pb.Treasure
+	removedTreasures []*pb.Treasure //上一帧之后被吃掉的宝物
+	frameId          int32
+	stop             chan struct{}
+}
+
+func (s *Server) newRoomLocked(id int) *room {
+	r := &room{
+		id:        id,
+		server:    s,
+		players:   make(map[int32]*roomPlayer),
+		treasures: make(map[int32]*pb.Treasure),
+		stop:      make(chan struct{}),
+	}
+	for _, treasure := range s.Stage.Treasures {
+		r.treasures[treasure.Id] = proto.Clone(treasure).(*pb.Treasure)
+	}
+	s.rooms[id] = r
+	s.wg.Add(1)
+	go r.run()
+	return r
+}
+
+//以FrameRate下发RoomDownsyncFrame, 直到Server.Close
+func (r *room) run() {
+	defer r.server.wg.Done()
+	ticker := time.NewTicker(time.Second / time.Duration(r.server.FrameRate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			r.server.mutex.Lock()
+			players := make([]*roomPlayer, 0, len(r.players))
+			for _, p := range r.players {
+				players = append(players, p)
+			}
+			r.server.mutex.Unlock()
+			for _, p := range players {
+				p.writeClose(websocket.CloseGoingAway)
+				p.conn.Close()
+			}
+			return
+		case <-ticker.C:
+			r.broadcast()
+		}
+	}
+}
+
+//新加入的玩家收到全量帧, 之后只收到被吃掉的宝物. 玩家信息每帧都是全量的
+func (r *room) broadcast() {
+	type outgoing struct {
+		player     *roomPlayer
+		frameBytes []byte
+	}
+	var outgoings []outgoing
+
+	r.server.mutex.Lock()
+	r.frameId++
+	players := make(map[int32]*pb.Player, len(r.players))
+	for id, p := range r.players {
+		players[id] = proto.Clone(p.player).(*pb.Player)
+	}
+	removed := make(map[int32]*pb.Treasure, len(r.removedTreasures))
+	for _, treasure := range r.removedTreasures {
+		removed[treasure.Id] = treasure
+	}
+	r.removedTreasures = nil
+	var fullFrameBytes, diffFrameBytes []byte
+	for _, p := range r.players {
+		if !p.acked {
+			continue
+		}
+		frame := &pb.RoomDownsyncFrame{
+			Id:      r.frameId,
+			Players: players,
+			SentAt:  time.Now().UnixNano() / int64(time.Millisecond),
+		}
+		if !p.sentFullFrame {
+			if fullFrameBytes == nil {
+				frame.Treasures = r.treasures
+				fullFrameBytes, _ = proto.Marshal(frame)
+			}
+			p.sentFullFrame = true
+			outgoings = append(outgoings, outgoing{p, fullFrameBytes})
+		} else {
+			if diffFrameBytes == nil {
+				frame.RefFrameId = r.frameId - 1
+				frame.Treasures = removed
+				diffFrameBytes, _ = proto.Marshal(frame)
+			}
+			outgoings = append(outgoings, outgoing{p, diffFrameBytes})
+		}
+	}
+	r.server.mutex.Unlock()
+
+	//写失败时由读goroutine发现连接断开
+	for _, o := range outgoings {
+		o.player.writeFrame(o.frameBytes)
+	}
+}
+
+//处理一个玩家的连接直到断开
+func (r *room) serve(playerId int32, conn *websocket.Conn) {
+	s := r.server
+	s.mutex.Lock()
+	p, ok := s.players[playerId]
+	if !ok || p.roomId != r.id {
+		r.joinCount++
+		pos := s.Stage.StartingPosition(r.joinCount)
+		p = &roomPlayer{
+			roomId: r.id,
+			player: &pb.Player{
+				Id:        playerId,
+				X:         pos.X,
+				Y:         pos.Y,
+				Speed:     s.PlayerSpeed,
+				JoinIndex: int32(r.joinCount),
+			},
+		}
+		s.players[playerId] = p
+	}
+	p.conn = conn
+	p.connected = true
+	p.acked = false
+	p.sentFullFrame = false
+	p.closeCode = 0
+	r.players[playerId] = p
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		p.connected = false
+		delete(r.players, playerId)
+		s.mutex.Unlock()
+	}()
+
+	colliderInfoBytes, _ := proto.Marshal(s.Stage.ColliderInfo)
+	heartbeat, _ := json.Marshal(&heartbeatRequirements{
+		IntervalToPing:        INTERVAL_TO_PING,
+		WillKickIfInactiveFor: WILL_KICK_IF_INACTIVE_FOR,
+		BoundRoomId:           r.id,
+		BattleColliderInfo:    colliderInfoBytes,
+	})
+	if err := p.writeJson(&wsResp{Ret: int32(login.RET_CODE_OK), Act: "HeartbeatRequirements", Data: heartbeat}); err != nil {
+		return
+	}
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				s.mutex.Lock()
+				p.closeCode = closeErr.Code
+				s.mutex.Unlock()
+			}
+			return
+		}
+		cmd := r.decodeUpsync(p, messageType, message)
+		if cmd != nil {
+			s.mutex.Lock()
+			r.applyUpsyncLocked(p, cmd)
+			s.mutex.Unlock()
+		}
+	}
+}
+
+//返回上行帧, 其他消息在这里处理
+func (r *room) decodeUpsync(p *roomPlayer, messageType int, message []byte) *pb.PlayerUpsyncCmd {
+	if messageType == websocket.BinaryMessage {
+		req := new(pb.WsReq)
+		cmd := new(pb.PlayerUpsyncCmd)
+		if proto.Unmarshal(message, req) != nil || req.Act != "PlayerUpsyncCmd" || proto.Unmarshal(req.Data, cmd) != nil {
+			return nil
+		}
+		return cmd
+	}
+	req := new(wsReq)
+	if json.Unmarshal(message, req) != nil {
+		return nil
+	}
+	switch req.Act {
+	case "PlayerBattleColliderAck":
+		r.server.mutex.Lock()
+		p.acked = true
+		r.server.mutex.Unlock()
+	case "PlayerUpsyncCmd":
+		jsonCmd := new(jsonUpsyncCmd)
+		if json.Unmarshal(req.Data, jsonCmd) != nil {
+			return nil
+		}
+		return &pb.PlayerUpsyncCmd{
+			Id:            jsonCmd.Id,
+			X:             jsonCmd.X,
+			Y:             jsonCmd.Y,
+			Dir:           &pb.Direction{Dx: jsonCmd.Dir.Dx, Dy: jsonCmd.Dir.Dy},
+			AckingFrameId: jsonCmd.AckingFrameId,
+		}
+	}
+	return nil
+}
+
+//以上行帧的坐标为准, 并吃掉范围内的宝物
+func (r *room) applyUpsyncLocked(p *roomPlayer, cmd *pb.PlayerUpsyncCmd) {
+	if cmd.Id != p.player.Id {
+		return
+	}
+	p.upsyncs++
+	p.lastUpsync = cmd
+	p.player.X = cmd.X
+	p.player.Y = cmd.Y
+	p.player.Dir = cmd.Dir
+	pos := models.Vec2D{X: cmd.X, Y: cmd.Y}
+	for id, treasure := range r.treasures {
+		treasurePos := models.Vec2D{X: treasure.X, Y: treasure.Y}
+		if models.Distance(&pos, &treasurePos) <= r.server.PickupRadius {
+			delete(r.treasures, id)
+			removed := proto.Clone(treasure).(*pb.Treasure)
+			removed.Removed = true
+			r.removedTreasures = append(r.removedTreasures, removed)
+			p.player.Score += treasure.Score
+		}
+	}
+}
@@ -0,0 +1,320 @@
+//Treasure Hunter X后端的替身, 实现bot用到的短信验证码登录接口和/tsrht websocket, 用于在go test中端到端地运行bot
+package fakeserver
+
+import (
+	C "AI/constants"
+	"AI/login"
+	"AI/models"
+	pb "AI/pb_output"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	TEST_CAPTCHA               = "123456"
+	DEFAULT_FRAME_RATE         = 20
+	DEFAULT_PLAYER_SPEED       = 200
+	DEFAULT_INT_AUTH_TOKEN_TTL = 7 * 24 * time.Hour
+	DEFAULT_PLAYERS_PER_ROOM   = 2
+	WS_PATH                    = "/tsrht"
+	INTERVAL_TO_PING           = 2000
+	WILL_KICK_IF_INACTIVE_FOR  = 6000
+	PLAYER_RADIUS              = 12
+)
+
+//与后端下发的json结构一致
+type wsResp struct {
+	Ret         int32           `json:"ret,omitempty"`
+	EchoedMsgId int32           `json:"echoedMsgId,omitempty"`
+	Act         string          `json:"act,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+type wsRespPb struct {
+	Ret         int32  `json:"ret,omitempty"`
+	EchoedMsgId int32  `json:"echoedMsgId,omitempty"`
+	Act         string `json:"act,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+}
+
+type wsReq struct {
+	MsgId int             `json:"msgId"`
+	Act   string          `json:"act"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type heartbeatRequirements struct {
+	IntervalToPing        int    `json:"intervalToPing"`
+	WillKickIfInactiveFor int    `json:"willKickIfInactiveFor"`
+	BoundRoomId           int    `json:"boundRoomId"`
+	BattleColliderInfo    []byte `json:"battleColliderInfo"`
+}
+
+//json编码的上行帧, 见AiClient.go中的upsyncFrameDataJson
+type jsonUpsyncCmd struct {
+	Id            int32            `json:"id"`
+	X             float64          `json:"x"`
+	Y             float64          `json:"y"`
+	Dir           models.Direction `json:"dir"`
+	AckingFrameId int32            `json:"AckingFrameId"`
+}
+
+type account struct {
+	playerId     int32
+	phoneNum     string
+	captcha      string
+	intAuthToken string
+	expiresAt    time.Time
+}
+
+//玩家在服务器上的状态, 供测试检查
+type PlayerSnapshot struct {
+	PlayerId   int32
+	RoomId     int
+	X          float64
+	Y          float64
+	Score      int32
+	Upsyncs    int
+	LastUpsync *pb.PlayerUpsyncCmd
+	Connected  bool
+	CloseCode  int //客户端close帧中的状态码, 没有正常关闭时为0
+}
+
+//所有字段须在第一个请求前设置
+type Server struct {
+	Stage          *Stage
+	FrameRate      int
+	PlayerSpeed    int32
+	TokenTTL       time.Duration
+	PlayersPerRoom int
+	PickupRadius   float64 //玩家与宝物的距离不超过该值时吃掉宝物
+
+	//接下来这么多次获取验证码返回SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY, 用于测试频率限制
+	TooFrequentlyCaptchaGets int
+
+	mux *http.ServeMux
+
+	mutex          sync.Mutex
+	accounts       map[string]*account //以国家码+手机号为key
+	tokens         map[string]*account
+	lastPlayerId   int32
+	rooms          map[int]*room
+	lastRoomId     int
+	players        map[int32]*roomPlayer
+	closed         bool
+	wg             sync.WaitGroup
+	captchaGets    int
+	smsLoginCounts int
+}
+
+func NewServer(stage *Stage) *Server {
+	s := &Server{
+		Stage:          stage,
+		FrameRate:      DEFAULT_FRAME_RATE,
+		PlayerSpeed:    DEFAULT_PLAYER_SPEED,
+		TokenTTL:       DEFAULT_INT_AUTH_TOKEN_TTL,
+		PlayersPerRoom: DEFAULT_PLAYERS_PER_ROOM,
+		PickupRadius:   stage.PickupRadius(),
+		mux:            http.NewServeMux(),
+		accounts:       make(map[string]*account),
+		tokens:         make(map[string]*account),
+		rooms:          make(map[int]*room),
+		players:        make(map[int32]*roomPlayer),
+	}
+	apiPrefix := C.API + C.PLAYER + C.VERSION + C.SMS_CAPTCHA
+	s.mux.HandleFunc(apiPrefix+C.GET, s.handleGetCaptcha)
+	s.mux.HandleFunc(apiPrefix+C.LOGIN, s.handleSmsLogin)
+	s.mux.HandleFunc(WS_PATH, s.handleWs)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+//停止所有房间并断开所有玩家, 之后的websocket连接会被拒绝
+func (s *Server) Close() {
+	s.mutex.Lock()
+	s.closed = true
+	for _, room := range s.rooms {
+		close(room.stop)
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+func (s *Server) writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+//后端只给测试账号在响应中带上验证码, 这里所有手机号都视为测试账号
+func (s *Server) handleGetCaptcha(w http.ResponseWriter, r *http.Request) {
+	phoneNum := r.URL.Query().Get("phoneNum")
+	phoneCountryCode := r.URL.Query().Get("phoneCountryCode")
+	if phoneNum == "" || phoneCountryCode == "" {
+		s.writeJson(w, &login.RespGetCaptcha{Ret: int(login.RET_CODE_INVALID_REQUEST_PARAM)})
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.captchaGets++
+	if s.TooFrequentlyCaptchaGets > 0 {
+		s.TooFrequentlyCaptchaGets--
+		s.writeJson(w, &login.RespGetCaptcha{Ret: int(login.RET_CODE_SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY)})
+		return
+	}
+	key := phoneCountryCode + " " + phoneNum
+	acc, ok := s.accounts[key]
+	if !ok {
+		acc = &account{phoneNum: phoneNum}
+		s.accounts[key] = acc
+	}
+	acc.captcha = TEST_CAPTCHA
+	s.writeJson(w, &login.RespGetCaptcha{
+		Ret:             int(login.RET_CODE_IS_TEST_ACC),
+		SmsLoginCaptcha: acc.captcha,
+	})
+}
+
+//未注册的手机号在第一次登录时创建玩家
+func (s *Server) handleSmsLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.PostFormValue("phoneCountryCode") + " " + r.PostFormValue("phoneNum")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.smsLoginCounts++
+	acc, ok := s.accounts[key]
+	if !ok || acc.captcha == "" || acc.captcha != r.PostFormValue("smsLoginCaptcha") {
+		s.writeJson(w, &login.RespSmsLogin{Ret: int(login.RET_CODE_SMS_CAPTCHA_NOT_MATCH)})
+		return
+	}
+	acc.captcha = ""
+	if acc.playerId == 0 {
+		s.lastPlayerId++
+		acc.playerId = s.lastPlayerId
+	}
+	if acc.intAuthToken != "" {
+		delete(s.tokens, acc.intAuthToken)
+	}
+	acc.intAuthToken = fmt.Sprintf("token-%d-%d", acc.playerId, s.smsLoginCounts)
+	acc.expiresAt = time.Now().Add(s.TokenTTL)
+	s.tokens[acc.intAuthToken] = acc
+	s.writeJson(w, &login.RespSmsLogin{
+		Ret:         int(login.RET_CODE_OK),
+		Token:       acc.intAuthToken,
+		ExpiresAt:   acc.expiresAt.UnixNano() / int64(time.Millisecond),
+		PlayerID:    int(acc.playerId),
+		DisplayName: acc.phoneNum,
+		Name:        acc.phoneNum,
+	})
+}
+
+//短信验证码登录成功的次数, 用于检查token缓存
+func (s *Server) SmsLoginCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.smsLoginCounts
+}
+
+func (s *Server) PlayerIdByPhone(phoneNum string, phoneCountryCode string) (int32, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	acc, ok := s.accounts[phoneCountryCode+" "+phoneNum]
+	if !ok || acc.playerId == 0 {
+		return 0, false
+	}
+	return acc.playerId, true
+}
+
+//令token失效, 模拟后端的INVALID_TOKEN
+func (s *Server) RevokeTokens() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokens = make(map[string]*account)
+}
+
+//expectedRoomId大于0时加入该房间, 否则加入第一个未满的房间
+func (s *Server) joinRoomLocked(expectedRoomId int) (*room, error) {
+	if expectedRoomId > 0 {
+		if r, ok := s.rooms[expectedRoomId]; ok {
+			if len(r.players) >= s.PlayersPerRoom {
+				return nil, fmt.Errorf("room %d is full", expectedRoomId)
+			}
+			return r, nil
+		}
+		if expectedRoomId > s.lastRoomId {
+			s.lastRoomId = expectedRoomId
+		}
+		return s.newRoomLocked(expectedRoomId), nil
+	}
+	for id := 1; id <= s.lastRoomId; id++ {
+		if r, ok := s.rooms[id]; ok && len(r.players) < s.PlayersPerRoom {
+			return r, nil
+		}
+	}
+	s.lastRoomId++
+	return s.newRoomLocked(s.lastRoomId), nil
+}
+
+func (s *Server) handleWs(w http.ResponseWriter, r *http.Request) {
+	expectedRoomId, _ := strconv.Atoi(r.URL.Query().Get("expectedRoomId"))
+	s.mutex.Lock()
+	acc, ok := s.tokens[r.URL.Query().Get("intAuthToken")]
+	if !ok || time.Now().After(acc.expiresAt) || s.closed {
+		s.mutex.Unlock()
+		http.Error(w, login.RET_CODE_INVALID_TOKEN.String(), http.StatusForbidden)
+		return
+	}
+	if p, ok := s.players[acc.playerId]; ok && p.connected {
+		s.mutex.Unlock()
+		http.Error(w, login.RET_CODE_PLAYER_NOT_ADDABLE_TO_ROOM.String(), http.StatusForbidden)
+		return
+	}
+	rm, err := s.joinRoomLocked(expectedRoomId)
+	if err != nil {
+		s.mutex.Unlock()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	s.wg.Add(1)
+	defer s.wg.Done()
+	s.mutex.Unlock()
+
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	rm.serve(acc.playerId, conn)
+}
+
+func (s *Server) Players() []PlayerSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshots := make([]PlayerSnapshot, 0, len(s.players))
+	for _, p := range s.players {
+		snapshots = append(snapshots, p.snapshotLocked())
+	}
+	return snapshots
+}
+
+func (s *Server) Player(playerId int32) (PlayerSnapshot, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p, ok := s.players[playerId]
+	if !ok {
+		return PlayerSnapshot{}, false
+	}
+	return p.snapshotLocked(), true
+}
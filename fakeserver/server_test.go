@@ -0,0 +1,122 @@
+package fakeserver
+
+import (
+	"AI/login"
+	pb "AI/pb_output"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+)
+
+const pacmanStagePath = "../map/map/pacman/map.tmx"
+
+func TestLoadStage(t *testing.T) {
+	stage, err := LoadStage(pacmanStagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stage.Name != "pacman" || stage.Tmx.Width != 50 || stage.Tmx.Height != 50 {
+		t.Errorf("unexpected stage %s %+v", stage.Name, stage.Tmx)
+	}
+	barriers := stage.ColliderInfo.StrToPolygon2DListMap[COLLIDER_INFO_BARRIER_POLYGON_KEY].Polygon2DList
+	if len(barriers) == 0 || len(stage.StartingPositions) != 2 || len(stage.Treasures) == 0 || len(stage.GuardTowers) != 4 {
+		t.Errorf("got %d barriers, %d starting positions, %d treasures, %d guard towers", len(barriers), len(stage.StartingPositions), len(stage.Treasures), len(stage.GuardTowers))
+	}
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) *pb.RoomDownsyncFrame {
+	for {
+		resp := new(wsResp)
+		if err := conn.ReadJSON(resp); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if resp.Act != "RoomDownsyncFrame" {
+			continue
+		}
+		respPb := new(wsRespPb)
+		if err := conn.ReadJSON(respPb); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		frame := new(pb.RoomDownsyncFrame)
+		if err := proto.Unmarshal(respPb.Data, frame); err != nil {
+			t.Fatalf("unmarshal frame: %v", err)
+		}
+		return frame
+	}
+}
+
+func TestLoginAndPickUpTreasure(t *testing.T) {
+	stage, err := LoadStage(pacmanStagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(stage)
+	server.TooFrequentlyCaptchaGets = 1
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	defer server.Close()
+
+	loginClient := login.NewClient(httpServer.URL)
+	loginClient.Backoff = 0
+	//获取验证码太频繁不重试, 由调用方稍后再登录
+	if _, err := loginClient.Login("bot1", login.DEFAULT_PHONE_COUNTRY_CODE); !login.IsRetCode(err, login.RET_CODE_SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY) {
+		t.Fatalf("expected SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY, got %v", err)
+	}
+	token, err := loginClient.Login("bot1", login.DEFAULT_PHONE_COUNTRY_CODE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wsUrl := "ws" + strings.TrimPrefix(httpServer.URL, "http") + WS_PATH
+	if _, resp, err := websocket.DefaultDialer.Dial(wsUrl+"?intAuthToken=bad", nil); err == nil || resp == nil || resp.StatusCode != 403 {
+		t.Errorf("expected an invalid token to be rejected, got %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsUrl+"?"+url.Values{"intAuthToken": {token.IntAuthToken}, "expectedRoomId": {"3"}}.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	resp := new(wsResp)
+	heartbeat := new(heartbeatRequirements)
+	if err := conn.ReadJSON(resp); err != nil || resp.Act != "HeartbeatRequirements" || json.Unmarshal(resp.Data, heartbeat) != nil {
+		t.Fatalf("expected HeartbeatRequirements, got %v %v", resp, err)
+	}
+	if heartbeat.BoundRoomId != 3 {
+		t.Errorf("expected room 3, got %d", heartbeat.BoundRoomId)
+	}
+	conn.WriteJSON(&wsReq{MsgId: 1, Act: "PlayerBattleColliderAck"})
+
+	frame := readFrame(t, conn)
+	if frame.RefFrameId != 0 || len(frame.Treasures) != len(stage.Treasures) || frame.Players[int32(token.PlayerId)] == nil {
+		t.Fatalf("expected a full frame, got %v", frame)
+	}
+	target := stage.Treasures[0]
+	cmd := &pb.PlayerUpsyncCmd{Id: int32(token.PlayerId), X: target.X, Y: target.Y, Dir: &pb.Direction{Dx: 1}, AckingFrameId: frame.Id}
+	cmdBytes, _ := proto.Marshal(cmd)
+	reqBytes, _ := proto.Marshal(&pb.WsReq{MsgId: 1, Act: "PlayerUpsyncCmd", Data: cmdBytes})
+	if err := conn.WriteMessage(websocket.BinaryMessage, reqBytes); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		frame = readFrame(t, conn)
+		if frame.RefFrameId == 0 {
+			t.Fatalf("expected diff frames after the full one")
+		}
+		if treasure, ok := frame.Treasures[target.Id]; ok {
+			if !treasure.Removed || frame.Players[int32(token.PlayerId)].Score < target.Score {
+				t.Errorf("unexpected pickup frame %v", frame)
+			}
+			break
+		}
+	}
+	player, ok := server.Player(int32(token.PlayerId))
+	if !ok || player.Upsyncs != 1 || player.RoomId != 3 || !player.Connected {
+		t.Errorf("unexpected player snapshot %+v", player)
+	}
+}
@@ -0,0 +1,225 @@
+package fakeserver
+
+import (
+	"AI/models"
+	pb "AI/pb_output"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//下发给bot的关卡, 坐标都已转换为地图节点坐标(与RoomDownsyncFrame一致)
+type Stage struct {
+	Name              string
+	Tmx               models.TmxMap
+	ColliderInfo      *pb.BattleColliderInfo
+	StartingPositions []models.Vec2D
+	Treasures         []*pb.Treasure //每个房间开始时的宝物
+	Traps             []*pb.Trap
+	GuardTowers       []*pb.GuardTower
+}
+
+//玩家与宝物的距离不超过该值时吃掉宝物
+func (s *Stage) PickupRadius() float64 {
+	tileSize := s.Tmx.TileWidth
+	if s.Tmx.TileHeight > tileSize {
+		tileSize = s.Tmx.TileHeight
+	}
+	return float64(tileSize)*0.5 + PLAYER_RADIUS
+}
+
+//第joinIndex(从1开始)个加入房间的玩家的出生点
+func (s *Stage) StartingPosition(joinIndex int) models.Vec2D {
+	if len(s.StartingPositions) == 0 {
+		x, y := s.Tmx.GetCoordByGid(0)
+		return models.Vec2D{X: x, Y: y}
+	}
+	return s.StartingPositions[(joinIndex-1)%len(s.StartingPositions)]
+}
+
+func NewStage(colliderInfo *pb.BattleColliderInfo, startingPositions []models.Vec2D, treasures []*pb.Treasure) *Stage {
+	return &Stage{
+		Name: colliderInfo.StageName,
+		Tmx: models.TmxMap{
+			Width:      int(colliderInfo.StageDiscreteW),
+			Height:     int(colliderInfo.StageDiscreteH),
+			TileWidth:  int(colliderInfo.StageTileW),
+			TileHeight: int(colliderInfo.StageTileH),
+		},
+		ColliderInfo:      colliderInfo,
+		StartingPositions: startingPositions,
+		Treasures:         treasures,
+	}
+}
+
+type tmxFile struct {
+	Width        int              `xml:"width,attr"`
+	Height       int              `xml:"height,attr"`
+	TileWidth    int              `xml:"tilewidth,attr"`
+	TileHeight   int              `xml:"tileheight,attr"`
+	ObjectGroups []tmxObjectGroup `xml:"objectgroup"`
+}
+
+type tmxObjectGroup struct {
+	Name    string      `xml:"name,attr"`
+	Objects []tmxObject `xml:"object"`
+}
+
+type tmxObject struct {
+	X          float64       `xml:"x,attr"`
+	Y          float64       `xml:"y,attr"`
+	Properties []tmxProperty `xml:"properties>property"`
+	Polyline   *tmxPoints    `xml:"polyline"`
+	Polygon    *tmxPoints    `xml:"polygon"`
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type tmxPoints struct {
+	Points string `xml:"points,attr"`
+}
+
+func (o *tmxObject) intProperty(name string, defaultValue int) int {
+	for _, property := range o.Properties {
+		if property.Name == name {
+			if value, err := strconv.Atoi(property.Value); err == nil {
+				return value
+			}
+		}
+	}
+	return defaultValue
+}
+
+//形如"0,0 -74,78 178,330"
+func parsePoints(points string) ([]models.Vec2D, error) {
+	fields := strings.Fields(points)
+	result := make([]models.Vec2D, len(fields))
+	for i, field := range fields {
+		if _, err := fmt.Sscanf(field, "%g,%g", &result[i].X, &result[i].Y); err != nil {
+			return nil, fmt.Errorf("invalid point %q", field)
+		}
+	}
+	return result, nil
+}
+
+const (
+	TMX_GROUP_BARRIER                 = "barrier"
+	TMX_GROUP_STARTING_POS_LIST       = "controlled_players_starting_pos_list"
+	TMX_GROUP_GUARD_TOWER             = "guardTower"
+	DEFAULT_TREASURE_SCORE            = 100
+	DEFAULT_TREASURE_TYPE             = 1
+	DEFAULT_TRAP_TYPE                 = 1
+	DEFAULT_GUARD_TOWER_TYPE          = 1
+	COLLIDER_INFO_BARRIER_POLYGON_KEY = "Barrier"
+)
+
+//读取map/map下的isometric tmx关卡: barrier中的折线/多边形作为障碍物, 名字含treasure/trap的对象层作为宝物/陷阱
+func LoadStage(tmxPath string) (*Stage, error) {
+	content, err := ioutil.ReadFile(tmxPath)
+	if err != nil {
+		return nil, err
+	}
+	file := new(tmxFile)
+	if err := xml.Unmarshal(content, file); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", tmxPath, err)
+	}
+	if file.Width <= 0 || file.Height <= 0 || file.TileWidth <= 0 || file.TileHeight <= 0 {
+		return nil, fmt.Errorf("%s: invalid map size", tmxPath)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(tmxPath), filepath.Ext(tmxPath))
+	if name == "map" {
+		name = filepath.Base(filepath.Dir(tmxPath))
+	}
+	tmx := models.TmxMap{
+		Width:      file.Width,
+		Height:     file.Height,
+		TileWidth:  file.TileWidth,
+		TileHeight: file.TileHeight,
+	}
+	barriers := new(pb.Polygon2DList)
+	var startingPositions []models.Vec2D
+	var treasures []*pb.Treasure
+	var traps []*pb.Trap
+	var guardTowers []*pb.GuardTower
+	for _, group := range file.ObjectGroups {
+		for _, object := range group.Objects {
+			anchor := models.Vec2D{X: object.X, Y: object.Y}
+			anchorInMap := tmx.ObjectLayerCoordToMapNodeCoord(anchor)
+			switch {
+			case group.Name == TMX_GROUP_BARRIER:
+				points := object.Polyline
+				if points == nil {
+					points = object.Polygon
+				}
+				if points == nil {
+					continue
+				}
+				offsets, err := parsePoints(points.Points)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", tmxPath, err)
+				}
+				polygon := &pb.Polygon2D{
+					Anchor: &pb.Vec2D{X: anchorInMap.X, Y: anchorInMap.Y},
+				}
+				for _, offset := range offsets {
+					//锚点之外的顶点是相对锚点的偏移, 只做线性变换
+					pointInMap := tmx.ObjectLayerCoordToMapNodeCoord(models.Vec2D{X: anchor.X + offset.X, Y: anchor.Y + offset.Y})
+					polygon.Points = append(polygon.Points, &pb.Vec2D{X: pointInMap.X - anchorInMap.X, Y: pointInMap.Y - anchorInMap.Y})
+				}
+				barriers.Polygon2DList = append(barriers.Polygon2DList, polygon)
+			case group.Name == TMX_GROUP_STARTING_POS_LIST:
+				startingPositions = append(startingPositions, anchorInMap)
+			case group.Name == TMX_GROUP_GUARD_TOWER:
+				id := int32(len(guardTowers) + 1)
+				guardTowers = append(guardTowers, &pb.GuardTower{
+					Id:              id,
+					LocalIdInBattle: id,
+					Type:            int32(object.intProperty("type", DEFAULT_GUARD_TOWER_TYPE)),
+					X:               anchorInMap.X,
+					Y:               anchorInMap.Y,
+				})
+			case strings.Contains(strings.ToLower(group.Name), "trap"):
+				id := int32(len(traps) + 1)
+				traps = append(traps, &pb.Trap{
+					Id:              id,
+					LocalIdInBattle: id,
+					Type:            int32(object.intProperty("type", DEFAULT_TRAP_TYPE)),
+					X:               anchorInMap.X,
+					Y:               anchorInMap.Y,
+				})
+			case strings.Contains(strings.ToLower(group.Name), "treasure"):
+				id := int32(len(treasures) + 1)
+				treasures = append(treasures, &pb.Treasure{
+					Id:              id,
+					LocalIdInBattle: id,
+					Score:           int32(object.intProperty("score", DEFAULT_TREASURE_SCORE)),
+					Type:            int32(object.intProperty("type", DEFAULT_TREASURE_TYPE)),
+					X:               anchorInMap.X,
+					Y:               anchorInMap.Y,
+				})
+			}
+		}
+	}
+
+	colliderInfo := &pb.BattleColliderInfo{
+		StageName:      name,
+		StageDiscreteW: int32(tmx.Width),
+		StageDiscreteH: int32(tmx.Height),
+		StageTileW:     int32(tmx.TileWidth),
+		StageTileH:     int32(tmx.TileHeight),
+		StrToPolygon2DListMap: map[string]*pb.Polygon2DList{
+			COLLIDER_INFO_BARRIER_POLYGON_KEY: barriers,
+		},
+	}
+	stage := NewStage(colliderInfo, startingPositions, treasures)
+	stage.Traps = traps
+	stage.GuardTowers = guardTowers
+	return stage, nil
+}
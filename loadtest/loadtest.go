@@ -0,0 +1,142 @@
+//压测: 按给定的节奏派出大量bot分布到多个房间, 统计连接成功率, 下行帧抖动(不是延迟), 消息速率和错误
+package loadtest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_BOTS          = 100
+	DEFAULT_BOTS_PER_ROOM = 2
+	DEFAULT_FIRST_ROOM_ID = 1
+	DEFAULT_RAMP_UP       = 30 * time.Second
+	DEFAULT_DURATION      = 60 * time.Second
+)
+
+//Name由调用方解释, 如线上AI或它的变体
+type Behaviour struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+type Config struct {
+	Bots        int           `json:"bots"`
+	BotsPerRoom int           `json:"botsPerRoom"`
+	FirstRoomId int           `json:"firstRoomId"` //第i个bot进入FirstRoomId + i/BotsPerRoom号房间
+	RampUp      time.Duration `json:"rampUp"`      //第一个和最后一个bot开始连接的间隔, 其余均匀分布在其中
+	ConnectRate float64       `json:"connectRate"` //每秒最多开始连接的bot数, 为0时不限制
+	Duration    time.Duration `json:"duration"`    //每个bot在房间中停留的时间
+	Mix         []Behaviour   `json:"mix"`         //按权重交错分配给各个bot
+	Shard       string        `json:"shard"`       //为空时按房间号推断
+	Tag         string        `json:"tag"`         //只使用带该tag的bot账号
+}
+
+func DefaultConfig(behaviour string) Config {
+	return Config{
+		Bots:        DEFAULT_BOTS,
+		BotsPerRoom: DEFAULT_BOTS_PER_ROOM,
+		FirstRoomId: DEFAULT_FIRST_ROOM_ID,
+		RampUp:      DEFAULT_RAMP_UP,
+		Duration:    DEFAULT_DURATION,
+		Mix:         []Behaviour{{Name: behaviour, Weight: 1}},
+	}
+}
+
+//形如"client:8,idle:2", 省略权重时为1
+func ParseMix(s string) ([]Behaviour, error) {
+	var mix []Behaviour
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		behaviour := Behaviour{Name: item, Weight: 1}
+		if i := strings.LastIndex(item, ":"); i >= 0 {
+			weight, err := strconv.Atoi(item[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight of behaviour %q", item)
+			}
+			behaviour.Name, behaviour.Weight = strings.TrimSpace(item[:i]), weight
+		}
+		mix = append(mix, behaviour)
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("empty behaviour mix")
+	}
+	return mix, nil
+}
+
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.Bots > 0, "bots must be positive")
+	check(c.BotsPerRoom > 0, "botsPerRoom must be positive")
+	check(c.FirstRoomId > 0, "firstRoomId must be positive")
+	check(c.RampUp >= 0, "rampUp must not be negative")
+	check(c.ConnectRate >= 0, "connectRate must not be negative")
+	check(c.Duration > 0, "duration must be positive")
+	check(len(c.Mix) > 0, "the behaviour mix is empty")
+	names := make(map[string]bool)
+	for _, behaviour := range c.Mix {
+		check(behaviour.Name != "" && !names[behaviour.Name], "behaviour %q is empty or duplicated", behaviour.Name)
+		check(behaviour.Weight > 0, "weight of behaviour %q must be positive", behaviour.Name)
+		names[behaviour.Name] = true
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid load test: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+//第Index个bot进入的房间, 行为以及相对压测开始的连接时间
+type Plan struct {
+	Index     int
+	RoomId    int
+	Behaviour string
+	StartAt   time.Duration
+}
+
+//连接时间取RampUp均匀分布和ConnectRate限制中较晚的一个. 行为按平滑加权轮询分配, 每个房间里尽量混合不同的行为
+func (c *Config) Plan() []Plan {
+	plans := make([]Plan, c.Bots)
+	current := make([]int, len(c.Mix))
+	total := 0
+	for _, behaviour := range c.Mix {
+		total += behaviour.Weight
+	}
+	for i := range plans {
+		best := 0
+		for j, behaviour := range c.Mix {
+			current[j] += behaviour.Weight
+			if current[j] > current[best] {
+				best = j
+			}
+		}
+		current[best] -= total
+
+		var startAt time.Duration
+		if c.Bots > 1 {
+			startAt = c.RampUp * time.Duration(i) / time.Duration(c.Bots-1)
+		}
+		if c.ConnectRate > 0 {
+			if limited := time.Duration(float64(i) / c.ConnectRate * float64(time.Second)); limited > startAt {
+				startAt = limited
+			}
+		}
+		plans[i] = Plan{
+			Index:     i,
+			RoomId:    c.FirstRoomId + i/c.BotsPerRoom,
+			Behaviour: c.Mix[best].Name,
+			StartAt:   startAt,
+		}
+	}
+	return plans
+}
@@ -0,0 +1,136 @@
+package loadtest
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("client:8, idle ,patient:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Behaviour{{"client", 8}, {"idle", 1}, {"patient", 2}}
+	if len(mix) != len(expected) {
+		t.Fatalf("unexpected mix %v", mix)
+	}
+	for i := range mix {
+		if mix[i] != expected[i] {
+			t.Errorf("unexpected behaviour %d %v", i, mix[i])
+		}
+	}
+	for _, invalid := range []string{"", " , ", "client:x"} {
+		if _, err := ParseMix(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := DefaultConfig("client")
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Bots = 0
+	cfg.Duration = 0
+	cfg.Mix = []Behaviour{{"client", 1}, {"client", 0}}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "bots") || !strings.Contains(err.Error(), "duration") || !strings.Contains(err.Error(), "duplicated") || !strings.Contains(err.Error(), "weight") {
+		t.Errorf("expected all problems to be reported, got %v", err)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	cfg := DefaultConfig("client")
+	cfg.Bots = 7
+	cfg.BotsPerRoom = 3
+	cfg.FirstRoomId = 100
+	cfg.RampUp = 6 * time.Second
+	cfg.Mix = []Behaviour{{"client", 2}, {"idle", 1}}
+	plans := cfg.Plan()
+	if len(plans) != 7 {
+		t.Fatalf("expected 7 plans, got %d", len(plans))
+	}
+	var behaviours []string
+	for i, plan := range plans {
+		if plan.Index != i || plan.RoomId != 100+i/3 || plan.StartAt != time.Duration(i)*time.Second {
+			t.Errorf("unexpected plan %+v", plan)
+		}
+		behaviours = append(behaviours, plan.Behaviour)
+	}
+	//平滑加权轮询: 每3个bot中有2个client和1个idle
+	if got := strings.Join(behaviours, ","); got != "client,idle,client,client,idle,client,client" {
+		t.Errorf("unexpected behaviours %s", got)
+	}
+
+	//连接速率比RampUp更严格时以连接速率为准
+	cfg.ConnectRate = 0.5
+	if plans := cfg.Plan(); plans[1].StartAt != 2*time.Second || plans[6].StartAt != 12*time.Second {
+		t.Errorf("expected the connect rate to delay the bots, got %v and %v", plans[1].StartAt, plans[6].StartAt)
+	}
+	cfg.Bots = 1
+	if plans := cfg.Plan(); plans[0].StartAt != 0 {
+		t.Errorf("expected a single bot to start at once, got %v", plans[0].StartAt)
+	}
+}
+
+func TestStatsReport(t *testing.T) {
+	now := time.Unix(100, 0)
+	stats := NewStats(4, func() time.Time { return now })
+	for i := 0; i < 4; i++ {
+		stats.OnAttempt()
+	}
+	stats.OnSpawnFailure(errors.New("no idle bot"))
+	stats.OnLoginFailure(errors.New("timeout"))
+	stats.OnConnected()
+	stats.OnConnected()
+	stats.OnEarlyDisconnect()
+	for i := int64(1); i <= 100; i++ {
+		stats.OnDownsyncFrame(i, true)
+	}
+	stats.OnDownsyncFrame(0, false)
+	stats.OnDownsyncFrame(maxJitterMillis*2, true)
+	for i := 0; i < 50; i++ {
+		stats.OnUpsync()
+	}
+	stats.OnError("write", errors.New("broken pipe"))
+	stats.OnError("write", errors.New("broken pipe"))
+	now = now.Add(2 * time.Second)
+	stats.Finish()
+	now = now.Add(time.Hour)
+
+	report := stats.Report()
+	if report.Attempts != 4 || report.Connected != 2 || report.ConnectionSuccessRate != 0.5 || report.SpawnFailures != 1 || report.LoginFailures != 1 || report.EarlyDisconnects != 1 {
+		t.Errorf("unexpected connection stats %+v", report)
+	}
+	if !report.Finished || report.Elapsed != 2*time.Second || report.DownsyncFrames != 102 || report.DownsyncFramesPerSecond != 51 || report.UpsyncsPerSecond != 25 {
+		t.Errorf("unexpected rates %+v", report)
+	}
+	if report.FrameJitterMillis != (Percentiles{P50: 51, P90: 91, P99: 100, Max: maxJitterMillis}) {
+		t.Errorf("unexpected frame jitter %+v", report.FrameJitterMillis)
+	}
+	if report.TotalErrors != 4 || report.Errors[0] != (ErrorCount{"write: broken pipe", 2}) {
+		t.Errorf("unexpected errors %+v", report.Errors)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	for _, line := range []string{"2 (50.0%), 1 spawn failures", "p50 51ms", "2 write: broken pipe"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in the report:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestNilStats(t *testing.T) {
+	var stats *Stats
+	stats.OnAttempt()
+	stats.OnConnected()
+	stats.OnDownsyncFrame(1, true)
+	stats.OnUpsync()
+	stats.OnError("decode", errors.New("bad frame"))
+	stats.Finish()
+}
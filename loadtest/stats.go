@@ -0,0 +1,282 @@
+package loadtest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+//下行帧抖动按1ms分桶统计, 超过上限的计入最后一个桶
+const maxJitterMillis = 10000
+
+//报告中最多列出的错误种类, 按次数从多到少
+const maxReportedErrors = 20
+
+//一次压测的统计, 可在任意goroutine中调用. 所有方法对nil无副作用, 不压测时bot不需要判断
+type Stats struct {
+	mutex            sync.Mutex
+	now              func() time.Time
+	startedAt        time.Time
+	finishedAt       time.Time
+	bots             int
+	attempts         int
+	spawnFailures    int
+	loginFailures    int
+	dialFailures     int
+	connected        int
+	earlyDisconnects int
+	downsyncFrames   int64
+	upsyncs          int64
+	jitterSamples    int64
+	jitters          [maxJitterMillis + 1]int64
+	errors           map[string]int
+}
+
+//now为nil时取time.Now
+func NewStats(bots int, now func() time.Time) *Stats {
+	if now == nil {
+		now = time.Now
+	}
+	return &Stats{
+		now:       now,
+		startedAt: now(),
+		bots:      bots,
+		errors:    make(map[string]int),
+	}
+}
+
+func (s *Stats) addError(kind string, err error) {
+	s.errors[kind+": "+err.Error()]++
+}
+
+//开始派出一个bot
+func (s *Stats) OnAttempt() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attempts++
+}
+
+//没有空闲的bot账号等, 未能开始登录
+func (s *Stats) OnSpawnFailure(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.spawnFailures++
+	s.addError("spawn", err)
+}
+
+func (s *Stats) OnLoginFailure(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.loginFailures++
+	s.addError("login", err)
+}
+
+func (s *Stats) OnDialFailure(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dialFailures++
+	s.addError("dial", err)
+}
+
+func (s *Stats) OnConnected() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.connected++
+}
+
+//服务器在bot寿命结束前断开了连接
+func (s *Stats) OnEarlyDisconnect() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.earlyDisconnects++
+}
+
+//jitterMillis见models.TickScheduler.FrameJitterMillis, ok为false时只计数
+func (s *Stats) OnDownsyncFrame(jitterMillis int64, ok bool) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.downsyncFrames++
+	if !ok {
+		return
+	}
+	if jitterMillis < 0 {
+		jitterMillis = 0
+	}
+	if jitterMillis > maxJitterMillis {
+		jitterMillis = maxJitterMillis
+	}
+	s.jitters[jitterMillis]++
+	s.jitterSamples++
+}
+
+func (s *Stats) OnUpsync() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.upsyncs++
+}
+
+//连接建立之后的其他错误, 如解码或写入失败
+func (s *Stats) OnError(kind string, err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addError(kind, err)
+}
+
+//所有bot结束后调用, 之后的Report以此为止计算速率
+func (s *Stats) Finish() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.finishedAt.IsZero() {
+		s.finishedAt = s.now()
+	}
+}
+
+type Percentiles struct {
+	P50 int64 `json:"p50"`
+	P90 int64 `json:"p90"`
+	P99 int64 `json:"p99"`
+	Max int64 `json:"max"`
+}
+
+type ErrorCount struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+type Report struct {
+	Bots                    int           `json:"bots"`
+	Attempts                int           `json:"attempts"`
+	SpawnFailures           int           `json:"spawnFailures"`
+	LoginFailures           int           `json:"loginFailures"`
+	DialFailures            int           `json:"dialFailures"`
+	Connected               int           `json:"connected"`
+	EarlyDisconnects        int           `json:"earlyDisconnects"`
+	ConnectionSuccessRate   float64       `json:"connectionSuccessRate"` //Connected / Attempts
+	Elapsed                 time.Duration `json:"elapsed"`
+	Finished                bool          `json:"finished"`
+	DownsyncFrames          int64         `json:"downsyncFrames"`
+	Upsyncs                 int64         `json:"upsyncs"`
+	DownsyncFramesPerSecond float64       `json:"downsyncFramesPerSecond"`
+	UpsyncsPerSecond        float64       `json:"upsyncsPerSecond"`
+	FrameJitterMillis       Percentiles   `json:"frameJitterMillis"` //相对于窗口内最快一帧多花的传输时间, 不是延迟, 见models.TickScheduler.FrameJitterMillis
+	Errors                  []ErrorCount  `json:"errors"`
+	TotalErrors             int           `json:"totalErrors"`
+}
+
+//压测进行中时为到目前为止的统计
+func (s *Stats) Report() Report {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	report := Report{
+		Bots:             s.bots,
+		Attempts:         s.attempts,
+		SpawnFailures:    s.spawnFailures,
+		LoginFailures:    s.loginFailures,
+		DialFailures:     s.dialFailures,
+		Connected:        s.connected,
+		EarlyDisconnects: s.earlyDisconnects,
+		Finished:         !s.finishedAt.IsZero(),
+		DownsyncFrames:   s.downsyncFrames,
+		Upsyncs:          s.upsyncs,
+	}
+	end := s.finishedAt
+	if end.IsZero() {
+		end = s.now()
+	}
+	report.Elapsed = end.Sub(s.startedAt)
+	if s.attempts > 0 {
+		report.ConnectionSuccessRate = float64(s.connected) / float64(s.attempts)
+	}
+	if seconds := report.Elapsed.Seconds(); seconds > 0 {
+		report.DownsyncFramesPerSecond = float64(s.downsyncFrames) / seconds
+		report.UpsyncsPerSecond = float64(s.upsyncs) / seconds
+	}
+	report.FrameJitterMillis = s.percentiles()
+	for message, count := range s.errors {
+		report.Errors = append(report.Errors, ErrorCount{Error: message, Count: count})
+		report.TotalErrors += count
+	}
+	sort.Slice(report.Errors, func(i, j int) bool {
+		if report.Errors[i].Count != report.Errors[j].Count {
+			return report.Errors[i].Count > report.Errors[j].Count
+		}
+		return report.Errors[i].Error < report.Errors[j].Error
+	})
+	if len(report.Errors) > maxReportedErrors {
+		report.Errors = report.Errors[:maxReportedErrors]
+	}
+	return report
+}
+
+//每个分位数取第一个累计数达到该比例的桶
+func (s *Stats) percentiles() Percentiles {
+	var p Percentiles
+	if s.jitterSamples == 0 {
+		return p
+	}
+	targets := []struct {
+		ratio float64
+		value *int64
+	}{{0.5, &p.P50}, {0.9, &p.P90}, {0.99, &p.P99}, {1, &p.Max}}
+	var cumulative int64
+	next := 0
+	for millis, count := range s.jitters {
+		if count == 0 {
+			continue
+		}
+		cumulative += count
+		for next < len(targets) && float64(cumulative) >= targets[next].ratio*float64(s.jitterSamples) {
+			*targets[next].value = int64(millis)
+			next++
+		}
+	}
+	return p
+}
+
+func (r *Report) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "bots\t%d, %d attempted, elapsed %v\n", r.Bots, r.Attempts, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "connected\t%d (%.1f%%), %d spawn failures, %d login failures, %d dial failures, %d early disconnects\n",
+		r.Connected, r.ConnectionSuccessRate*100, r.SpawnFailures, r.LoginFailures, r.DialFailures, r.EarlyDisconnects)
+	fmt.Fprintf(w, "downsync\t%d frames, %.1f/s\n", r.DownsyncFrames, r.DownsyncFramesPerSecond)
+	fmt.Fprintf(w, "upsync\t%d commands, %.1f/s\n", r.Upsyncs, r.UpsyncsPerSecond)
+	fmt.Fprintf(w, "frame jitter (not latency)\tp50 %dms, p90 %dms, p99 %dms, max %dms\n", r.FrameJitterMillis.P50, r.FrameJitterMillis.P90, r.FrameJitterMillis.P99, r.FrameJitterMillis.Max)
+	fmt.Fprintf(w, "errors\t%d\n", r.TotalErrors)
+	for _, e := range r.Errors {
+		fmt.Fprintf(w, "\t%5d %s\n", e.Count, e.Error)
+	}
+	w.Flush()
+}
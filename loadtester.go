@@ -0,0 +1,285 @@
+package main
+
+import (
+	"AI/loadtest"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+//在STRATEGY_CLIENT和配置文件中的AI变体之外, 压测还可以使用的行为
+const BEHAVIOUR_IDLE = "idle"
+
+var errLoadTestRunning = errors.New("A load test is already running")
+
+//一次压测, 同一时间只能有一个
+type loadTestRun struct {
+	config loadtest.Config
+	stats  *loadtest.Stats
+	cancel context.CancelFunc
+	done   chan struct{} //所有bot结束后关闭
+}
+
+func (run *loadTestRun) running() bool {
+	select {
+	case <-run.done:
+		return false
+	default:
+		return true
+	}
+}
+
+//压测中的bot不录像, UpsyncEncoding在派出时按分片决定
+func (server *botServer) behaviourOptions(name string, lifetime time.Duration) (spawnBotOptions, error) {
+	options := spawnBotOptions{
+		UpsyncRate: server.config.Tick.UpsyncRate,
+		Ai:         server.config.Ai,
+		Lifetime:   lifetime,
+	}
+	switch name {
+	case STRATEGY_CLIENT:
+	case BEHAVIOUR_IDLE:
+		options.Idle = true
+	default:
+		ai, ok := server.config.Strategies[name]
+		if !ok {
+			return options, fmt.Errorf("unknown behaviour %q, expected %s, %s or a strategy of the config", name, STRATEGY_CLIENT, BEHAVIOUR_IDLE)
+		}
+		options.Ai = ai
+	}
+	return options, nil
+}
+
+//校验配置后在后台开始压测
+func (server *botServer) startLoadTest(cfg loadtest.Config) (*loadTestRun, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	options := make(map[string]spawnBotOptions, len(cfg.Mix))
+	for _, behaviour := range cfg.Mix {
+		behaviourOptions, err := server.behaviourOptions(behaviour.Name, cfg.Duration)
+		if err != nil {
+			return nil, err
+		}
+		options[behaviour.Name] = behaviourOptions
+	}
+
+	server.loadTestMutex.Lock()
+	defer server.loadTestMutex.Unlock()
+	if server.loadTest != nil && server.loadTest.running() {
+		return nil, errLoadTestRunning
+	}
+	ctx, cancel := context.WithCancel(server.ctx)
+	run := &loadTestRun{
+		config: cfg,
+		stats:  loadtest.NewStats(cfg.Bots, nil),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	for name, behaviourOptions := range options {
+		behaviourOptions.Stats = run.stats
+		options[name] = behaviourOptions
+	}
+	server.loadTest = run
+	go server.runLoadTest(ctx, run, options)
+	return run, nil
+}
+
+func (server *botServer) currentLoadTest() *loadTestRun {
+	server.loadTestMutex.Lock()
+	defer server.loadTestMutex.Unlock()
+	return server.loadTest
+}
+
+//按计划派出bot, 等待它们全部结束. ctx结束时不再派出新的bot, 已派出的随之断开
+func (server *botServer) runLoadTest(ctx context.Context, run *loadTestRun, options map[string]spawnBotOptions) {
+	defer close(run.done)
+	defer run.cancel()
+	cfg := run.config
+	//与配置中bot寿命和lease超时之间的余量相同
+	leaseTimeout := cfg.Duration + server.config.Bot.LeaseTimeout - server.config.Bot.Lifetime
+	zap.L().Info("Load test started", zap.Any("config", cfg))
+
+	startedAt := time.Now()
+	var bots sync.WaitGroup
+	for _, plan := range cfg.Plan() {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Until(startedAt.Add(plan.StartAt))):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		run.stats.OnAttempt()
+		s, err := findShard(server.shards, cfg.Shard, plan.RoomId)
+		if err != nil {
+			run.stats.OnSpawnFailure(err)
+			continue
+		}
+		if err := server.beginSpawn(1); err != nil {
+			run.stats.OnSpawnFailure(err)
+			break
+		}
+		lease, err := s.botManager.AcquireBot(plan.RoomId, cfg.Tag, leaseTimeout)
+		if err != nil {
+			server.spawns.Add(-1)
+			run.stats.OnSpawnFailure(err)
+			continue
+		}
+		botOptions := options[plan.Behaviour]
+		botOptions.UpsyncEncoding = s.config.UpsyncEncoding
+		bots.Add(1)
+		go func() {
+			defer bots.Done()
+			server.spawnBot(ctx, s, lease, botOptions)
+		}()
+	}
+	bots.Wait()
+	run.stats.Finish()
+	zap.L().Info("Load test finished", zap.Duration("elapsed", time.Since(startedAt)))
+}
+
+//query中省略的参数取loadtest.DefaultConfig
+func parseLoadTestConfig(c *gin.Context) (loadtest.Config, error) {
+	cfg := loadtest.DefaultConfig(STRATEGY_CLIENT)
+	ints := map[string]*int{
+		"bots":        &cfg.Bots,
+		"botsPerRoom": &cfg.BotsPerRoom,
+		"firstRoomId": &cfg.FirstRoomId,
+	}
+	for key, value := range ints {
+		if s := c.Query(key); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s %q", key, s)
+			}
+			*value = n
+		}
+	}
+	durations := map[string]*time.Duration{
+		"rampUp":   &cfg.RampUp,
+		"duration": &cfg.Duration,
+	}
+	for key, value := range durations {
+		if s := c.Query(key); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s %q", key, s)
+			}
+			*value = d
+		}
+	}
+	if s := c.Query("connectRate"); s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid connectRate %q", s)
+		}
+		cfg.ConnectRate = rate
+	}
+	if s := c.Query("mix"); s != "" {
+		mix, err := loadtest.ParseMix(s)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Mix = mix
+	}
+	cfg.Shard = c.Query("shard")
+	cfg.Tag = c.Query("tag")
+	return cfg, nil
+}
+
+func (server *botServer) handleStartLoadTest(c *gin.Context) {
+	cfg, err := parseLoadTestConfig(c)
+	if err == nil {
+		_, err = server.startLoadTest(cfg)
+	}
+	if err != nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"ret":    RET_OK,
+		"config": cfg,
+	})
+}
+
+//压测进行中时report为到目前为止的统计
+func (server *botServer) handleLoadTestStatus(c *gin.Context) {
+	run := server.currentLoadTest()
+	if run == nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "No load test has been started",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"ret":     RET_OK,
+		"running": run.running(),
+		"config":  run.config,
+		"report":  run.stats.Report(),
+	})
+}
+
+//断开压测中的所有bot, 等待它们退出后返回最终的报告
+func (server *botServer) handleStopLoadTest(c *gin.Context) {
+	run := server.currentLoadTest()
+	if run == nil {
+		c.JSON(200, gin.H{
+			"ret": RET_FAILED,
+			"err": "No load test has been started",
+		})
+		return
+	}
+	run.cancel()
+	<-run.done
+	c.JSON(200, gin.H{
+		"ret":    RET_OK,
+		"report": run.stats.Report(),
+	})
+}
+
+//-loadTest: 不启动http服务, 压测结束或收到SIGINT/SIGTERM后打印报告, reportPath不为空时另外写入json格式的报告
+func (server *botServer) runLoadTestCli(loadTestConfig loadtest.Config, reportPath string, out io.Writer) error {
+	run, err := server.startLoadTest(loadTestConfig)
+	if err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(interrupt)
+	select {
+	case <-run.done:
+	case sig := <-interrupt:
+		zap.L().Info("Stopping the load test", zap.Stringer("signal", sig))
+		run.cancel()
+		<-run.done
+	}
+	server.shutdown(server.config.Shutdown.Deadline)
+
+	report := run.stats.Report()
+	report.Print(out)
+	if reportPath != "" {
+		bytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(reportPath, bytes, 0644)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"AI/fakeserver"
+	"AI/loadtest"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//7个bot只有6个账号, 最后一个派出失败; idle的bot连接后不移动
+func TestLoadTestAgainstFakeServer(t *testing.T) {
+	stage, err := fakeserver.LoadStage("map/map/pacman/map.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameServer, gameHttpServer := startFakeServer(stage)
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	server := newTestBotServer(t, gameHttpServer.URL, "bot1", "bot2", "bot3", "bot4", "bot5", "bot6")
+	cfg := loadtest.DefaultConfig(STRATEGY_CLIENT)
+	cfg.Bots = 7
+	cfg.FirstRoomId = 10
+	cfg.RampUp = 300 * time.Millisecond
+	cfg.Duration = 1500 * time.Millisecond
+	cfg.Mix = []loadtest.Behaviour{{Name: STRATEGY_CLIENT, Weight: 2}, {Name: BEHAVIOUR_IDLE, Weight: 1}}
+
+	var out bytes.Buffer
+	if err := server.runLoadTestCli(cfg, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	report := server.currentLoadTest().stats.Report()
+	if !report.Finished || report.Attempts != 7 || report.Connected != 6 || report.SpawnFailures != 1 || report.EarlyDisconnects != 0 {
+		t.Errorf("unexpected connection stats %+v", report)
+	}
+	if report.DownsyncFrames == 0 || report.Upsyncs == 0 || report.FrameJitterMillis.Max == 0 {
+		t.Errorf("expected frames and upsyncs, got %+v", report)
+	}
+	if report.TotalErrors != 1 || !strings.HasPrefix(report.Errors[0].Error, "spawn: ") {
+		t.Errorf("expected only the spawn failure, got %+v", report.Errors)
+	}
+	if !strings.Contains(out.String(), "6 (85.7%)") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	rooms := make(map[int]int)
+	for _, player := range gameServer.Players() {
+		rooms[player.RoomId]++
+	}
+	if len(rooms) != 3 || rooms[10] != 2 || rooms[11] != 2 || rooms[12] != 2 {
+		t.Errorf("unexpected rooms %v", rooms)
+	}
+	if busy, idle := server.shards[0].botManager.Stats(); busy != 0 || idle != 6 {
+		t.Errorf("expected all bots to be released, got busy %d idle %d", busy, idle)
+	}
+}
+
+type loadTestResponse struct {
+	Ret     int             `json:"ret"`
+	Err     string          `json:"err"`
+	Running bool            `json:"running"`
+	Report  loadtest.Report `json:"report"`
+}
+
+func serveLoadTestApi(t *testing.T, r *gin.Engine, path string) loadTestResponse {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	var resp loadTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: %v %s", path, err, w.Body.String())
+	}
+	return resp
+}
+
+func TestLoadTestApi(t *testing.T) {
+	stage, err := fakeserver.LoadStage("map/map/pacman/map.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gameServer, gameHttpServer := startFakeServer(stage)
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	server := newTestBotServer(t, gameHttpServer.URL, "bot1", "bot2")
+	defer server.shutdown(3 * time.Second)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	server.registerApi(r)
+
+	if resp := serveLoadTestApi(t, r, "/loadTest/status"); resp.Ret != RET_FAILED {
+		t.Errorf("expected no load test, got %+v", resp)
+	}
+	for _, query := range []string{"bots=x", "mix=client:0", "mix=unknown"} {
+		if resp := serveLoadTestApi(t, r, "/loadTest/start?"+query); resp.Ret != RET_FAILED {
+			t.Errorf("expected %s to be rejected, got %+v", query, resp)
+		}
+	}
+	if resp := serveLoadTestApi(t, r, "/loadTest/start?bots=2&rampUp=0s&duration=1m&mix=idle"); resp.Ret != RET_OK {
+		t.Fatalf("start: %+v", resp)
+	}
+	if resp := serveLoadTestApi(t, r, "/loadTest/start?bots=2"); resp.Ret != RET_FAILED || resp.Err != errLoadTestRunning.Error() {
+		t.Errorf("expected a second load test to be rejected, got %+v", resp)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	var resp loadTestResponse
+	for time.Now().Before(deadline) {
+		resp = serveLoadTestApi(t, r, "/loadTest/status")
+		if resp.Report.Connected == 2 && resp.Report.DownsyncFrames > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !resp.Running || resp.Report.Finished || resp.Report.Connected != 2 {
+		t.Fatalf("expected a running load test with 2 bots, got %+v", resp)
+	}
+
+	resp = serveLoadTestApi(t, r, "/loadTest/stop")
+	if resp.Ret != RET_OK || !resp.Report.Finished || resp.Report.Elapsed > 10*time.Second {
+		t.Errorf("expected the load test to stop early, got %+v", resp)
+	}
+	if busy, _ := server.shards[0].botManager.Stats(); busy != 0 {
+		t.Errorf("expected all bots to be released, got %d busy", busy)
+	}
+	if resp := serveLoadTestApi(t, r, "/loadTest/status"); resp.Ret != RET_OK || resp.Running {
+		t.Errorf("expected a stopped load test, got %+v", resp)
+	}
+}
@@ -0,0 +1,278 @@
+//按大小和时间轮转的日志文件. 轮转出的文件名为"<path>.20060102-150405.000", 可选在后台压缩为.gz
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	BACKUP_TIME_FORMAT    = "20060102-150405.000"
+	ROTATE_RETRY_INTERVAL = 10 * time.Second //轮转失败后至少隔这么久再试, 不在每次写入时都重试
+)
+
+type Config struct {
+	MaxSize    int64         //字节, 写入后超过时轮转, 为0时不按大小轮转
+	Interval   time.Duration //跨过Interval的整数倍时轮转, 如每小时整点, 为0时不按时间轮转
+	MaxBackups int           //保留的轮转文件数, 为0时全部保留
+	Compress   bool
+}
+
+//可在多个goroutine中调用. 所有方法对nil无副作用, 输出到stdout时不需要判断
+type Writer struct {
+	path     string
+	config   Config
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time //按时间轮转时以此判断所在的区间, 打开已有文件时取其修改时间
+	now      func() time.Time
+	rename   func(oldpath, newpath string) error
+
+	rotateErr     error //最近一次轮转的错误, 轮转成功后清空
+	retryRotateAt time.Time
+
+	background sync.Mutex     //压缩和清理依次进行
+	pending    sync.WaitGroup //Close时等待
+}
+
+func Open(path string, config Config) (*Writer, error) {
+	w := &Writer{
+		path:   path,
+		config: config,
+		now:    time.Now,
+		rename: os.Rename,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+//失败时保留原来的w.file
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.openedAt = info.ModTime()
+	if w.size == 0 {
+		w.openedAt = w.now()
+	}
+	return nil
+}
+
+func (w *Writer) shouldRotate(n int) bool {
+	if w.size == 0 || w.now().Before(w.retryRotateAt) {
+		return false
+	}
+	if w.config.MaxSize > 0 && w.size+int64(n) > w.config.MaxSize {
+		return true
+	}
+	return w.config.Interval > 0 && !w.now().Truncate(w.config.Interval).Equal(w.openedAt.Truncate(w.config.Interval))
+}
+
+//一次写入不会被拆到两个文件中, 所以单条超过MaxSize的日志也完整地写在一个文件里.
+//轮转失败时继续写原来的文件, 错误写到stderr并由RotateErr返回, 不让日志就此中断
+func (w *Writer) Write(p []byte) (int, error) {
+	if w == nil {
+		return len(p), nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if w.shouldRotate(len(p)) {
+		w.rotateErr = w.rotate()
+		if w.rotateErr != nil {
+			w.retryRotateAt = w.now().Add(ROTATE_RETRY_INTERVAL)
+			fmt.Fprintf(os.Stderr, "logfile: rotate %s: %v\n", w.path, w.rotateErr)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) Sync() error {
+	if w == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	return w.file.Sync()
+}
+
+//先改名再打开新文件, 都成功后才关闭旧文件, 任何一步失败时w.file仍可写入
+func (w *Writer) rotate() error {
+	backup := w.backupName(w.now())
+	old := w.file
+	if err := w.rename(w.path, backup); err != nil {
+		//文件已被外部移走或删除(连同目录)时没有可轮转的内容, 能打开新文件就改写新文件
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if err := w.open(); err != nil {
+			return err
+		}
+		old.Close()
+		return nil
+	}
+	if err := w.open(); err != nil {
+		//改回原名, 继续写旧文件
+		w.rename(backup, w.path)
+		return err
+	}
+	old.Close()
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		w.background.Lock()
+		defer w.background.Unlock()
+		if w.config.Compress {
+			compress(backup)
+		}
+		w.prune()
+	}()
+	return nil
+}
+
+//同一毫秒内多次轮转时往后顺延, 不覆盖已有的文件
+func (w *Writer) backupName(t time.Time) string {
+	for {
+		backup := w.path + "." + t.Format(BACKUP_TIME_FORMAT)
+		if !exists(backup) && !exists(backup+".gz") {
+			return backup
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+//压缩失败时保留原文件
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+//轮转出的文件, 从旧到新
+func (w *Writer) Backups() ([]string, error) {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	prefix := w.path + "."
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ".gz")
+		if _, err := time.Parse(BACKUP_TIME_FORMAT, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	//时间格式按字典序即按时间排序
+	sort.Strings(backups)
+	return backups, nil
+}
+
+func (w *Writer) prune() {
+	if w.config.MaxBackups <= 0 {
+		return
+	}
+	backups, err := w.Backups()
+	if err != nil {
+		return
+	}
+	for len(backups) > w.config.MaxBackups {
+		os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+//最近一次轮转的错误, 没有失败过或之后轮转成功时为nil
+func (w *Writer) RotateErr() error {
+	if w == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.rotateErr
+}
+
+//重新打开path, 用于文件被外部移走之后(SIGHUP). 打开失败时继续写原来的文件
+func (w *Writer) Reopen() error {
+	if w == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+//等待后台的压缩和清理结束
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mutex.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mutex.Unlock()
+	w.pending.Wait()
+	return err
+}
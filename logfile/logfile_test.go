@@ -0,0 +1,200 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func tempLog(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "bot.log"), func() { os.RemoveAll(dir) }
+}
+
+func readFile(t *testing.T, path string) string {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes)
+}
+
+func TestRotateBySize(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	w, err := Open(path, Config{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "a line longer than 10 bytes\n", "last\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "last\n" {
+		t.Errorf("unexpected current log %q", got)
+	}
+	backups, err := w.Backups()
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("expected the 2 newest backups, got %v %v", backups, err)
+	}
+	if readFile(t, backups[0]) != "third\n" || readFile(t, backups[1]) != "a line longer than 10 bytes\n" {
+		t.Errorf("unexpected backups %q and %q", readFile(t, backups[0]), readFile(t, backups[1]))
+	}
+	if _, err := w.Write([]byte("closed\n")); err == nil {
+		t.Errorf("expected writing a closed log to fail")
+	}
+}
+
+func TestRotateByIntervalAndCompress(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(path, []byte("yesterday\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	yesterday := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Open(path, Config{Interval: time.Hour, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//打开时不轮转, 第一次写入时发现已跨过整点
+	w.Write([]byte("today\n"))
+	w.Write([]byte("still today\n"))
+	w.Close()
+
+	if got := readFile(t, path); got != "today\nstill today\n" {
+		t.Errorf("unexpected current log %q", got)
+	}
+	backups, _ := w.Backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], ".gz") {
+		t.Fatalf("expected a compressed backup, got %v", backups)
+	}
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes, err := ioutil.ReadAll(gz); err != nil || string(bytes) != "yesterday\n" {
+		t.Errorf("unexpected backup %q %v", bytes, err)
+	}
+}
+
+//改名失败(如跨设备, 没有权限)时继续写原来的文件, 隔ROTATE_RETRY_INTERVAL后再试
+func TestRotateFailureKeepsWriting(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	w, err := Open(path, Config{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	now := time.Now()
+	w.now = func() time.Time { return now }
+	renames := 0
+	w.rename = func(oldpath, newpath string) error {
+		renames++
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if n, err := w.Write([]byte(line)); n != len(line) || err != nil {
+			t.Fatalf("expected the write to succeed, got %d %v", n, err)
+		}
+	}
+	if renames != 1 || w.RotateErr() == nil {
+		t.Errorf("expected one failed rotation until the retry interval, got %d renames and %v", renames, w.RotateErr())
+	}
+	if got := readFile(t, path); got != "first\nsecond\nthird\n" {
+		t.Errorf("unexpected log %q", got)
+	}
+
+	w.rename = os.Rename
+	now = now.Add(ROTATE_RETRY_INTERVAL)
+	w.Write([]byte("fourth\n"))
+	backups, _ := w.Backups()
+	if w.RotateErr() != nil || len(backups) != 1 || readFile(t, backups[0]) != "first\nsecond\nthird\n" || readFile(t, path) != "fourth\n" {
+		t.Errorf("expected the retry to rotate, got %v, backups %v and log %q", w.RotateErr(), backups, readFile(t, path))
+	}
+}
+
+//日志目录被删除后写入不报错, 目录恢复后的下一次轮转改写新文件
+func TestRotateAfterDirectoryRemoved(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	w, err := Open(path, Config{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	now := time.Now()
+	w.now = func() time.Time { return now }
+	w.Write([]byte("first line\n"))
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("lost\n")); err != nil || w.RotateErr() == nil {
+		t.Fatalf("expected the write to succeed and the rotation to fail, got %v and %v", err, w.RotateErr())
+	}
+
+	if err := os.Mkdir(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(ROTATE_RETRY_INTERVAL)
+	if _, err := w.Write([]byte("recovered\n")); err != nil || w.RotateErr() != nil {
+		t.Fatalf("expected the rotation to recover, got %v and %v", err, w.RotateErr())
+	}
+	if got := readFile(t, path); got != "recovered\n" {
+		t.Errorf("unexpected log %q", got)
+	}
+}
+
+//外部把文件移走后, Reopen之前仍写入移走的文件, 之后写入新文件
+func TestReopen(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+	w, err := Open(path, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("before\n"))
+	if err := os.Rename(path, path+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("moved\n"))
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("after\n"))
+	if readFile(t, path+".moved") != "before\nmoved\n" || readFile(t, path) != "after\n" {
+		t.Errorf("unexpected logs %q and %q", readFile(t, path+".moved"), readFile(t, path))
+	}
+}
+
+func TestNilWriter(t *testing.T) {
+	var w *Writer
+	if n, err := w.Write([]byte("x")); n != 1 || err != nil {
+		t.Errorf("unexpected write %d %v", n, err)
+	}
+	if w.Reopen() != nil || w.Sync() != nil || w.Close() != nil {
+		t.Errorf("expected a nil writer to do nothing")
+	}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+//代替gin.Default()中的Logger, 请求日志和其他日志一起写到zap
+func GinLogger(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		startedAt := time.Now()
+		c.Next()
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("query", c.Request.URL.RawQuery),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("latency", time.Since(startedAt)),
+			zap.String("clientIp", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			logger.Error("Http request", fields...)
+			return
+		}
+		logger.Info("Http request", fields...)
+	}
+}
+
+//代替gin.Default()中的Recovery, handler中的panic连同堆栈记录到zap后返回500
+func GinRecovery(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Recovered from panic in http handler", zap.String("path", c.Request.URL.Path), zap.Any("panic", r), zap.String("stack", string(debug.Stack())))
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		c.Next()
+	}
+}
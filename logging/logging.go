@@ -0,0 +1,81 @@
+//按config.LogConfig创建zap.Logger. bot的日志都带有以下字段, 便于按bot, 房间或帧过滤
+package logging
+
+import (
+	"AI/config"
+	"AI/logfile"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FIELD_BOT       = "bot"
+	FIELD_PLAYER_ID = "playerId"
+	FIELD_ROOM_ID   = "roomId"
+	FIELD_FRAME_ID  = "frameId"
+	FIELD_SHARD     = "shard"
+)
+
+func Bot(name string) zap.Field {
+	return zap.String(FIELD_BOT, name)
+}
+
+func PlayerId(id int32) zap.Field {
+	return zap.Int32(FIELD_PLAYER_ID, id)
+}
+
+func RoomId(id int) zap.Field {
+	return zap.Int(FIELD_ROOM_ID, id)
+}
+
+func FrameId(id int32) zap.Field {
+	return zap.Int32(FIELD_FRAME_ID, id)
+}
+
+func Shard(name string) zap.Field {
+	return zap.String(FIELD_SHARD, name)
+}
+
+//console格式便于人读, json格式便于采集. zap自身的错误写到stderr.
+//输出到文件时另外返回轮转的文件, 由调用方在SIGHUP时Reopen, 退出前Close; 输出到stdout或stderr时为nil
+func New(cfg config.LogConfig) (*zap.Logger, *logfile.Writer, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, nil, err
+	}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	if cfg.Format == config.LOG_FORMAT_CONSOLE {
+		encoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoder := zapcore.NewJSONEncoder(encoderConfig)
+	if cfg.Format == config.LOG_FORMAT_CONSOLE {
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
+
+	var output zapcore.WriteSyncer
+	var file *logfile.Writer
+	switch cfg.Output {
+	case "stdout":
+		output = zapcore.Lock(os.Stdout)
+	case "stderr":
+		output = zapcore.Lock(os.Stderr)
+	default:
+		var err error
+		file, err = logfile.Open(cfg.Output, logfile.Config{
+			MaxSize:    int64(cfg.MaxSizeMb) << 20,
+			Interval:   cfg.RotateInterval,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   cfg.Compress,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		output = file
+	}
+	core := zapcore.NewCore(encoder, output, zap.NewAtomicLevelAt(level))
+	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+	return logger, file, nil
+}
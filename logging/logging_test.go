@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"AI/config"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bot.log")
+
+	logger, file, err := New(config.LogConfig{Level: "info", Format: config.LOG_FORMAT_JSON, Output: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	botLogger := logger.With(Bot("bot1"), PlayerId(7), RoomId(5))
+	botLogger.Debug("Replanned")
+	botLogger.With(FrameId(42)).Info("Battle started")
+	logger.Sync()
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(bytes)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected the debug entry to be filtered, got %q", lines)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "Battle started" || entry["level"] != "info" || entry[FIELD_BOT] != "bot1" || entry[FIELD_PLAYER_ID] != 7.0 || entry[FIELD_ROOM_ID] != 5.0 || entry[FIELD_FRAME_ID] != 42.0 {
+		t.Errorf("unexpected entry %v", entry)
+	}
+
+	if _, file, err := New(config.LogConfig{Level: "info", Format: config.LOG_FORMAT_CONSOLE, Output: "stdout"}); err != nil || file != nil {
+		t.Errorf("expected no log file for stdout, got %v %v", file, err)
+	}
+	if _, _, err := New(config.LogConfig{Level: "verbose", Format: config.LOG_FORMAT_CONSOLE, Output: "stdout"}); err == nil {
+		t.Errorf("expected an unknown level to be rejected")
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(GinLogger(logger), GinRecovery(logger))
+	r.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	for _, target := range []string{"/ok?botName=bot1", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	requests := logs.FilterMessage("Http request").All()
+	if len(requests) != 2 {
+		t.Fatalf("expected both requests to be logged, got %d", len(requests))
+	}
+	if fields := requests[0].ContextMap(); requests[0].Level != zapcore.InfoLevel || fields["path"] != "/ok" || fields["query"] != "botName=bot1" || fields["status"] != int64(http.StatusOK) {
+		t.Errorf("unexpected request entry %v", fields)
+	}
+	if fields := requests[1].ContextMap(); requests[1].Level != zapcore.ErrorLevel || fields["status"] != int64(http.StatusInternalServerError) {
+		t.Errorf("expected the panicking request to be logged as an error, got %v", fields)
+	}
+	panics := logs.FilterMessage("Recovered from panic in http handler").All()
+	if len(panics) != 1 || panics[0].ContextMap()["panic"] != "boom" || !strings.Contains(panics[0].ContextMap()["stack"].(string), "runtime/debug.Stack") {
+		t.Errorf("expected the panic to be logged with its stack, got %v", panics)
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 type RespGetCaptcha struct {
@@ -24,46 +28,244 @@ type RespSmsLogin struct {
 	Name        string `json:"name"`
 }
 
-func GetCaptchaByName(botName string) RespGetCaptcha {
-	var respGetCaptcha RespGetCaptcha
-	{
-    pathGetCaptcha := C.SERVER.PROTOCOL + "://" + C.SERVER.HOST + C.SERVER.PORT + C.API + C.PLAYER + C.VERSION + C.SMS_CAPTCHA + C.GET
-		fmt.Println(pathGetCaptcha)
-		resp, err := http.Get(pathGetCaptcha + "?phoneNum=" + botName + "&phoneCountryCode=86")
+const DEFAULT_PHONE_COUNTRY_CODE = "86"
+
+const (
+	DEFAULT_MAX_ATTEMPTS = 4
+	DEFAULT_BACKOFF      = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF  = 8 * time.Second
+	DEFAULT_HTTP_TIMEOUT = 10 * time.Second
+
+	//提前这么久视为过期, 避免拿着马上过期的token去连ws
+	TOKEN_EXPIRY_MARGIN = time.Minute
+)
+
+//登录成功后缓存的intAuthToken
+type AuthToken struct {
+	IntAuthToken string
+	PlayerId     int
+	ExpiresAt    time.Time
+}
+
+//带重试和token缓存的登录客户端, 所有方法都可以在多个goroutine中调用
+type Client struct {
+	//形如"http://localhost:9992", 为空时使用constants.SERVER
+	BaseUrl     string
+	HttpClient  *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Log         *zap.Logger //为nil时使用zap.L()
+
+	mutex  sync.Mutex
+	tokens map[string]AuthToken
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+func NewClient(baseUrl string) *Client {
+	return &Client{
+		BaseUrl:     baseUrl,
+		HttpClient:  &http.Client{Timeout: DEFAULT_HTTP_TIMEOUT},
+		MaxAttempts: DEFAULT_MAX_ATTEMPTS,
+		Backoff:     DEFAULT_BACKOFF,
+		MaxBackoff:  DEFAULT_MAX_BACKOFF,
+		tokens:      make(map[string]AuthToken),
+		now:         time.Now,
+		sleep:       time.Sleep,
+	}
+}
+
+//包级函数使用的Client
+var DefaultClient = NewClient("")
+
+func (c *Client) apiUrl(path string) string {
+	baseUrl := c.BaseUrl
+	if baseUrl == "" {
+		baseUrl = C.SERVER.PROTOCOL + "://" + C.SERVER.HOST + C.SERVER.PORT
+	}
+	return baseUrl + C.API + C.PLAYER + C.VERSION + path
+}
+
+func (c *Client) logger() *zap.Logger {
+	if c.Log != nil {
+		return c.Log
+	}
+	return zap.L()
+}
+
+//以指数退避重试临时性的错误
+func (c *Client) retry(api string, do func() error) error {
+	return c.retryIf(api, isTemporary, do)
+}
+
+//以指数退避重试retryable的错误
+func (c *Client) retryIf(api string, retryable func(error) bool, do func() error) error {
+	backoff := c.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = do()
+		if err == nil || !retryable(err) || attempt >= c.MaxAttempts {
+			return err
+		}
+		c.logger().Warn("Retrying", zap.String("api", api), zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+		c.sleep(backoff)
+		backoff *= 2
+		if backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+func (c *Client) decodeResp(api string, resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &HttpStatusError{Api: api, StatusCode: resp.StatusCode}
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: read body: %v", api, err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: unmarshal %q: %v", api, body, err)
+	}
+	return nil
+}
+
+//测试账号的验证码随响应返回(ret为IS_TEST_ACC), 其他账号无法由bot登录
+func (c *Client) GetCaptcha(phoneNum string, phoneCountryCode string) (*RespGetCaptcha, error) {
+	api := C.SMS_CAPTCHA + C.GET
+	pathGetCaptcha := c.apiUrl(api) + "?" + url.Values{"phoneNum": {phoneNum}, "phoneCountryCode": {phoneCountryCode}}.Encode()
+	respGetCaptcha := new(RespGetCaptcha)
+	err := c.retry(api, func() error {
+		resp, err := c.HttpClient.Get(pathGetCaptcha)
 		if err != nil {
-			// handle error
-			fmt.Println("GetCaptchaByName error!")
+			return err
+		}
+		*respGetCaptcha = RespGetCaptcha{}
+		if err := c.decodeResp(api, resp, respGetCaptcha); err != nil {
+			return err
+		}
+		if ret := RetCode(respGetCaptcha.Ret); ret != RET_CODE_OK && ret != RET_CODE_IS_TEST_ACC {
+			return &RetCodeError{Api: api, Ret: ret}
 		}
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		fmt.Printf("body: %s \n", body)
-		json.Unmarshal(body, &respGetCaptcha)
-	}
-	fmt.Println("1111111")
-	fmt.Println(respGetCaptcha)
-	return respGetCaptcha
-}
-
-func GetIntAuthTokenByCaptcha(botName string, captcha string) (token string, playerId int) {
-	var respSmsLogin RespSmsLogin
-	{
-    pathSmsLogin := C.SERVER.PROTOCOL + "://" + C.SERVER.HOST + C.SERVER.PORT + C.API + C.PLAYER + C.VERSION + C.SMS_CAPTCHA + C.LOGIN
-		fmt.Println(pathSmsLogin)
-		resp, err := http.PostForm(pathSmsLogin, url.Values{"smsLoginCaptcha": {captcha}, "phoneNum": {botName}, "phoneCountryCode": {"86"}})
+		if respGetCaptcha.SmsLoginCaptcha == "" {
+			return &RetCodeError{Api: api, Ret: RET_CODE_GET_SMS_CAPTCHA_RESP_ERROR_CODE}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return respGetCaptcha, nil
+}
+
+func (c *Client) LoginByCaptcha(phoneNum string, phoneCountryCode string, captcha string) (*RespSmsLogin, error) {
+	api := C.SMS_CAPTCHA + C.LOGIN
+	pathSmsLogin := c.apiUrl(api)
+	form := url.Values{"smsLoginCaptcha": {captcha}, "phoneNum": {phoneNum}, "phoneCountryCode": {phoneCountryCode}}
+	respSmsLogin := new(RespSmsLogin)
+	//请求可能已经到达后端并用掉了验证码, 只在连接没有建立时重试
+	err := c.retryIf(api, isDialError, func() error {
+		resp, err := c.HttpClient.PostForm(pathSmsLogin, form)
 		if err != nil {
-			// handle error
-			fmt.Println("GetIntAuthTokenByCaptcha error!")
+			return err
+		}
+		*respSmsLogin = RespSmsLogin{}
+		if err := c.decodeResp(api, resp, respSmsLogin); err != nil {
+			return err
 		}
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		json.Unmarshal(body, &respSmsLogin)
+		if ret := RetCode(respSmsLogin.Ret); ret != RET_CODE_OK {
+			return &RetCodeError{Api: api, Ret: ret}
+		}
+		if respSmsLogin.Token == "" || respSmsLogin.PlayerID <= 0 {
+			return &RetCodeError{Api: api, Ret: RET_CODE_INVALID_TOKEN}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	fmt.Printf("RESPSMSLOGIN: %v \n", respSmsLogin)
-	return respSmsLogin.Token, respSmsLogin.PlayerID
+	return respSmsLogin, nil
+}
+
+func tokenKey(phoneNum string, phoneCountryCode string) string {
+	return phoneCountryCode + " " + phoneNum
 }
 
-func GetIntAuthTokenByBotName(botName string) (token string, playerId int) {
-	captcha := GetCaptchaByName(botName).SmsLoginCaptcha
-	intAuthToken, playerId := GetIntAuthTokenByCaptcha(botName, captcha)
-	return intAuthToken, playerId
+//后端的expiresAt是毫秒时间戳, 兼容以秒为单位的旧版本
+func expiresAtTime(expiresAt int64) time.Time {
+	if expiresAt < 1e12 {
+		return time.Unix(expiresAt, 0)
+	}
+	return time.Unix(0, expiresAt*int64(time.Millisecond))
+}
+
+//优先返回未过期的缓存token, 否则走一次短信验证码登录
+func (c *Client) Login(phoneNum string, phoneCountryCode string) (AuthToken, error) {
+	key := tokenKey(phoneNum, phoneCountryCode)
+	c.mutex.Lock()
+	token, ok := c.tokens[key]
+	c.mutex.Unlock()
+	if ok && c.now().Add(TOKEN_EXPIRY_MARGIN).Before(token.ExpiresAt) {
+		return token, nil
+	}
+
+	respGetCaptcha, err := c.GetCaptcha(phoneNum, phoneCountryCode)
+	if err != nil {
+		return AuthToken{}, err
+	}
+	respSmsLogin, err := c.LoginByCaptcha(phoneNum, phoneCountryCode, respGetCaptcha.SmsLoginCaptcha)
+	if err != nil {
+		return AuthToken{}, err
+	}
+	token = AuthToken{
+		IntAuthToken: respSmsLogin.Token,
+		PlayerId:     respSmsLogin.PlayerID,
+		ExpiresAt:    expiresAtTime(respSmsLogin.ExpiresAt),
+	}
+	c.mutex.Lock()
+	c.tokens[key] = token
+	c.mutex.Unlock()
+	return token, nil
+}
+
+//游戏服务器拒绝了token(如INVALID_TOKEN)时调用, 下次Login会重新登录
+func (c *Client) Invalidate(phoneNum string, phoneCountryCode string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.tokens, tokenKey(phoneNum, phoneCountryCode))
+}
+
+func GetCaptchaByName(botName string) (*RespGetCaptcha, error) {
+	return DefaultClient.GetCaptcha(botName, DEFAULT_PHONE_COUNTRY_CODE)
+}
+
+func GetCaptchaByPhone(phoneNum string, phoneCountryCode string) (*RespGetCaptcha, error) {
+	return DefaultClient.GetCaptcha(phoneNum, phoneCountryCode)
+}
+
+func GetIntAuthTokenByCaptcha(botName string, captcha string) (token string, playerId int, err error) {
+	return GetIntAuthTokenByPhoneCaptcha(botName, DEFAULT_PHONE_COUNTRY_CODE, captcha)
+}
+
+func GetIntAuthTokenByPhoneCaptcha(phoneNum string, phoneCountryCode string, captcha string) (token string, playerId int, err error) {
+	respSmsLogin, err := DefaultClient.LoginByCaptcha(phoneNum, phoneCountryCode, captcha)
+	if err != nil {
+		return "", 0, err
+	}
+	return respSmsLogin.Token, respSmsLogin.PlayerID, nil
+}
+
+func GetIntAuthTokenByBotName(botName string) (token string, playerId int, err error) {
+	return GetIntAuthTokenByPhone(botName, DEFAULT_PHONE_COUNTRY_CODE)
+}
+
+//后端在短信验证码登录时会为未注册的手机号创建玩家, 因此同样用于创建bot账号
+func GetIntAuthTokenByPhone(phoneNum string, phoneCountryCode string) (token string, playerId int, err error) {
+	authToken, err := DefaultClient.Login(phoneNum, phoneCountryCode)
+	if err != nil {
+		return "", 0, err
+	}
+	return authToken.IntAuthToken, authToken.PlayerId, nil
 }
@@ -0,0 +1,164 @@
+package login
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//最简的后端: 前mysqlErrors次获取验证码返回MYSQL_ERROR, 之后tooFrequently次返回SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY,
+//只接受验证码"1234", loginStatus不为0时登录返回该HTTP状态码
+type fakeBackend struct {
+	mysqlErrors   int32
+	tooFrequently int32
+	loginStatus   int
+	captchaGets   int32
+	logins        int32
+	expiresAt     int64
+}
+
+func (b *fakeBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/player/v1/SmsCaptcha/get":
+		gets := atomic.AddInt32(&b.captchaGets, 1)
+		if gets <= b.mysqlErrors {
+			json.NewEncoder(w).Encode(&RespGetCaptcha{Ret: int(RET_CODE_MYSQL_ERROR)})
+			return
+		}
+		if gets <= b.mysqlErrors+b.tooFrequently {
+			json.NewEncoder(w).Encode(&RespGetCaptcha{Ret: int(RET_CODE_SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY)})
+			return
+		}
+		json.NewEncoder(w).Encode(&RespGetCaptcha{Ret: int(RET_CODE_IS_TEST_ACC), SmsLoginCaptcha: "1234"})
+	case "/api/player/v1/SmsCaptcha/login":
+		atomic.AddInt32(&b.logins, 1)
+		if b.loginStatus != 0 {
+			w.WriteHeader(b.loginStatus)
+			return
+		}
+		if r.PostFormValue("smsLoginCaptcha") != "1234" {
+			json.NewEncoder(w).Encode(&RespSmsLogin{Ret: int(RET_CODE_SMS_CAPTCHA_NOT_MATCH)})
+			return
+		}
+		json.NewEncoder(w).Encode(&RespSmsLogin{
+			Ret:       int(RET_CODE_OK),
+			Token:     "token-" + r.PostFormValue("phoneNum"),
+			ExpiresAt: b.expiresAt,
+			PlayerID:  42,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(backend *fakeBackend) (*Client, *httptest.Server, *[]time.Duration) {
+	server := httptest.NewServer(backend)
+	client := NewClient(server.URL)
+	sleeps := new([]time.Duration)
+	client.sleep = func(d time.Duration) {
+		*sleeps = append(*sleeps, d)
+	}
+	return client, server, sleeps
+}
+
+func TestLoginRetriesAndCachesToken(t *testing.T) {
+	now := time.Now()
+	backend := &fakeBackend{mysqlErrors: 2, expiresAt: now.Add(time.Hour).UnixNano() / int64(time.Millisecond)}
+	client, server, sleeps := newTestClient(backend)
+	defer server.Close()
+
+	token, err := client.Login("bot1", DEFAULT_PHONE_COUNTRY_CODE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.IntAuthToken != "token-bot1" || token.PlayerId != 42 {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if len(*sleeps) != 2 || (*sleeps)[0] != DEFAULT_BACKOFF || (*sleeps)[1] != 2*DEFAULT_BACKOFF {
+		t.Errorf("unexpected backoff %v", *sleeps)
+	}
+
+	if _, err := client.Login("bot1", DEFAULT_PHONE_COUNTRY_CODE); err != nil {
+		t.Fatal(err)
+	}
+	if backend.logins != 1 {
+		t.Errorf("expected the cached token to be reused, got %d logins", backend.logins)
+	}
+
+	//临近过期时重新登录
+	client.now = func() time.Time { return now.Add(time.Hour - TOKEN_EXPIRY_MARGIN/2) }
+	if _, err := client.Login("bot1", DEFAULT_PHONE_COUNTRY_CODE); err != nil {
+		t.Fatal(err)
+	}
+	client.Invalidate("bot1", DEFAULT_PHONE_COUNTRY_CODE)
+	if _, err := client.Login("bot1", DEFAULT_PHONE_COUNTRY_CODE); err != nil {
+		t.Fatal(err)
+	}
+	if backend.logins != 3 {
+		t.Errorf("expected 3 logins, got %d", backend.logins)
+	}
+}
+
+func TestLoginTypedErrors(t *testing.T) {
+	backend := &fakeBackend{tooFrequently: 100}
+	client, server, sleeps := newTestClient(backend)
+	defer server.Close()
+
+	_, err := client.Login("bot1", DEFAULT_PHONE_COUNTRY_CODE)
+	if !IsRetCode(err, RET_CODE_SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY) {
+		t.Errorf("expected SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY, got %v", err)
+	}
+	//后端的重发间隔比退避长得多, 不重试
+	if backend.captchaGets != 1 || len(*sleeps) != 0 {
+		t.Errorf("expected no retry, got %d attempts", backend.captchaGets)
+	}
+
+	backend.mysqlErrors, backend.captchaGets = 100, 0
+	_, err = client.GetCaptcha("bot1", DEFAULT_PHONE_COUNTRY_CODE)
+	if !IsRetCode(err, RET_CODE_MYSQL_ERROR) {
+		t.Errorf("expected MYSQL_ERROR, got %v", err)
+	}
+	if int(backend.captchaGets) != DEFAULT_MAX_ATTEMPTS || len(*sleeps) != DEFAULT_MAX_ATTEMPTS-1 {
+		t.Errorf("expected %d attempts, got %d", DEFAULT_MAX_ATTEMPTS, backend.captchaGets)
+	}
+
+	//验证码不对不是临时性错误, 不重试
+	_, err = client.LoginByCaptcha("bot1", DEFAULT_PHONE_COUNTRY_CODE, "0000")
+	if !IsRetCode(err, RET_CODE_SMS_CAPTCHA_NOT_MATCH) {
+		t.Errorf("expected SMS_CAPTCHA_NOT_MATCH, got %v", err)
+	}
+	if backend.logins != 1 {
+		t.Errorf("expected no retry, got %d logins", backend.logins)
+	}
+
+	client.BaseUrl = server.URL + "/missing"
+	_, err = client.GetCaptcha("bot1", DEFAULT_PHONE_COUNTRY_CODE)
+	if statusErr, ok := err.(*HttpStatusError); !ok || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 HttpStatusError, got %v", err)
+	}
+}
+
+//登录请求发出后验证码可能已经被用掉, 只在连接没有建立时重试
+func TestLoginByCaptchaRetriesOnlyUnsentRequests(t *testing.T) {
+	backend := &fakeBackend{loginStatus: http.StatusServiceUnavailable}
+	client, server, sleeps := newTestClient(backend)
+	_, err := client.LoginByCaptcha("bot1", DEFAULT_PHONE_COUNTRY_CODE, "1234")
+	if statusErr, ok := err.(*HttpStatusError); !ok || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 HttpStatusError, got %v", err)
+	}
+	if backend.logins != 1 || len(*sleeps) != 0 {
+		t.Errorf("expected no retry after the request was sent, got %d logins", backend.logins)
+	}
+
+	server.Close()
+	_, err = client.LoginByCaptcha("bot1", DEFAULT_PHONE_COUNTRY_CODE, "1234")
+	if !isDialError(err) {
+		t.Errorf("expected a dial error, got %v", err)
+	}
+	if len(*sleeps) != DEFAULT_MAX_ATTEMPTS-1 {
+		t.Errorf("expected %d attempts when the connection is refused, got %d", DEFAULT_MAX_ATTEMPTS, len(*sleeps)+1)
+	}
+}
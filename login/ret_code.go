@@ -0,0 +1,161 @@
+package login
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+//与后端constants.json中的RET_CODE一致, 见nodejsTest/constants.json
+type RetCode int
+
+const (
+	RET_CODE_OK                                                      RetCode = 9000
+	RET_CODE_UNKNOWN_ERROR                                           RetCode = 9001
+	RET_CODE_INVALID_REQUEST_PARAM                                   RetCode = 9002
+	RET_CODE_IS_TEST_ACC                                             RetCode = 9003
+	RET_CODE_MYSQL_ERROR                                             RetCode = 9004
+	RET_CODE_NONEXISTENT_ACT                                         RetCode = 9005
+	RET_CODE_LACK_OF_DIAMOND                                         RetCode = 9006
+	RET_CODE_LACK_OF_GOLD                                            RetCode = 9007
+	RET_CODE_LACK_OF_ENERGY                                          RetCode = 9008
+	RET_CODE_NONEXISTENT_ACT_HANDLER                                 RetCode = 9009
+	RET_CODE_LOCALLY_NO_AVAILABLE_ROOM                               RetCode = 9010
+	RET_CODE_LOCALLY_NO_SPECIFIED_ROOM                               RetCode = 9011
+	RET_CODE_PLAYER_NOT_ADDABLE_TO_ROOM                              RetCode = 9012
+	RET_CODE_PLAYER_NOT_READDABLE_TO_ROOM                            RetCode = 9013
+	RET_CODE_PLAYER_NOT_FOUND                                        RetCode = 9014
+	RET_CODE_PLAYER_CHEATING                                         RetCode = 9015
+	RET_CODE_WECHAT_SERVER_ERROR                                     RetCode = 9016
+	RET_CODE_SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY                    RetCode = 5001
+	RET_CODE_SMS_CAPTCHA_NOT_MATCH                                   RetCode = 5002
+	RET_CODE_GET_SMS_CAPTCHA_RESP_ERROR_CODE                         RetCode = 5003
+	RET_CODE_INVALID_TOKEN                                           RetCode = 2001
+	RET_CODE_DUPLICATED                                              RetCode = 2002
+	RET_CODE_INCORRECT_HANDLE                                        RetCode = 2004
+	RET_CODE_INCORRECT_PASSWORD                                      RetCode = 2006
+	RET_CODE_INCORRECT_CAPTCHA                                       RetCode = 2007
+	RET_CODE_INVALID_EMAIL_LITERAL                                   RetCode = 2008
+	RET_CODE_NO_ASSOCIATED_EMAIL                                     RetCode = 2009
+	RET_CODE_SEND_EMAIL_TIMEOUT                                      RetCode = 2010
+	RET_CODE_INCORRECT_PHONE_COUNTRY_CODE                            RetCode = 2011
+	RET_CODE_NEW_HANDLE_CONFLICT                                     RetCode = 2013
+	RET_CODE_FAILED_TO_UPDATE                                        RetCode = 2014
+	RET_CODE_FAILED_TO_DELETE                                        RetCode = 2015
+	RET_CODE_FAILED_TO_CREATE                                        RetCode = 2016
+	RET_CODE_INCORRECT_PHONE_NUMBER                                  RetCode = 2018
+	RET_CODE_INSUFFICIENT_MEM_TO_ALLOCATE_CONNECTION                 RetCode = 3001
+	RET_CODE_PASSWORD_RESET_CODE_GENERATION_PER_EMAIL_TOO_FREQUENTLY RetCode = 4000
+	RET_CODE_TRADE_CREATION_TOO_FREQUENTLY                           RetCode = 4002
+	RET_CODE_MAP_NOT_UNLOCKED                                        RetCode = 4003
+	RET_CODE_NOT_IMPLEMENTED_YET                                     RetCode = 65535
+)
+
+var retCodeNames = map[RetCode]string{
+	RET_CODE_OK:                                                      "OK",
+	RET_CODE_UNKNOWN_ERROR:                                           "UNKNOWN_ERROR",
+	RET_CODE_INVALID_REQUEST_PARAM:                                   "INVALID_REQUEST_PARAM",
+	RET_CODE_IS_TEST_ACC:                                             "IS_TEST_ACC",
+	RET_CODE_MYSQL_ERROR:                                             "MYSQL_ERROR",
+	RET_CODE_NONEXISTENT_ACT:                                         "NONEXISTENT_ACT",
+	RET_CODE_LACK_OF_DIAMOND:                                         "LACK_OF_DIAMOND",
+	RET_CODE_LACK_OF_GOLD:                                            "LACK_OF_GOLD",
+	RET_CODE_LACK_OF_ENERGY:                                          "LACK_OF_ENERGY",
+	RET_CODE_NONEXISTENT_ACT_HANDLER:                                 "NONEXISTENT_ACT_HANDLER",
+	RET_CODE_LOCALLY_NO_AVAILABLE_ROOM:                               "LOCALLY_NO_AVAILABLE_ROOM",
+	RET_CODE_LOCALLY_NO_SPECIFIED_ROOM:                               "LOCALLY_NO_SPECIFIED_ROOM",
+	RET_CODE_PLAYER_NOT_ADDABLE_TO_ROOM:                              "PLAYER_NOT_ADDABLE_TO_ROOM",
+	RET_CODE_PLAYER_NOT_READDABLE_TO_ROOM:                            "PLAYER_NOT_READDABLE_TO_ROOM",
+	RET_CODE_PLAYER_NOT_FOUND:                                        "PLAYER_NOT_FOUND",
+	RET_CODE_PLAYER_CHEATING:                                         "PLAYER_CHEATING",
+	RET_CODE_WECHAT_SERVER_ERROR:                                     "WECHAT_SERVER_ERROR",
+	RET_CODE_SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY:                    "SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY",
+	RET_CODE_SMS_CAPTCHA_NOT_MATCH:                                   "SMS_CAPTCHA_NOT_MATCH",
+	RET_CODE_GET_SMS_CAPTCHA_RESP_ERROR_CODE:                         "GET_SMS_CAPTCHA_RESP_ERROR_CODE",
+	RET_CODE_INVALID_TOKEN:                                           "INVALID_TOKEN",
+	RET_CODE_DUPLICATED:                                              "DUPLICATED",
+	RET_CODE_INCORRECT_HANDLE:                                        "INCORRECT_HANDLE",
+	RET_CODE_INCORRECT_PASSWORD:                                      "INCORRECT_PASSWORD",
+	RET_CODE_INCORRECT_CAPTCHA:                                       "INCORRECT_CAPTCHA",
+	RET_CODE_INVALID_EMAIL_LITERAL:                                   "INVALID_EMAIL_LITERAL",
+	RET_CODE_NO_ASSOCIATED_EMAIL:                                     "NO_ASSOCIATED_EMAIL",
+	RET_CODE_SEND_EMAIL_TIMEOUT:                                      "SEND_EMAIL_TIMEOUT",
+	RET_CODE_INCORRECT_PHONE_COUNTRY_CODE:                            "INCORRECT_PHONE_COUNTRY_CODE",
+	RET_CODE_NEW_HANDLE_CONFLICT:                                     "NEW_HANDLE_CONFLICT",
+	RET_CODE_FAILED_TO_UPDATE:                                        "FAILED_TO_UPDATE",
+	RET_CODE_FAILED_TO_DELETE:                                        "FAILED_TO_DELETE",
+	RET_CODE_FAILED_TO_CREATE:                                        "FAILED_TO_CREATE",
+	RET_CODE_INCORRECT_PHONE_NUMBER:                                  "INCORRECT_PHONE_NUMBER",
+	RET_CODE_INSUFFICIENT_MEM_TO_ALLOCATE_CONNECTION:                 "INSUFFICIENT_MEM_TO_ALLOCATE_CONNECTION",
+	RET_CODE_PASSWORD_RESET_CODE_GENERATION_PER_EMAIL_TOO_FREQUENTLY: "PASSWORD_RESET_CODE_GENERATION_PER_EMAIL_TOO_FREQUENTLY",
+	RET_CODE_TRADE_CREATION_TOO_FREQUENTLY:                           "TRADE_CREATION_TOO_FREQUENTLY",
+	RET_CODE_MAP_NOT_UNLOCKED:                                        "MAP_NOT_UNLOCKED",
+	RET_CODE_NOT_IMPLEMENTED_YET:                                     "NOT_IMPLEMENTED_YET",
+}
+
+func (c RetCode) String() string {
+	if name, ok := retCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("RET_CODE(%d)", int(c))
+}
+
+//后端返回了非OK的ret
+type RetCodeError struct {
+	Api string
+	Ret RetCode
+}
+
+func (e *RetCodeError) Error() string {
+	return fmt.Sprintf("%s: ret %d %s", e.Api, int(e.Ret), e.Ret)
+}
+
+//稍后重试可能成功的ret, 其余的重试也不会有不同结果
+//SMS_CAPTCHA_REQUESTED_TOO_FREQUENTLY不重试: 后端的重发间隔是30秒, 退避等不了那么久, 由调用方稍后再登录
+func (e *RetCodeError) Temporary() bool {
+	switch e.Ret {
+	case RET_CODE_UNKNOWN_ERROR, RET_CODE_MYSQL_ERROR, RET_CODE_INSUFFICIENT_MEM_TO_ALLOCATE_CONNECTION:
+		return true
+	}
+	return false
+}
+
+//后端返回了非200的HTTP状态码
+type HttpStatusError struct {
+	Api        string
+	StatusCode int
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("%s: http status %d", e.Api, e.StatusCode)
+}
+
+func (e *HttpStatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == 429
+}
+
+//err是否(或包装了)指定ret的RetCodeError
+func IsRetCode(err error, ret RetCode) bool {
+	var retCodeErr *RetCodeError
+	return errors.As(err, &retCodeErr) && retCodeErr.Ret == ret
+}
+
+//网络错误以及Temporary()的错误可以重试
+func isTemporary(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+	return false
+}
+
+//连接没有建立起来, 请求一定没有到达后端
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,312 @@
+//Prometheus文本格式(0.0.4)的指标, 只实现bot服务器用到的计数器, 仪表和直方图
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	TYPE_COUNTER   = "counter"
+	TYPE_GAUGE     = "gauge"
+	TYPE_HISTOGRAM = "histogram"
+)
+
+type collector interface {
+	//按注册顺序输出, 包括HELP和TYPE行
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mutex      sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+//包级的NewCounter等函数注册到这里, /metrics输出它
+var Default = NewRegistry()
+
+//指标名重复时panic, 与prometheus.MustRegister相同, 只应在初始化时发生
+func (r *Registry) register(name string, c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.names[name] {
+		panic("duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) WriteText(out io.Writer) error {
+	r.mutex.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mutex.Unlock()
+	w := bufio.NewWriter(out)
+	for _, c := range collectors {
+		c.write(w)
+	}
+	return w.Flush()
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+//形如{a="1",b="2"}, 没有标签时为空串
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+//只增不减
+type Counter struct {
+	value int64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddInt64(&c.value, 1)
+}
+
+//n为负数时panic
+func (c *Counter) Add(n int64) {
+	if n < 0 {
+		panic("counter cannot decrease")
+	}
+	atomic.AddInt64(&c.value, n)
+}
+
+func (c *Counter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+type counterMetric struct {
+	name    string
+	help    string
+	counter Counter
+}
+
+func (m *counterMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, TYPE_COUNTER)
+	fmt.Fprintf(w, "%s %d\n", m.name, m.counter.Value())
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	m := &counterMetric{name: name, help: help}
+	r.register(name, m)
+	return &m.counter
+}
+
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+//按标签值区分的一组计数器, 每组标签值第一次使用时创建
+type CounterVec struct {
+	name     string
+	help     string
+	labels   []string
+	mutex    sync.RWMutex
+	counters map[string]*labelledCounter
+}
+
+type labelledCounter struct {
+	values  []string
+	counter Counter
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{
+		name:     name,
+		help:     help,
+		labels:   labels,
+		counters: make(map[string]*labelledCounter),
+	}
+	r.register(name, v)
+	return v
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+//values与创建时的标签一一对应, 数量不一致时panic
+func (v *CounterVec) With(values ...string) *Counter {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	c, ok := v.counters[key]
+	v.mutex.RUnlock()
+	if ok {
+		return &c.counter
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if c, ok := v.counters[key]; ok {
+		return &c.counter
+	}
+	c = &labelledCounter{values: append([]string(nil), values...)}
+	v.counters[key] = c
+	return &c.counter
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, v.name, v.help, TYPE_COUNTER)
+	v.mutex.RLock()
+	keys := make([]string, 0, len(v.counters))
+	for key := range v.counters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c := v.counters[key]
+		fmt.Fprintf(w, "%s%s %d\n", v.name, formatLabels(v.labels, c.values), c.counter.Value())
+	}
+	v.mutex.RUnlock()
+}
+
+//可增可减, 如当前在线的bot数
+type Gauge struct {
+	value int64
+}
+
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.value, 1)
+}
+
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.value, -1)
+}
+
+func (g *Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.value, n)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+type gaugeMetric struct {
+	name  string
+	help  string
+	gauge Gauge
+}
+
+func (m *gaugeMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, TYPE_GAUGE)
+	fmt.Fprintf(w, "%s %d\n", m.name, m.gauge.Value())
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	m := &gaugeMetric{name: name, help: help}
+	r.register(name, m)
+	return &m.gauge
+}
+
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+//buckets为各个桶的上限, 从小到大, +Inf桶自动添加
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mutex   sync.Mutex
+	counts  []uint64 //不累计, 输出时再累加
+	sum     float64
+	count   uint64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic("buckets of " + name + " are not sorted")
+	}
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+	r.register(name, h)
+	return h
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+//观测次数和总和
+func (h *Histogram) Snapshot() (count uint64, sum float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.count, h.sum
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, total := h.sum, h.count
+	h.mutex.Unlock()
+	writeHeader(w, h.name, h.help, TYPE_HISTOGRAM)
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		upper := math.Inf(1)
+		if i < len(h.buckets) {
+			upper = h.buckets[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(upper), cumulative)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, total)
+}
+
+//start, start*factor, ...共count个
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
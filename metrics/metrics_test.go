@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounter("test_total", "A counter.")
+	vec := r.NewCounterVec("test_by_reason_total", "Counted by reason.\nSecond line.", "reason")
+	gauge := r.NewGauge("test_active", "A gauge.")
+	histogram := r.NewHistogram("test_seconds", "A histogram.", []float64{0.1, 1})
+	counter.Add(3)
+	counter.Inc()
+	vec.With("b").Inc()
+	vec.With(`a"\`).Add(2)
+	vec.With("b").Inc()
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		histogram.Observe(v)
+	}
+
+	var out bytes.Buffer
+	if err := r.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_total A counter.
+# TYPE test_total counter
+test_total 4
+# HELP test_by_reason_total Counted by reason.\nSecond line.
+# TYPE test_by_reason_total counter
+test_by_reason_total{reason="a\"\\"} 2
+test_by_reason_total{reason="b"} 2
+# HELP test_active A gauge.
+# TYPE test_active gauge
+test_active 1
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.1"} 2
+test_seconds_bucket{le="1"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 2.65
+test_seconds_count 4
+`
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+	if count, sum := histogram.Snapshot(); count != 4 || sum != 2.65 {
+		t.Errorf("unexpected snapshot %d %v", count, sum)
+	}
+}
+
+func expectPanic(t *testing.T, name string, f func()) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected %s to panic", name)
+		}
+	}()
+	f()
+}
+
+func TestMisuse(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "")
+	vec := r.NewCounterVec("test_by_reason_total", "", "reason")
+	expectPanic(t, "a duplicated name", func() { r.NewGauge("test_total", "") })
+	expectPanic(t, "missing label values", func() { vec.With() })
+	expectPanic(t, "unsorted buckets", func() { r.NewHistogram("test_seconds", "", []float64{1, 0.1}) })
+	expectPanic(t, "a decreasing counter", func() { vec.With("a").Add(-1) })
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	buckets := ExponentialBuckets(1, 2, 4)
+	if len(buckets) != 4 || buckets[0] != 1 || buckets[3] != 8 {
+		t.Errorf("unexpected buckets %v", buckets)
+	}
+}
@@ -1,33 +1,206 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"sync"
+	"time"
+)
 
 type IsLeisure bool
 type BotName string
 
 type Bot map[BotName]IsLeisure
 
+var (
+	ErrNoLeisureBot = errors.New("There is no leisure bot")
+	ErrLeaseNotHeld = errors.New("The lease is no longer held")
+)
+
+//一次bot的占用, 超过Deadline仍未归还时会被强制回收
+type BotLease struct {
+	LeaseId   int64
+	BotName   string
+	Account   BotAccount
+	RoomId    int
+	StartedAt time.Time
+	Deadline  time.Time
+
+	expired chan struct{}
+}
+
+//强制回收时关闭, 持有该lease的bot应尽快退出
+func (l *BotLease) Expired() <-chan struct{} {
+	return l.expired
+}
+
+//BotManager的所有方法都可以在多个goroutine中调用
 type BotManager struct {
-	BotMap Bot
+	mutex       sync.Mutex
+	BotMap      Bot
+	accounts    map[BotName]BotAccount
+	leases      map[BotName]*BotLease
+	lastLeaseId int64
+
+	//被强制回收的lease, 在reaper goroutine中调用, 不持有锁
+	OnLeaseExpired func(lease BotLease)
 }
 
 func (bm *BotManager) SetBots(botNames []string) {
-	bm.BotMap = make(map[BotName]IsLeisure)
-	for _, name := range botNames {
-		bm.BotMap[BotName(name)] = true
+	accounts := make([]BotAccount, len(botNames))
+	for i, name := range botNames {
+		accounts[i] = BotAccount{
+			Name:             name,
+			PhoneNum:         name,
+			PhoneCountryCode: defaultPhoneCountryCode,
+		}
 	}
+	bm.SetAccounts(accounts)
 }
 
-func (bm *BotManager) GetLeisureBot() (botName string, err error) {
+//可在运行时重复调用: 已有bot的占用状态不变, 被移除的bot在归还后才从池中删除
+func (bm *BotManager) SetAccounts(accounts []BotAccount) {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	if bm.BotMap == nil {
+		bm.BotMap = make(map[BotName]IsLeisure)
+		bm.leases = make(map[BotName]*BotLease)
+	}
+	bm.accounts = make(map[BotName]BotAccount)
+	for _, account := range accounts {
+		name := BotName(account.Name)
+		bm.accounts[name] = account
+		if _, ok := bm.BotMap[name]; !ok {
+			bm.BotMap[name] = true
+		}
+	}
+	for name := range bm.BotMap {
+		if _, ok := bm.accounts[name]; !ok {
+			if _, busy := bm.leases[name]; !busy {
+				delete(bm.BotMap, name)
+			}
+		}
+	}
+}
+
+func (bm *BotManager) Accounts() []BotAccount {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	accounts := make([]BotAccount, 0, len(bm.accounts))
+	for _, account := range bm.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+//tag为空时不限制tag
+func (bm *BotManager) AcquireBot(roomId int, tag string, timeout time.Duration) (*BotLease, error) {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
 	for name, isLeisure := range bm.BotMap {
+		account, ok := bm.accounts[name]
+		if !ok || (tag != "" && !account.HasTag(tag)) {
+			continue
+		}
 		if isLeisure {
 			bm.BotMap[name] = false
-			return string(name), nil
+			bm.lastLeaseId++
+			now := time.Now()
+			lease := &BotLease{
+				LeaseId:   bm.lastLeaseId,
+				BotName:   string(name),
+				Account:   account,
+				RoomId:    roomId,
+				StartedAt: now,
+				Deadline:  now.Add(timeout),
+				expired:   make(chan struct{}),
+			}
+			bm.leases[name] = lease
+			return lease, nil
 		}
 	}
-	return "", errors.New("There is no leisure bot")
+	return nil, ErrNoLeisureBot
 }
 
-func (bm *BotManager) ReleaseBot(name string) {
-	bm.BotMap[BotName(name)] = IsLeisure(true)
+//只有仍持有该lease时才归还, 避免已被强制回收的bot归还掉别人新申请的lease
+func (bm *BotManager) ReleaseBot(lease *BotLease) error {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	name := BotName(lease.BotName)
+	current, ok := bm.leases[name]
+	if !ok || current.LeaseId != lease.LeaseId {
+		return ErrLeaseNotHeld
+	}
+	delete(bm.leases, name)
+	bm.releaseLocked(name)
+	return nil
+}
+
+func (bm *BotManager) releaseLocked(name BotName) {
+	if _, ok := bm.accounts[name]; ok {
+		bm.BotMap[name] = IsLeisure(true)
+	} else {
+		delete(bm.BotMap, name)
+	}
+}
+
+//回收所有在now之前到期的lease, 返回被回收的lease
+func (bm *BotManager) ReclaimExpired(now time.Time) []BotLease {
+	var reclaimed []BotLease
+	bm.mutex.Lock()
+	for name, lease := range bm.leases {
+		if now.After(lease.Deadline) {
+			delete(bm.leases, name)
+			bm.releaseLocked(name)
+			close(lease.expired)
+			reclaimed = append(reclaimed, *lease)
+		}
+	}
+	onLeaseExpired := bm.OnLeaseExpired
+	bm.mutex.Unlock()
+
+	if onLeaseExpired != nil {
+		for _, lease := range reclaimed {
+			onLeaseExpired(lease)
+		}
+	}
+	return reclaimed
+}
+
+//每隔interval回收一次过期的lease, 直到stop被关闭
+func (bm *BotManager) StartReaper(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				bm.ReclaimExpired(now)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (bm *BotManager) Leases() []BotLease {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	leases := make([]BotLease, 0, len(bm.leases))
+	for _, lease := range bm.leases {
+		leases = append(leases, *lease)
+	}
+	return leases
+}
+
+func (bm *BotManager) Stats() (busy int, idle int) {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	for _, isLeisure := range bm.BotMap {
+		if isLeisure {
+			idle++
+		} else {
+			busy++
+		}
+	}
+	return busy, idle
 }
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+)
+
+const defaultPhoneCountryCode = "86"
+
+type BotAccount struct {
+	Name             string   `yaml:"name"`
+	PhoneNum         string   `yaml:"phoneNum"`
+	PhoneCountryCode string   `yaml:"phoneCountryCode"`
+	Tags             []string `yaml:"tags"`
+}
+
+func (a *BotAccount) HasTag(tag string) bool {
+	for _, t := range a.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type BotPoolConfig struct {
+	Provision bool         `yaml:"provision"`
+	Bots      []BotAccount `yaml:"bots"`
+}
+
+func LoadBotPoolConfig(path string) (*BotPoolConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := new(BotPoolConfig)
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("parse bot pool %s: %v", path, err)
+	}
+	if err := config.normalize(); err != nil {
+		return nil, fmt.Errorf("invalid bot pool %s: %v", path, err)
+	}
+	return config, nil
+}
+
+//补全默认值并检查名字和手机号是否重复
+func (c *BotPoolConfig) normalize() error {
+	if len(c.Bots) == 0 {
+		return errors.New("no bot is configured")
+	}
+	names := make(map[string]bool)
+	phones := make(map[string]bool)
+	for i := range c.Bots {
+		bot := &c.Bots[i]
+		if bot.Name == "" {
+			return fmt.Errorf("bot #%d has no name", i)
+		}
+		if bot.PhoneNum == "" {
+			bot.PhoneNum = bot.Name
+		}
+		if bot.PhoneCountryCode == "" {
+			bot.PhoneCountryCode = defaultPhoneCountryCode
+		}
+		phone := bot.PhoneCountryCode + " " + bot.PhoneNum
+		if names[bot.Name] {
+			return fmt.Errorf("duplicated bot name %s", bot.Name)
+		}
+		if phones[phone] {
+			return fmt.Errorf("duplicated bot phone %s", phone)
+		}
+		names[bot.Name] = true
+		phones[phone] = true
+	}
+	return nil
+}
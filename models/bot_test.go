@@ -0,0 +1,217 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBotManager() *BotManager {
+	bm := new(BotManager)
+	bm.SetAccounts([]BotAccount{
+		{Name: "bot1", Tags: []string{"east"}},
+		{Name: "bot2", Tags: []string{"west"}},
+		{Name: "bot3", Tags: []string{"east", "vip"}},
+	})
+	return bm
+}
+
+func TestAcquireBot(t *testing.T) {
+	cases := []struct {
+		name     string
+		tag      string
+		acquired int
+		bots     map[string]bool //可能被占用的bot
+	}{
+		{"any", "", 3, map[string]bool{"bot1": true, "bot2": true, "bot3": true}},
+		{"tagged", "east", 2, map[string]bool{"bot1": true, "bot3": true}},
+		{"single", "vip", 1, map[string]bool{"bot3": true}},
+		{"unknown tag", "north", 0, nil},
+	}
+	for _, c := range cases {
+		bm := newTestBotManager()
+		seen := make(map[string]bool)
+		for {
+			lease, err := bm.AcquireBot(7, c.tag, time.Minute)
+			if err == ErrNoLeisureBot {
+				break
+			}
+			if err != nil || !c.bots[lease.BotName] || seen[lease.BotName] || lease.RoomId != 7 || lease.Account.Name != lease.BotName {
+				t.Fatalf("%s: unexpected lease %+v, %v", c.name, lease, err)
+			}
+			if got := lease.Deadline.Sub(lease.StartedAt); got != time.Minute {
+				t.Errorf("%s: expected a deadline one minute later, got %v", c.name, got)
+			}
+			seen[lease.BotName] = true
+		}
+		if len(seen) != c.acquired {
+			t.Errorf("%s: expected %d bots, acquired %v", c.name, c.acquired, seen)
+		}
+		if busy, idle := bm.Stats(); busy != c.acquired || idle != 3-c.acquired {
+			t.Errorf("%s: unexpected stats busy %d idle %d", c.name, busy, idle)
+		}
+	}
+}
+
+func TestReleaseBotWithStaleLease(t *testing.T) {
+	bm := newTestBotManager()
+	lease, err := bm.AcquireBot(1, "vip", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.ReleaseBot(lease); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if err := bm.ReleaseBot(lease); err != ErrLeaseNotHeld {
+		t.Errorf("expected a second release to fail, got %v", err)
+	}
+
+	//被强制回收后bot被别人重新申请, 旧lease的归还不能释放新的lease
+	stale, _ := bm.AcquireBot(1, "vip", time.Minute)
+	bm.ReclaimExpired(time.Now().Add(2 * time.Minute))
+	current, err := bm.AcquireBot(2, "vip", time.Minute)
+	if err != nil || current.BotName != stale.BotName || current.LeaseId == stale.LeaseId {
+		t.Fatalf("expected %s to be leased again, got %+v, %v", stale.BotName, current, err)
+	}
+	if err := bm.ReleaseBot(stale); err != ErrLeaseNotHeld {
+		t.Errorf("expected the stale lease to be rejected, got %v", err)
+	}
+	if leases := bm.Leases(); len(leases) != 1 || leases[0].LeaseId != current.LeaseId {
+		t.Errorf("expected only the new lease to be held, got %+v", leases)
+	}
+}
+
+func TestReclaimExpired(t *testing.T) {
+	bm := newTestBotManager()
+	var expired []BotLease
+	bm.OnLeaseExpired = func(lease BotLease) {
+		expired = append(expired, lease)
+	}
+	short, _ := bm.AcquireBot(1, "west", time.Second)
+	long, _ := bm.AcquireBot(1, "vip", time.Hour)
+
+	if reclaimed := bm.ReclaimExpired(short.StartedAt); len(reclaimed) != 0 {
+		t.Errorf("expected nothing to expire yet, got %+v", reclaimed)
+	}
+	reclaimed := bm.ReclaimExpired(short.StartedAt.Add(2 * time.Second))
+	if len(reclaimed) != 1 || reclaimed[0].LeaseId != short.LeaseId || len(expired) != 1 || expired[0].LeaseId != short.LeaseId {
+		t.Fatalf("expected only %s to be reclaimed, got %+v and callbacks %+v", short.BotName, reclaimed, expired)
+	}
+	select {
+	case <-short.Expired():
+	default:
+		t.Errorf("expected the reclaimed lease to be signalled")
+	}
+	select {
+	case <-long.Expired():
+		t.Errorf("expected the long lease to be kept")
+	default:
+	}
+	if busy, idle := bm.Stats(); busy != 1 || idle != 2 {
+		t.Errorf("unexpected stats busy %d idle %d", busy, idle)
+	}
+}
+
+func TestStartReaper(t *testing.T) {
+	bm := newTestBotManager()
+	reclaimed := make(chan BotLease, 1)
+	bm.OnLeaseExpired = func(lease BotLease) {
+		reclaimed <- lease
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	bm.StartReaper(5*time.Millisecond, stop)
+	lease, _ := bm.AcquireBot(1, "", 10*time.Millisecond)
+	select {
+	case got := <-reclaimed:
+		if got.LeaseId != lease.LeaseId {
+			t.Errorf("expected lease %d to be reclaimed, got %d", lease.LeaseId, got.LeaseId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the reaper did not reclaim the expired lease")
+	}
+}
+
+//重新加载bot池时, 被移除但仍被占用的bot在归还后才删除, 新增的bot立即可用
+func TestSetAccountsWhileLeased(t *testing.T) {
+	bm := newTestBotManager()
+	removed, _ := bm.AcquireBot(1, "west", time.Minute)
+	kept, _ := bm.AcquireBot(1, "vip", time.Minute)
+	bm.SetAccounts([]BotAccount{
+		{Name: "bot1", Tags: []string{"east"}},
+		{Name: "bot3", Tags: []string{"east", "vip"}},
+		{Name: "bot4", Tags: []string{"west"}},
+	})
+	if busy, idle := bm.Stats(); busy != 2 || idle != 2 {
+		t.Errorf("expected bot2 to stay busy until released, got busy %d idle %d", busy, idle)
+	}
+	if _, err := bm.AcquireBot(1, "west", time.Minute); err != nil {
+		t.Errorf("expected the new bot4 to be acquirable: %v", err)
+	}
+	if err := bm.ReleaseBot(removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.ReleaseBot(kept); err != nil {
+		t.Fatal(err)
+	}
+	if busy, idle := bm.Stats(); busy != 1 || idle != 2 {
+		t.Errorf("expected bot2 to be dropped after release, got busy %d idle %d", busy, idle)
+	}
+	if len(bm.Accounts()) != 3 {
+		t.Errorf("unexpected accounts %+v", bm.Accounts())
+	}
+}
+
+//用-race运行: 多个goroutine同时申请, 归还, 回收和重新加载, 同一个bot任何时候最多被一个lease占用
+func TestBotManagerConcurrentAcquireRelease(t *testing.T) {
+	bm := new(BotManager)
+	var names []string
+	for i := 0; i < 8; i++ {
+		names = append(names, fmt.Sprintf("bot%d", i))
+	}
+	bm.SetBots(names)
+
+	var holdersMutex sync.Mutex
+	holders := make(map[string]int64)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				lease, err := bm.AcquireBot(j, "", time.Minute)
+				if err != nil {
+					continue
+				}
+				holdersMutex.Lock()
+				if holder, ok := holders[lease.BotName]; ok {
+					t.Errorf("%s leased by %d and %d at once", lease.BotName, holder, lease.LeaseId)
+				}
+				holders[lease.BotName] = lease.LeaseId
+				holdersMutex.Unlock()
+
+				bm.Stats()
+				holdersMutex.Lock()
+				delete(holders, lease.BotName)
+				holdersMutex.Unlock()
+				if err := bm.ReleaseBot(lease); err != nil {
+					t.Errorf("release %+v: %v", lease, err)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			bm.SetBots(names)
+			bm.ReclaimExpired(time.Now())
+			bm.Leases()
+		}
+	}()
+	wg.Wait()
+	if busy, idle := bm.Stats(); busy != 0 || idle != len(names) {
+		t.Errorf("expected all bots to be released, got busy %d idle %d", busy, idle)
+	}
+}
@@ -17,6 +17,16 @@ type Vec2D struct {
 	Y float64 `protobuf:"fixed64,2,opt,name=y,proto3" json:"y,omitempty"`
 }
 
+// Snaps `radian` to the closest of the 8 directions that the hero animations are drawn for, e.g. `Direction{Dx: 1, Dy: 1}` for "TopRight".
+func DirectionByRadian(radian float64) Direction {
+	sector := math.Round(radian / (math.Pi / 4))
+	snapped := sector * (math.Pi / 4)
+	return Direction{
+		Dx: math.Round(math.Cos(snapped)),
+		Dy: math.Round(math.Sin(snapped)),
+	}
+}
+
 func CreateVec2DFromB2Vec2(b2V2 box2d.B2Vec2) *Vec2D {
 	return &Vec2D{
 		X: b2V2.X,
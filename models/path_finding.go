@@ -2,7 +2,7 @@ package models
 
 import (
 	"AI/astar"
-	"fmt"
+	"go.uber.org/zap"
 	"math"
 )
 
@@ -23,12 +23,17 @@ type PathFinding struct {
 	NextGoalIndex    int             //-1表示没有下一个可走的点
 	TreasureMap      map[int32]Point //id -> point of position
 	TargetTreasureId int32           //用于判断这个宝物是否已经被吃掉
+	LastStep         Vec2D           //最近一次Move的位移, 用于计算朝向
 
 	State int
+
+	Log *zap.Logger //为nil时不输出
 }
 
 func (p *PathFinding) transitState(state int) {
-	fmt.Printf("PathFinding transit, from state%d to state%d \n", p.State, state)
+	if p.Log != nil {
+		p.Log.Debug("PathFinding transit", zap.Int("from", p.State), zap.Int("to", state))
+	}
 	p.State = state
 }
 
@@ -45,6 +50,7 @@ func (p *PathFinding) SetTreasureMap(treasureDiscreteMap map[int32]Point) {
 func (p *PathFinding) Move(step float64) {
 	if p.NextGoalIndex >= len(p.CoordPath) || p.NextGoalIndex == -1 {
 		//已经移动到最后一个点
+		p.LastStep = Vec2D{}
 	} else {
 		eps := step / 2
 
@@ -89,30 +95,46 @@ func (p *PathFinding) Move(step float64) {
 		//fmt.Println(d);
 
 		if d < eps {
+			p.LastStep = Vec2D{
+				X: tarPos.X - curPos.X,
+				Y: tarPos.Y - curPos.Y,
+			}
 			p.CurrentCoord = tarPos
 			p.NextGoalIndex = p.NextGoalIndex + 1
 		} else {
+			p.LastStep = Vec2D{
+				X: stepX,
+				Y: stepY,
+			}
 			p.CurrentCoord = nextPos
 		}
 	}
 }
 
+//最近一次Move的朝向, 没有移动时ok为false
+func (p *PathFinding) LastStepRadian() (radian float64, ok bool) {
+	if p.LastStep.X == 0 && p.LastStep.Y == 0 {
+		return 0, false
+	}
+	return math.Atan2(p.LastStep.Y, p.LastStep.X), true
+}
+
 func (p *PathFinding) SetCurrentCoord(x float64, y float64) {
 	p.CurrentCoord.X = x
 	p.CurrentCoord.Y = y
 }
 
-func (p *PathFinding) FindPointPath(startPoint astar.Point, endPoint astar.Point) []astar.Point {
-	p.PointPath = FindPathByStartAndGoal(p.CollideMap, startPoint, endPoint)
+func (p *PathFinding) FindPointPath(startPoint astar.Point, endPoint astar.Point) ([]astar.Point, error) {
+	var err error
+	p.PointPath, err = FindPathByStartAndGoal(p.CollideMap, startPoint, endPoint)
 	//fmt.Printf("The point path: %v \n", p.PointPath)
-	return p.PointPath
+	return p.PointPath, err
 }
 
 func (p *PathFinding) SetNewCoordPath(coordPath []Vec2D) {
 	//fmt.Printf("Set new coord path: %v", coordPath)
 	p.CoordPath = coordPath
 	if len(coordPath) < 1 {
-		fmt.Println("There is no path to the goal")
 		p.NextGoalIndex = -1
 	} else {
 		p.NextGoalIndex = 1 //不为0的原因是0为当前坐标
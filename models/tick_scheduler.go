@@ -0,0 +1,118 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+//一个tick最多推进的步数, 超出的时间直接丢弃, 避免goroutine被饿死后一次性走出很远
+const maxCatchUpSteps = 5
+
+//只取最近这么多个下行帧估算服务器时间, 旧样本过期后时钟漂移和网络变化都能被跟上
+const serverClockWindow = 100
+
+//固定步长的tick调度: 实际流逝的时间累积起来, 每个tick推进整数个Interval, 不足一步的余量留给下一个tick.
+//收到下行帧后根据SentAt估算服务器时间, tick落在服务器时间上Interval的整数倍处, 与服务器的帧节奏同相
+type TickScheduler struct {
+	Interval time.Duration
+
+	lastTickAt  time.Time
+	accumulated time.Duration
+
+	clockMutex sync.Mutex
+	//serverNowMillis - localNowMillis的样本, 环形缓冲. 估计值取窗口内的最大值, 即网络延迟最小的样本
+	offsetSamples [serverClockWindow]int64
+	sampleCount   int
+	nextSample    int
+	offsetMillis  int64
+}
+
+func NewTickScheduler(ratePerSecond int) *TickScheduler {
+	if ratePerSecond <= 0 {
+		ratePerSecond = 1
+	}
+	return &TickScheduler{
+		Interval:   time.Second / time.Duration(ratePerSecond),
+		lastTickAt: time.Now(),
+	}
+}
+
+//阻塞到下一个tick, 返回本tick要推进的步数, 每步Interval. 刚对齐到服务器时间时可能为0
+func (t *TickScheduler) Wait() int {
+	if d := time.Until(t.nextTickAt(time.Now())); d > 0 {
+		time.Sleep(d)
+	}
+	return t.advance(time.Now())
+}
+
+func (t *TickScheduler) nextTickAt(now time.Time) time.Time {
+	if offset, ok := t.serverClockOffset(); ok {
+		serverNow := now.Add(offset)
+		return now.Add(t.Interval - time.Duration(serverNow.UnixNano())%t.Interval)
+	}
+	return t.lastTickAt.Add(t.Interval - t.accumulated)
+}
+
+func (t *TickScheduler) advance(now time.Time) int {
+	t.accumulated += now.Sub(t.lastTickAt)
+	t.lastTickAt = now
+	steps := int(t.accumulated / t.Interval)
+	if steps > maxCatchUpSteps {
+		t.accumulated = 0
+		return maxCatchUpSteps
+	}
+	t.accumulated -= time.Duration(steps) * t.Interval
+	return steps
+}
+
+//用下行帧的SentAt(服务器毫秒时间戳)校准服务器时间, 只应由接收下行帧的goroutine调用
+func (t *TickScheduler) OnServerFrame(sentAtMillis int64) {
+	t.onServerFrameAt(sentAtMillis, time.Now())
+}
+
+func (t *TickScheduler) onServerFrameAt(sentAtMillis int64, now time.Time) {
+	if sentAtMillis <= 0 {
+		return
+	}
+	t.clockMutex.Lock()
+	defer t.clockMutex.Unlock()
+	t.offsetSamples[t.nextSample] = sentAtMillis - unixMillis(now)
+	t.nextSample = (t.nextSample + 1) % serverClockWindow
+	if t.sampleCount < serverClockWindow {
+		t.sampleCount++
+	}
+	t.offsetMillis = t.offsetSamples[0]
+	for _, offset := range t.offsetSamples[1:t.sampleCount] {
+		if offset > t.offsetMillis {
+			t.offsetMillis = offset
+		}
+	}
+}
+
+func (t *TickScheduler) serverClockOffset() (offset time.Duration, ok bool) {
+	t.clockMutex.Lock()
+	defer t.clockMutex.Unlock()
+	return time.Duration(t.offsetMillis) * time.Millisecond, t.sampleCount > 0
+}
+
+//估算的服务器当前毫秒时间戳, 尚未收到过下行帧时ok为false
+func (t *TickScheduler) ServerNowMillis() (millis int64, ok bool) {
+	offset, ok := t.serverClockOffset()
+	if !ok {
+		return 0, false
+	}
+	return unixMillis(time.Now().Add(offset)), true
+}
+
+//下行帧的抖动: 相对于窗口内最快一帧多花的传输时间(毫秒), 不是单向延迟, 后者无法在没有往返的情况下测得
+func (t *TickScheduler) FrameJitterMillis(sentAtMillis int64) (millis int64, ok bool) {
+	serverNow, ok := t.ServerNowMillis()
+	if !ok || sentAtMillis <= 0 {
+		return 0, false
+	}
+	return serverNow - sentAtMillis, true
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
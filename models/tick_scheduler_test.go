@@ -0,0 +1,90 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTickSchedulerAccumulatesFixedSteps(t *testing.T) {
+	ticker := NewTickScheduler(20)
+	start := ticker.lastTickAt
+	cases := []struct {
+		at          time.Duration
+		steps       int
+		accumulated time.Duration
+	}{
+		{70 * time.Millisecond, 1, 20 * time.Millisecond},
+		{110 * time.Millisecond, 1, 10 * time.Millisecond},
+		{120 * time.Millisecond, 0, 20 * time.Millisecond},
+		{150 * time.Millisecond, 1, 0},
+		//被饿死很久后只追赶maxCatchUpSteps步, 多出的时间丢弃
+		{10 * time.Second, maxCatchUpSteps, 0},
+		{10*time.Second + 50*time.Millisecond, 1, 0},
+	}
+	for _, c := range cases {
+		if steps := ticker.advance(start.Add(c.at)); steps != c.steps || ticker.accumulated != c.accumulated {
+			t.Errorf("at %v: expected %d steps with %v left, got %d with %v", c.at, c.steps, c.accumulated, steps, ticker.accumulated)
+		}
+	}
+}
+
+func TestTickSchedulerWaitKeepsRealTime(t *testing.T) {
+	ticker := NewTickScheduler(100)
+	start := time.Now()
+	steps := 0
+	for i := 0; i < 10; i++ {
+		steps += ticker.Wait()
+	}
+	//剩余不足一步的时间还在accumulated中
+	expected := int(time.Since(start) / ticker.Interval)
+	if steps < 10 || steps > expected || expected-steps > 1 {
+		t.Errorf("expected about %d steps in %v, got %d", expected, time.Since(start), steps)
+	}
+}
+
+func TestTickSchedulerServerClock(t *testing.T) {
+	ticker := NewTickScheduler(20)
+	if _, ok := ticker.ServerNowMillis(); ok {
+		t.Fatal("expected no server time before any frame")
+	}
+	now := time.Unix(1000, 0)
+	//服务器快1秒, 传输延迟在20ms到80ms之间, 估计值取延迟最小的样本
+	for i, delay := range []int64{80, 20, 50} {
+		at := now.Add(time.Duration(i) * time.Second)
+		ticker.onServerFrameAt(unixMillis(at)+1000-delay, at)
+	}
+	if offset, _ := ticker.serverClockOffset(); offset != 980*time.Millisecond {
+		t.Errorf("expected the offset of the fastest frame, got %v", offset)
+	}
+
+	//服务器时钟变慢200ms后, 窗口内的旧样本全部过期时估计值跟上
+	for i := 0; i < serverClockWindow; i++ {
+		at := now.Add(time.Duration(10+i) * time.Second)
+		ticker.onServerFrameAt(unixMillis(at)+800-30, at)
+		if offset, _ := ticker.serverClockOffset(); i < serverClockWindow-3 && offset != 980*time.Millisecond {
+			t.Fatalf("expected the old fastest sample to be kept at %d, got %v", i, offset)
+		}
+	}
+	if offset, _ := ticker.serverClockOffset(); offset != 770*time.Millisecond {
+		t.Errorf("expected the offset to follow the drift, got %v", offset)
+	}
+	ticker.onServerFrameAt(0, now)
+	if offset, _ := ticker.serverClockOffset(); offset != 770*time.Millisecond {
+		t.Errorf("expected frames without SentAt to be ignored, got %v", offset)
+	}
+}
+
+//收到下行帧后tick落在服务器时间上Interval的整数倍处
+func TestTickSchedulerAlignsToServerClock(t *testing.T) {
+	ticker := NewTickScheduler(20)
+	now := time.Unix(1000, 0).Add(12 * time.Millisecond)
+	if next := ticker.nextTickAt(ticker.lastTickAt); next != ticker.lastTickAt.Add(ticker.Interval) {
+		t.Errorf("expected a tick one interval later without server time, got %v", next.Sub(ticker.lastTickAt))
+	}
+	ticker.onServerFrameAt(unixMillis(now)+1007, now)
+	next := ticker.nextTickAt(now)
+	serverNext := next.Add(1007 * time.Millisecond)
+	if next.Sub(now) <= 0 || next.Sub(now) > ticker.Interval || serverNext.UnixNano()%int64(ticker.Interval) != 0 {
+		t.Errorf("expected the next tick on the server grid within an interval, got %v later at server %v", next.Sub(now), serverNext)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"AI/astar"
 	pb "AI/pb_output"
 	"github.com/Tarliton/collision2d"
-	"log"
 	"math"
 )
 
@@ -23,6 +22,18 @@ type Point struct {
 	Y int
 }
 
+//将每个离散点转换成连续坐标, CoordToPoint依赖该结果
+func (m *TmxMap) InitContinuousPosMap() {
+	continuousPosMap := make([][]Vec2D, m.Height)
+	for i := 0; i < m.Height; i++ {
+		continuousPosMap[i] = make([]Vec2D, m.Width)
+		for j := 0; j < m.Width; j++ {
+			continuousPosMap[i][j].X, continuousPosMap[i][j].Y = m.GetCoordByGid(i*m.Width + j)
+		}
+	}
+	m.ContinuousPosMap = continuousPosMap
+}
+
 func (m *TmxMap) GetCoordByGid(index int) (x float64, y float64) {
 	h := index / m.Width
 	w := index % m.Width
@@ -91,9 +102,14 @@ func (pTmxMapIns *TmxMap) continuousObjLayerVecToContinuousMapNodeVec(continuous
 	return converted
 }
 
-//通过离散的二维数组进行寻路, 返回一个Point数组
-func FindPathByStartAndGoal(collideMap astar.Map, start astar.Point, goal astar.Point) []astar.Point {
-	path := astar.AstarByStartAndGoalPoint(collideMap, start, goal)
+//tmx对象层中的坐标转换为地图节点坐标, 即BattleColliderInfo和RoomDownsyncFrame中使用的坐标
+func (pTmxMapIns *TmxMap) ObjectLayerCoordToMapNodeCoord(continuousObjLayerVec Vec2D) Vec2D {
+	return pTmxMapIns.continuousObjLayerVecToContinuousMapNodeVec(&continuousObjLayerVec)
+}
+
+//通过离散的二维数组进行寻路, 返回一个Point数组, 搜索被放弃时另外返回错误
+func FindPathByStartAndGoal(collideMap astar.Map, start astar.Point, goal astar.Point) ([]astar.Point, error) {
+	path, err := astar.AstarByStartAndGoalPoint(collideMap, start, goal)
 
 	/*
 	    * 打印地图
@@ -118,7 +134,7 @@ func FindPathByStartAndGoal(collideMap astar.Map, start astar.Point, goal astar.
 	   }
 	*/
 
-	return path
+	return path, err
 }
 
 func ComputeColliderMapByCollision2dNeo(strToPolygon2DListMap map[string]*pb.Polygon2DList, pTmxMapIns *TmxMap) []int {
@@ -163,7 +179,6 @@ func ComputeColliderMapByCollision2dNeo(strToPolygon2DListMap map[string]*pb.Pol
 		}
 	}
 
-	log.Printf("collideMap %v ", collideMap)
 	return collideMap
 }
 
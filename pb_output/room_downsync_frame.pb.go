@@ -1117,6 +1117,132 @@ func (m *RoomDownsyncFrame) GetPlayerMetas() map[int32]*PlayerMeta {
 	return nil
 }
 
+type PlayerUpsyncCmd struct {
+	Id                   int32      `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	X                    float64    `protobuf:"fixed64,2,opt,name=x,proto3" json:"x,omitempty"`
+	Y                    float64    `protobuf:"fixed64,3,opt,name=y,proto3" json:"y,omitempty"`
+	Dir                  *Direction `protobuf:"bytes,4,opt,name=dir,proto3" json:"dir,omitempty"`
+	AckingFrameId        int32      `protobuf:"varint,5,opt,name=ackingFrameId,proto3" json:"ackingFrameId,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
+	XXX_unrecognized     []byte     `json:"-"`
+	XXX_sizecache        int32      `json:"-"`
+}
+
+func (m *PlayerUpsyncCmd) Reset()         { *m = PlayerUpsyncCmd{} }
+func (m *PlayerUpsyncCmd) String() string { return proto.CompactTextString(m) }
+func (*PlayerUpsyncCmd) ProtoMessage()    {}
+func (*PlayerUpsyncCmd) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bfbf2753c483f827, []int{15}
+}
+
+func (m *PlayerUpsyncCmd) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PlayerUpsyncCmd.Unmarshal(m, b)
+}
+func (m *PlayerUpsyncCmd) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PlayerUpsyncCmd.Marshal(b, m, deterministic)
+}
+func (m *PlayerUpsyncCmd) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PlayerUpsyncCmd.Merge(m, src)
+}
+func (m *PlayerUpsyncCmd) XXX_Size() int {
+	return xxx_messageInfo_PlayerUpsyncCmd.Size(m)
+}
+func (m *PlayerUpsyncCmd) XXX_DiscardUnknown() {
+	xxx_messageInfo_PlayerUpsyncCmd.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PlayerUpsyncCmd proto.InternalMessageInfo
+
+func (m *PlayerUpsyncCmd) GetId() int32 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *PlayerUpsyncCmd) GetX() float64 {
+	if m != nil {
+		return m.X
+	}
+	return 0
+}
+
+func (m *PlayerUpsyncCmd) GetY() float64 {
+	if m != nil {
+		return m.Y
+	}
+	return 0
+}
+
+func (m *PlayerUpsyncCmd) GetDir() *Direction {
+	if m != nil {
+		return m.Dir
+	}
+	return nil
+}
+
+func (m *PlayerUpsyncCmd) GetAckingFrameId() int32 {
+	if m != nil {
+		return m.AckingFrameId
+	}
+	return 0
+}
+
+type WsReq struct {
+	MsgId                int32    `protobuf:"varint,1,opt,name=msgId,proto3" json:"msgId,omitempty"`
+	Act                  string   `protobuf:"bytes,2,opt,name=act,proto3" json:"act,omitempty"`
+	Data                 []byte   `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WsReq) Reset()         { *m = WsReq{} }
+func (m *WsReq) String() string { return proto.CompactTextString(m) }
+func (*WsReq) ProtoMessage()    {}
+func (*WsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_bfbf2753c483f827, []int{16}
+}
+
+func (m *WsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WsReq.Unmarshal(m, b)
+}
+func (m *WsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WsReq.Marshal(b, m, deterministic)
+}
+func (m *WsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WsReq.Merge(m, src)
+}
+func (m *WsReq) XXX_Size() int {
+	return xxx_messageInfo_WsReq.Size(m)
+}
+func (m *WsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_WsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WsReq proto.InternalMessageInfo
+
+func (m *WsReq) GetMsgId() int32 {
+	if m != nil {
+		return m.MsgId
+	}
+	return 0
+}
+
+func (m *WsReq) GetAct() string {
+	if m != nil {
+		return m.Act
+	}
+	return ""
+}
+
+func (m *WsReq) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Direction)(nil), "treasurehunterx.Direction")
 	proto.RegisterType((*Vec2D)(nil), "treasurehunterx.Vec2D")
@@ -1143,82 +1269,88 @@ func init() {
 	proto.RegisterMapType((map[int32]*SpeedShoe)(nil), "treasurehunterx.RoomDownsyncFrame.SpeedShoesEntry")
 	proto.RegisterMapType((map[int32]*Trap)(nil), "treasurehunterx.RoomDownsyncFrame.TrapsEntry")
 	proto.RegisterMapType((map[int32]*Treasure)(nil), "treasurehunterx.RoomDownsyncFrame.TreasuresEntry")
+	proto.RegisterType((*PlayerUpsyncCmd)(nil), "treasurehunterx.PlayerUpsyncCmd")
+	proto.RegisterType((*WsReq)(nil), "treasurehunterx.WsReq")
 }
 
 func init() { proto.RegisterFile("room_downsync_frame.proto", fileDescriptor_bfbf2753c483f827) }
 
 var fileDescriptor_bfbf2753c483f827 = []byte{
-	// 1139 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x97, 0xdd, 0x6e, 0xdb, 0xb6,
-	0x17, 0xc0, 0x21, 0xcb, 0x72, 0xa2, 0x63, 0x37, 0x69, 0x88, 0x7f, 0xf3, 0x57, 0xb3, 0x21, 0x30,
-	0x34, 0x60, 0x08, 0xd0, 0xd6, 0x5d, 0xd3, 0x62, 0x18, 0x72, 0x31, 0x2c, 0x6d, 0xb6, 0xc6, 0xc0,
-	0xd2, 0x66, 0xb2, 0xb7, 0x60, 0xd8, 0x45, 0xc7, 0x58, 0x4c, 0xa2, 0x45, 0x16, 0x05, 0x92, 0x4e,
-	0xad, 0x37, 0x18, 0xb6, 0x8b, 0xed, 0x6a, 0x4f, 0xb0, 0xb7, 0xd8, 0x3b, 0xed, 0x11, 0x86, 0x41,
-	0x14, 0x65, 0x51, 0x1f, 0xc9, 0x8c, 0xf4, 0xa2, 0x77, 0xe6, 0xd1, 0x39, 0xbf, 0x73, 0x78, 0x3e,
-	0x48, 0x1a, 0xee, 0x33, 0x4a, 0xa7, 0x6f, 0x7c, 0xfa, 0x36, 0xe2, 0x49, 0x34, 0x79, 0x73, 0xc6,
-	0xf0, 0x94, 0x0c, 0x62, 0x46, 0x05, 0x45, 0xeb, 0x82, 0x11, 0xcc, 0x67, 0x8c, 0x5c, 0xcc, 0x22,
-	0x41, 0xd8, 0xdc, 0x7d, 0x00, 0xf6, 0x41, 0xc0, 0xc8, 0x44, 0x04, 0x34, 0x42, 0x6b, 0xd0, 0xf2,
-	0xe7, 0x8e, 0xd1, 0x37, 0x76, 0x0c, 0xaf, 0xe5, 0xcf, 0xe5, 0x3a, 0x71, 0x5a, 0x6a, 0x9d, 0xb8,
-	0x1f, 0x81, 0xf5, 0x1d, 0x99, 0xec, 0x1e, 0xa0, 0x1e, 0x18, 0xb9, 0x9e, 0x31, 0x4f, 0x57, 0xb9,
-	0x96, 0x91, 0xb8, 0x97, 0x60, 0x1f, 0xd3, 0x30, 0x39, 0xa7, 0xd1, 0xee, 0x01, 0x1a, 0x40, 0x67,
-	0x3f, 0x9a, 0x5c, 0x50, 0x26, 0xb5, 0xbb, 0xbb, 0x9b, 0x83, 0x4a, 0x00, 0x03, 0x09, 0xf4, 0x94,
-	0x56, 0xaa, 0x7f, 0x4c, 0x83, 0x48, 0x70, 0xa7, 0xd5, 0x37, 0x6f, 0xd2, 0xcf, 0xb4, 0xdc, 0x7d,
-	0xb0, 0xa5, 0xe0, 0xeb, 0x80, 0x0b, 0xf4, 0x0c, 0xec, 0xab, 0x7c, 0xe1, 0x18, 0x37, 0xda, 0x17,
-	0x8a, 0xee, 0x37, 0x70, 0x67, 0x11, 0xaf, 0xc4, 0x7c, 0x01, 0x77, 0x62, 0x5d, 0xa0, 0x50, 0x5b,
-	0x35, 0xd4, 0xc2, 0xcc, 0x2b, 0x1b, 0xb8, 0x7f, 0xb7, 0x01, 0x3d, 0xc7, 0x42, 0x84, 0xe4, 0x05,
-	0x0d, 0xc3, 0xc0, 0x27, 0x6c, 0x18, 0x9d, 0x51, 0xf4, 0x21, 0xd8, 0x5c, 0xe0, 0x73, 0xf2, 0x0a,
-	0x4f, 0x89, 0xcc, 0x87, 0xed, 0x15, 0x02, 0x74, 0x01, 0x1b, 0x5c, 0xb0, 0x31, 0x5d, 0xec, 0xe7,
-	0x08, 0xc7, 0x2a, 0x0b, 0x7b, 0x35, 0xd7, 0x75, 0xfa, 0x60, 0x54, 0x35, 0xfe, 0x32, 0x12, 0x2c,
-	0xf1, 0xea, 0x50, 0x24, 0xe0, 0x9e, 0x14, 0x96, 0xb6, 0x9d, 0x7a, 0x33, 0xa5, 0xb7, 0xcf, 0x97,
-	0xf6, 0x56, 0x05, 0x64, 0x1e, 0x9b, 0xe1, 0xe8, 0x63, 0x58, 0x1b, 0xa5, 0x9b, 0x3d, 0x08, 0xf8,
-	0x84, 0x11, 0x41, 0x4e, 0x9c, 0x76, 0xdf, 0xd8, 0xb1, 0xbc, 0x8a, 0xb4, 0xa6, 0x77, 0xe8, 0x58,
-	0x0d, 0x7a, 0x87, 0x68, 0x1b, 0x40, 0x4a, 0xc6, 0x41, 0x48, 0x4e, 0x9c, 0x8e, 0xd4, 0xd1, 0x24,
-	0xa5, 0xef, 0x87, 0xce, 0x4a, 0xe5, 0xfb, 0xe1, 0xd6, 0x8f, 0xb0, 0xd9, 0x9c, 0x32, 0x74, 0x17,
-	0xcc, 0x4b, 0x92, 0xa8, 0x0a, 0xa5, 0x3f, 0xd1, 0x27, 0x60, 0x5d, 0xe1, 0x70, 0x46, 0x64, 0x97,
-	0x37, 0xb5, 0xc2, 0x02, 0xe2, 0x65, 0x8a, 0x7b, 0xad, 0xcf, 0x8c, 0xad, 0x0b, 0xd8, 0xba, 0x3e,
-	0x4d, 0x0d, 0x5e, 0x9e, 0x95, 0xbd, 0x6c, 0x5f, 0xdf, 0x70, 0x15, 0x4f, 0xee, 0x1f, 0x2d, 0xe8,
-	0x1c, 0x87, 0x38, 0x21, 0x2c, 0x9d, 0xd9, 0xc0, 0x97, 0x54, 0xcb, 0x6b, 0x05, 0x7e, 0x36, 0xaa,
-	0xad, 0xd2, 0xa8, 0x9a, 0x6a, 0x54, 0xd1, 0x43, 0x30, 0xfd, 0x80, 0xc9, 0x3a, 0x34, 0x6d, 0x6a,
-	0x71, 0x30, 0x78, 0xa9, 0x1a, 0xfa, 0x1f, 0x58, 0x3c, 0x26, 0xc4, 0x57, 0xf5, 0xc8, 0x16, 0xa8,
-	0x0f, 0xdd, 0x53, 0xd9, 0x1e, 0x23, 0x81, 0x05, 0x51, 0x75, 0xd0, 0x45, 0xe8, 0x21, 0x6c, 0x84,
-	0x98, 0x8b, 0x23, 0x7a, 0x45, 0x5e, 0x4e, 0xc5, 0x51, 0x10, 0x86, 0x01, 0x57, 0xf5, 0xa8, 0x7f,
-	0x90, 0x5e, 0x26, 0x94, 0x11, 0x07, 0x94, 0x97, 0x74, 0x81, 0x1c, 0x58, 0x61, 0x64, 0x4a, 0xaf,
-	0x88, 0xef, 0x74, 0xfb, 0xc6, 0xce, 0xaa, 0x97, 0x2f, 0xd3, 0xa1, 0xfa, 0x89, 0x06, 0xd1, 0x30,
-	0xf2, 0xc9, 0xdc, 0xe9, 0x49, 0x9b, 0x42, 0xe0, 0xfe, 0x6c, 0x00, 0x64, 0x89, 0x39, 0x22, 0x02,
-	0xd7, 0x92, 0x83, 0xa0, 0x1d, 0xa5, 0xc3, 0xd8, 0x92, 0x45, 0x90, 0xbf, 0xd3, 0x0d, 0xf9, 0x01,
-	0x8f, 0x43, 0x9c, 0xc8, 0x39, 0x35, 0xe5, 0x27, 0x5d, 0x84, 0x36, 0xa1, 0x83, 0xaf, 0xb0, 0xc0,
-	0x59, 0xe6, 0x6c, 0x4f, 0xad, 0xca, 0xa1, 0x58, 0xd5, 0x50, 0xfe, 0x34, 0x60, 0x75, 0xac, 0x32,
-	0x5c, 0x0b, 0x64, 0x07, 0xd6, 0x43, 0x3a, 0xc1, 0xe1, 0xd0, 0x1f, 0x46, 0xd9, 0xb4, 0xc9, 0x98,
-	0x2c, 0xaf, 0x2a, 0x2e, 0xf2, 0x63, 0xea, 0xf9, 0x91, 0x55, 0x6e, 0x97, 0xaa, 0x6c, 0xe5, 0x55,
-	0xd6, 0x72, 0xd7, 0x29, 0xe7, 0x0e, 0x41, 0x5b, 0x24, 0x31, 0x51, 0xc5, 0x90, 0xbf, 0xdd, 0x7f,
-	0x0c, 0xe8, 0x3c, 0x9f, 0x85, 0x21, 0x11, 0x4d, 0x41, 0x19, 0xcd, 0x41, 0xf5, 0xa1, 0x1b, 0x06,
-	0x11, 0xc1, 0x6c, 0x24, 0x1b, 0x24, 0x6b, 0x37, 0x5d, 0x94, 0x05, 0x68, 0x96, 0x02, 0x6c, 0x37,
-	0x04, 0x68, 0x95, 0x03, 0xdc, 0x83, 0x1e, 0x17, 0x98, 0x89, 0x7d, 0x21, 0xcf, 0x7b, 0x19, 0xff,
-	0xf5, 0x87, 0x7a, 0x49, 0x17, 0x7d, 0x0a, 0x40, 0x22, 0x3f, 0xb7, 0x5c, 0xb9, 0xd1, 0x52, 0xd3,
-	0x74, 0x7f, 0x31, 0xa0, 0x3d, 0x66, 0x38, 0x7e, 0x87, 0x1a, 0xe5, 0x79, 0x35, 0x8b, 0xbc, 0xde,
-	0xae, 0x42, 0xee, 0x6f, 0x06, 0xd8, 0x32, 0x81, 0xa3, 0x0b, 0xfa, 0x2e, 0x5d, 0x73, 0xbb, 0xf4,
-	0xe7, 0xfb, 0xe8, 0x68, 0xfd, 0xf1, 0xab, 0x01, 0x2b, 0xc7, 0xb3, 0x69, 0x7c, 0x19, 0x44, 0xef,
-	0xbf, 0x41, 0xdc, 0xdf, 0x0d, 0x80, 0x97, 0x33, 0xcc, 0xfc, 0x31, 0x7d, 0xdb, 0x70, 0xf8, 0xbd,
-	0x8f, 0x92, 0xfd, 0xd5, 0x85, 0x0d, 0x8f, 0xd2, 0xe9, 0x81, 0x7a, 0x7f, 0x7d, 0x95, 0x3e, 0xbf,
-	0x6a, 0x91, 0x6d, 0x03, 0x30, 0x72, 0x26, 0xbf, 0x0d, 0x7d, 0x15, 0x94, 0x26, 0x41, 0x43, 0x58,
-	0x89, 0xe5, 0xb9, 0xc5, 0xd5, 0xad, 0xfc, 0xb8, 0xd6, 0xba, 0x35, 0x27, 0x83, 0xec, 0xa4, 0xe3,
-	0xd9, 0x35, 0x9c, 0xdb, 0xa7, 0xc7, 0x15, 0x27, 0x91, 0xd8, 0x17, 0x72, 0x2f, 0xa6, 0xa7, 0x56,
-	0xe9, 0x45, 0x3b, 0xa1, 0xb3, 0x48, 0xa4, 0x0f, 0xc5, 0x57, 0x38, 0xa2, 0x5c, 0xee, 0xce, 0xf4,
-	0x2a, 0x52, 0xf4, 0x1a, 0xec, 0xdc, 0x35, 0x77, 0x3a, 0x32, 0x98, 0x27, 0x4b, 0x04, 0x93, 0x9f,
-	0x75, 0x2a, 0x9c, 0x82, 0x81, 0x5e, 0x80, 0x25, 0x18, 0x8e, 0xd3, 0x4b, 0x20, 0x85, 0x3d, 0x5a,
-	0x0a, 0x86, 0x63, 0x05, 0xca, 0x6c, 0xd3, 0x04, 0x9d, 0xca, 0x63, 0x8a, 0x3b, 0xab, 0x4b, 0x27,
-	0x28, 0x3b, 0xd8, 0xf2, 0x04, 0x29, 0x7b, 0xe4, 0x01, 0xf0, 0x7c, 0xc6, 0xb8, 0x63, 0x4b, 0xda,
-	0xee, 0x12, 0xb4, 0xc5, 0x60, 0x2a, 0xa0, 0x46, 0x91, 0xf5, 0xcb, 0xa6, 0xc4, 0x81, 0xe5, 0xeb,
-	0x97, 0x59, 0xe4, 0xf5, 0x53, 0x53, 0xf6, 0x2d, 0x74, 0xcf, 0x17, 0x2d, 0xce, 0x9d, 0xae, 0xc4,
-	0x3d, 0x5d, 0x02, 0x57, 0x0c, 0x86, 0x0a, 0x50, 0xe7, 0xa4, 0xd8, 0x78, 0x71, 0x33, 0x72, 0xa7,
-	0xb7, 0x34, 0xb6, 0xb8, 0x4f, 0x73, 0xac, 0xc6, 0xd9, 0x1a, 0x41, 0x4f, 0x6f, 0x43, 0xfd, 0x99,
-	0x63, 0x65, 0xcf, 0x9c, 0x47, 0xe5, 0x67, 0xce, 0xff, 0xeb, 0xcf, 0x1c, 0x69, 0xaf, 0xbf, 0xa4,
-	0x4e, 0x60, 0xad, 0xdc, 0x4e, 0x0d, 0xd8, 0xc7, 0x65, 0xec, 0xfd, 0x1a, 0x36, 0x27, 0xe8, 0xe0,
-	0xd7, 0x00, 0x45, 0x6b, 0x35, 0x40, 0x1f, 0x94, 0xa1, 0xf7, 0x1a, 0xa0, 0x38, 0xd6, 0x81, 0x23,
-	0xe8, 0xe9, 0x4d, 0x76, 0x9b, 0xed, 0x67, 0xf6, 0x3a, 0xf4, 0x7b, 0x58, 0xaf, 0xf4, 0x5a, 0x03,
-	0xf7, 0x3f, 0xdf, 0xa8, 0x0b, 0x84, 0x8e, 0x1e, 0x43, 0x4f, 0xef, 0xba, 0x06, 0xee, 0xa0, 0xcc,
-	0x75, 0xea, 0xe5, 0xca, 0xec, 0x75, 0xea, 0x0f, 0x70, 0xb7, 0xda, 0x7c, 0x0d, 0xe4, 0x27, 0x65,
-	0xf2, 0x07, 0x35, 0x72, 0xc1, 0xa8, 0xc0, 0xab, 0x2d, 0x78, 0x1b, 0x78, 0xc1, 0xd0, 0xe0, 0xa7,
-	0x1d, 0xf9, 0x3f, 0xf9, 0xe9, 0xbf, 0x01, 0x00, 0x00, 0xff, 0xff, 0x1a, 0x93, 0x24, 0xfb, 0x44,
-	0x0f, 0x00, 0x00,
+	// 1207 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x97, 0x5f, 0x6f, 0xe3, 0x44,
+	0x10, 0xc0, 0xe5, 0x38, 0x4e, 0xeb, 0x49, 0xda, 0x5e, 0x57, 0xb4, 0xf8, 0x0a, 0xaa, 0x22, 0x23,
+	0x41, 0xa5, 0xbb, 0xcb, 0xd1, 0xde, 0x09, 0xa1, 0x3e, 0x20, 0x7a, 0x2d, 0x5c, 0x23, 0xd1, 0xbb,
+	0xe2, 0xe4, 0xa8, 0x10, 0x0f, 0xc7, 0x36, 0xde, 0xb6, 0xa6, 0x8e, 0xd7, 0xec, 0x6e, 0x7a, 0xcd,
+	0x37, 0x40, 0xf0, 0x00, 0x4f, 0x7c, 0x02, 0xbe, 0x05, 0xdf, 0x89, 0x8f, 0x80, 0x90, 0x77, 0xed,
+	0x78, 0xfd, 0xa7, 0x25, 0xea, 0x3d, 0xdc, 0x5b, 0x76, 0x3c, 0xf3, 0x9b, 0xd9, 0x99, 0xd9, 0xdd,
+	0x09, 0xdc, 0x67, 0x94, 0x8e, 0x5f, 0xfb, 0xf4, 0x4d, 0xc4, 0xa7, 0xd1, 0xe8, 0xf5, 0x19, 0xc3,
+	0x63, 0xd2, 0x8b, 0x19, 0x15, 0x14, 0xad, 0x08, 0x46, 0x30, 0x9f, 0x30, 0x72, 0x31, 0x89, 0x04,
+	0x61, 0xd7, 0xee, 0x03, 0xb0, 0x0f, 0x02, 0x46, 0x46, 0x22, 0xa0, 0x11, 0x5a, 0x86, 0x86, 0x7f,
+	0xed, 0x18, 0x5d, 0x63, 0xcb, 0xf0, 0x1a, 0xfe, 0xb5, 0x5c, 0x4f, 0x9d, 0x46, 0xba, 0x9e, 0xba,
+	0x1f, 0x81, 0xf5, 0x1d, 0x19, 0xed, 0x1c, 0xa0, 0x0e, 0x18, 0x99, 0x9e, 0x71, 0x9d, 0xac, 0x32,
+	0x2d, 0x63, 0xea, 0x5e, 0x82, 0x7d, 0x4c, 0xc3, 0xe9, 0x39, 0x8d, 0x76, 0x0e, 0x50, 0x0f, 0x5a,
+	0x7b, 0xd1, 0xe8, 0x82, 0x32, 0xa9, 0xdd, 0xde, 0x59, 0xef, 0x95, 0x02, 0xe8, 0x49, 0xa0, 0x97,
+	0x6a, 0x25, 0xfa, 0xc7, 0x34, 0x88, 0x04, 0x77, 0x1a, 0x5d, 0xf3, 0x36, 0x7d, 0xa5, 0xe5, 0xee,
+	0x81, 0x2d, 0x05, 0xdf, 0x04, 0x5c, 0xa0, 0xa7, 0x60, 0x5f, 0x65, 0x0b, 0xc7, 0xb8, 0xd5, 0x3e,
+	0x57, 0x74, 0xbf, 0x85, 0xa5, 0x59, 0xbc, 0x12, 0xf3, 0x25, 0x2c, 0xc5, 0xba, 0x20, 0x45, 0x6d,
+	0x54, 0x50, 0x33, 0x33, 0xaf, 0x68, 0xe0, 0xfe, 0xd3, 0x04, 0xf4, 0x0c, 0x0b, 0x11, 0x92, 0x7d,
+	0x1a, 0x86, 0x81, 0x4f, 0x58, 0x3f, 0x3a, 0xa3, 0xe8, 0x43, 0xb0, 0xb9, 0xc0, 0xe7, 0xe4, 0x05,
+	0x1e, 0x13, 0x99, 0x0f, 0xdb, 0xcb, 0x05, 0xe8, 0x02, 0x56, 0xb9, 0x60, 0x43, 0x3a, 0xdb, 0xcf,
+	0x11, 0x8e, 0xd3, 0x2c, 0xec, 0x56, 0x5c, 0x57, 0xe9, 0xbd, 0x41, 0xd9, 0xf8, 0xab, 0x48, 0xb0,
+	0xa9, 0x57, 0x85, 0x22, 0x01, 0x6b, 0x52, 0x58, 0xd8, 0x76, 0xe2, 0xcd, 0x94, 0xde, 0xbe, 0x98,
+	0xdb, 0x5b, 0x19, 0xa0, 0x3c, 0xd6, 0xc3, 0xd1, 0xc7, 0xb0, 0x3c, 0x48, 0x36, 0x7b, 0x10, 0xf0,
+	0x11, 0x23, 0x82, 0x9c, 0x38, 0xcd, 0xae, 0xb1, 0x65, 0x79, 0x25, 0x69, 0x45, 0xef, 0xd0, 0xb1,
+	0x6a, 0xf4, 0x0e, 0xd1, 0x26, 0x80, 0x94, 0x0c, 0x83, 0x90, 0x9c, 0x38, 0x2d, 0xa9, 0xa3, 0x49,
+	0x0a, 0xdf, 0x0f, 0x9d, 0x85, 0xd2, 0xf7, 0xc3, 0x8d, 0x1f, 0x61, 0xbd, 0x3e, 0x65, 0xe8, 0x1e,
+	0x98, 0x97, 0x64, 0x9a, 0x56, 0x28, 0xf9, 0x89, 0x3e, 0x05, 0xeb, 0x0a, 0x87, 0x13, 0x22, 0xbb,
+	0xbc, 0xae, 0x15, 0x66, 0x10, 0x4f, 0x29, 0xee, 0x36, 0x3e, 0x37, 0x36, 0x2e, 0x60, 0xe3, 0xe6,
+	0x34, 0xd5, 0x78, 0x79, 0x5a, 0xf4, 0xb2, 0x79, 0x73, 0xc3, 0x95, 0x3c, 0xb9, 0x7f, 0x36, 0xa0,
+	0x75, 0x1c, 0xe2, 0x29, 0x61, 0xc9, 0x99, 0x0d, 0x7c, 0x49, 0xb5, 0xbc, 0x46, 0xe0, 0xab, 0xa3,
+	0xda, 0x28, 0x1c, 0x55, 0x53, 0xad, 0xa6, 0xe8, 0x21, 0x98, 0x7e, 0xc0, 0x9c, 0xe6, 0x0d, 0x9b,
+	0x9a, 0x5d, 0x0c, 0x5e, 0xa2, 0x86, 0xde, 0x03, 0x8b, 0xc7, 0x84, 0xf8, 0x69, 0x3d, 0xd4, 0x02,
+	0x75, 0xa1, 0x7d, 0x2a, 0xdb, 0x63, 0x20, 0xb0, 0x20, 0x69, 0x1d, 0x74, 0x11, 0x7a, 0x08, 0xab,
+	0x21, 0xe6, 0xe2, 0x88, 0x5e, 0x91, 0xe7, 0x63, 0x71, 0x14, 0x84, 0x61, 0xc0, 0xd3, 0x7a, 0x54,
+	0x3f, 0x48, 0x2f, 0x23, 0xca, 0x88, 0x03, 0xa9, 0x97, 0x64, 0x81, 0x1c, 0x58, 0x60, 0x64, 0x4c,
+	0xaf, 0x88, 0xef, 0xb4, 0xbb, 0xc6, 0xd6, 0xa2, 0x97, 0x2d, 0x93, 0x43, 0xf5, 0x13, 0x0d, 0xa2,
+	0x7e, 0xe4, 0x93, 0x6b, 0xa7, 0x23, 0x6d, 0x72, 0x81, 0xfb, 0x8b, 0x01, 0xa0, 0x12, 0x73, 0x44,
+	0x04, 0xae, 0x24, 0x07, 0x41, 0x33, 0x4a, 0x0e, 0x63, 0x43, 0x16, 0x41, 0xfe, 0x4e, 0x36, 0xe4,
+	0x07, 0x3c, 0x0e, 0xf1, 0x54, 0x9e, 0x53, 0x53, 0x7e, 0xd2, 0x45, 0x68, 0x1d, 0x5a, 0xf8, 0x0a,
+	0x0b, 0xac, 0x32, 0x67, 0x7b, 0xe9, 0xaa, 0x18, 0x8a, 0x55, 0x0e, 0xe5, 0x2f, 0x03, 0x16, 0x87,
+	0x69, 0x86, 0x2b, 0x81, 0x6c, 0xc1, 0x4a, 0x48, 0x47, 0x38, 0xec, 0xfb, 0xfd, 0x48, 0x9d, 0x36,
+	0x19, 0x93, 0xe5, 0x95, 0xc5, 0x79, 0x7e, 0x4c, 0x3d, 0x3f, 0xb2, 0xca, 0xcd, 0x42, 0x95, 0xad,
+	0xac, 0xca, 0x5a, 0xee, 0x5a, 0xc5, 0xdc, 0x21, 0x68, 0x8a, 0x69, 0x4c, 0xd2, 0x62, 0xc8, 0xdf,
+	0xee, 0xbf, 0x06, 0xb4, 0x9e, 0x4d, 0xc2, 0x90, 0x88, 0xba, 0xa0, 0x8c, 0xfa, 0xa0, 0xba, 0xd0,
+	0x0e, 0x83, 0x88, 0x60, 0x36, 0x90, 0x0d, 0xa2, 0xda, 0x4d, 0x17, 0xa9, 0x00, 0xcd, 0x42, 0x80,
+	0xcd, 0x9a, 0x00, 0xad, 0x62, 0x80, 0xbb, 0xd0, 0xe1, 0x02, 0x33, 0xb1, 0x27, 0xe4, 0x7d, 0x2f,
+	0xe3, 0xbf, 0xf9, 0x52, 0x2f, 0xe8, 0xa2, 0xcf, 0x00, 0x48, 0xe4, 0x67, 0x96, 0x0b, 0xb7, 0x5a,
+	0x6a, 0x9a, 0xee, 0xaf, 0x06, 0x34, 0x87, 0x0c, 0xc7, 0x6f, 0x51, 0xa3, 0x2c, 0xaf, 0x66, 0x9e,
+	0xd7, 0xbb, 0x55, 0xc8, 0xfd, 0xdd, 0x00, 0x5b, 0x26, 0x70, 0x70, 0x41, 0xdf, 0xa6, 0x6b, 0xee,
+	0x96, 0xfe, 0x6c, 0x1f, 0x2d, 0xad, 0x3f, 0x7e, 0x33, 0x60, 0xe1, 0x78, 0x32, 0x8e, 0x2f, 0x83,
+	0xe8, 0xdd, 0x37, 0x88, 0xfb, 0x87, 0x01, 0xf0, 0x7c, 0x82, 0x99, 0x3f, 0xa4, 0x6f, 0x6a, 0x2e,
+	0xbf, 0x77, 0x51, 0xb2, 0xbf, 0xdb, 0xb0, 0xea, 0x51, 0x3a, 0x3e, 0x48, 0xe7, 0xaf, 0xaf, 0x93,
+	0xf1, 0xab, 0x12, 0xd9, 0x26, 0x00, 0x23, 0x67, 0xf2, 0x5b, 0xdf, 0x4f, 0x83, 0xd2, 0x24, 0xa8,
+	0x0f, 0x0b, 0xb1, 0xbc, 0xb7, 0x78, 0xfa, 0x2a, 0x3f, 0xae, 0xb4, 0x6e, 0xc5, 0x49, 0x4f, 0xdd,
+	0x74, 0x5c, 0x3d, 0xc3, 0x99, 0x7d, 0x72, 0x5d, 0x71, 0x12, 0x89, 0x3d, 0x21, 0xf7, 0x62, 0x7a,
+	0xe9, 0x2a, 0x79, 0x68, 0x47, 0x74, 0x12, 0x89, 0x64, 0x50, 0x7c, 0x81, 0x23, 0xca, 0xe5, 0xee,
+	0x4c, 0xaf, 0x24, 0x45, 0x2f, 0xc1, 0xce, 0x5c, 0x73, 0xa7, 0x25, 0x83, 0xd9, 0x9e, 0x23, 0x98,
+	0xec, 0xae, 0x4b, 0xc3, 0xc9, 0x19, 0x68, 0x1f, 0x2c, 0xc1, 0x70, 0x9c, 0x3c, 0x02, 0x09, 0xec,
+	0xd1, 0x5c, 0x30, 0x1c, 0xa7, 0x20, 0x65, 0x9b, 0x24, 0xe8, 0x54, 0x5e, 0x53, 0xdc, 0x59, 0x9c,
+	0x3b, 0x41, 0xea, 0x62, 0xcb, 0x12, 0x94, 0xda, 0x23, 0x0f, 0x80, 0x67, 0x67, 0x8c, 0x3b, 0xb6,
+	0xa4, 0xed, 0xcc, 0x41, 0x9b, 0x1d, 0xcc, 0x14, 0xa8, 0x51, 0x64, 0xfd, 0xd4, 0x29, 0x71, 0x60,
+	0xfe, 0xfa, 0x29, 0x8b, 0xac, 0x7e, 0x6a, 0x85, 0x5e, 0x41, 0xfb, 0x7c, 0xd6, 0xe2, 0xdc, 0x69,
+	0x4b, 0xdc, 0x93, 0x39, 0x70, 0xf9, 0xc1, 0x48, 0x03, 0xd4, 0x39, 0x09, 0x36, 0x9e, 0xbd, 0x8c,
+	0xdc, 0xe9, 0xcc, 0x8d, 0xcd, 0xdf, 0xd3, 0x0c, 0xab, 0x71, 0x36, 0x06, 0xd0, 0xd1, 0xdb, 0x50,
+	0x1f, 0x73, 0x2c, 0x35, 0xe6, 0x3c, 0x2a, 0x8e, 0x39, 0xef, 0x57, 0xc7, 0x1c, 0x69, 0xaf, 0x4f,
+	0x52, 0x27, 0xb0, 0x5c, 0x6c, 0xa7, 0x1a, 0xec, 0xe3, 0x22, 0xf6, 0x7e, 0x05, 0x9b, 0x11, 0x74,
+	0xf0, 0x4b, 0x80, 0xbc, 0xb5, 0x6a, 0xa0, 0x0f, 0x8a, 0xd0, 0xb5, 0x1a, 0x28, 0x8e, 0x75, 0xe0,
+	0x00, 0x3a, 0x7a, 0x93, 0xdd, 0x65, 0xfb, 0xca, 0x5e, 0x87, 0x7e, 0x0f, 0x2b, 0xa5, 0x5e, 0xab,
+	0xe1, 0xfe, 0xef, 0x8c, 0x3a, 0x43, 0xe8, 0xe8, 0x21, 0x74, 0xf4, 0xae, 0xab, 0xe1, 0xf6, 0x8a,
+	0x5c, 0xa7, 0x5a, 0x2e, 0x65, 0xaf, 0x53, 0x7f, 0x80, 0x7b, 0xe5, 0xe6, 0xab, 0x21, 0x6f, 0x17,
+	0xc9, 0x1f, 0x54, 0xc8, 0x39, 0xa3, 0x04, 0x2f, 0xb7, 0xe0, 0x5d, 0xe0, 0x39, 0x43, 0x9f, 0xa4,
+	0x39, 0xac, 0xa8, 0x0f, 0xaf, 0xe2, 0xa4, 0xe3, 0xf7, 0xc7, 0x3e, 0x82, 0xfc, 0xea, 0x46, 0xf6,
+	0x6c, 0x9a, 0x46, 0xf6, 0x6c, 0x94, 0x46, 0x9f, 0xcc, 0x39, 0x47, 0xa3, 0x35, 0x58, 0xc2, 0xa3,
+	0xcb, 0x20, 0x3a, 0xcf, 0x2e, 0x7e, 0x39, 0x25, 0xba, 0xdb, 0x60, 0x9d, 0x70, 0x8f, 0xfc, 0x8c,
+	0x96, 0xc0, 0x1a, 0xf3, 0xf3, 0x7e, 0xe6, 0xad, 0x0d, 0x26, 0x1e, 0x09, 0x35, 0x9d, 0xa2, 0x0e,
+	0x34, 0x7d, 0x2c, 0xb0, 0x74, 0xd9, 0x39, 0x6d, 0xc9, 0xff, 0xf3, 0x4f, 0xfe, 0x1b, 0x00, 0xc3,
+	0xdc, 0xac, 0xaf, 0xec, 0x0f, 0x00, 0x00,
 }
@@ -0,0 +1,176 @@
+package render
+
+import (
+	"AI/astar"
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+//叠加在地图上的内容, 坐标与astar.Map的下标一致(X为列, Y为行)
+type Overlay struct {
+	Path      []astar.Point
+	Treasures []astar.Point
+	Start     *astar.Point
+	Goal      *astar.Point
+}
+
+const (
+	ASCII_ROAD     = '.'
+	ASCII_BARRIER  = '#'
+	ASCII_PATH     = '*'
+	ASCII_TREASURE = '$'
+	ASCII_START    = 'S'
+	ASCII_GOAL     = 'G'
+)
+
+var (
+	COLOR_ROAD     = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	COLOR_BARRIER  = color.RGBA{0x99, 0x33, 0x33, 0xff}
+	COLOR_PATH     = color.RGBA{0x33, 0xcc, 0x33, 0xff}
+	COLOR_TREASURE = color.RGBA{0xff, 0xcc, 0x33, 0xff}
+	COLOR_START    = color.RGBA{0x33, 0x99, 0xff, 0xff}
+	COLOR_GOAL     = color.RGBA{0xff, 0x66, 0xff, 0xff}
+	COLOR_GRID     = color.RGBA{0x11, 0x11, 0x11, 0xff}
+)
+
+//每个格子的内容, 后面的覆盖前面的
+func cells(m astar.Map, overlay Overlay) [][]byte {
+	result := make([][]byte, len(m))
+	for row := range m {
+		result[row] = make([]byte, len(m[row]))
+		for col := range m[row] {
+			if m[row][col] == astar.BARRIER {
+				result[row][col] = ASCII_BARRIER
+			} else {
+				result[row][col] = ASCII_ROAD
+			}
+		}
+	}
+	mark := func(pt astar.Point, c byte) {
+		if pt.Y >= 0 && pt.Y < len(result) && pt.X >= 0 && pt.X < len(result[pt.Y]) {
+			result[pt.Y][pt.X] = c
+		}
+	}
+	for _, pt := range overlay.Path {
+		mark(pt, ASCII_PATH)
+	}
+	for _, pt := range overlay.Treasures {
+		mark(pt, ASCII_TREASURE)
+	}
+	if overlay.Start != nil {
+		mark(*overlay.Start, ASCII_START)
+	}
+	if overlay.Goal != nil {
+		mark(*overlay.Goal, ASCII_GOAL)
+	}
+	return result
+}
+
+//不带颜色的文本, 每行一个地图行, 适合贴到bug报告中, 不会修改m
+func ASCII(m astar.Map, overlay Overlay) string {
+	var sb strings.Builder
+	for _, row := range cells(m, overlay) {
+		sb.Write(row)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+//每个格子画成cellSize*cellSize像素, 不会修改m
+func Image(m astar.Map, overlay Overlay, cellSize int) *image.RGBA {
+	if cellSize < 1 {
+		cellSize = 1
+	}
+	grid := cells(m, overlay)
+	width := 0
+	for _, row := range grid {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width*cellSize, len(grid)*cellSize))
+	for row := range grid {
+		for col, c := range grid[row] {
+			fill := colorOf(c)
+			for y := 0; y < cellSize; y++ {
+				for x := 0; x < cellSize; x++ {
+					//格子之间留一像素的分隔线
+					if cellSize > 3 && (x == cellSize-1 || y == cellSize-1) {
+						img.SetRGBA(col*cellSize+x, row*cellSize+y, COLOR_GRID)
+					} else {
+						img.SetRGBA(col*cellSize+x, row*cellSize+y, fill)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+func PNG(w io.Writer, m astar.Map, overlay Overlay, cellSize int) error {
+	return png.Encode(w, Image(m, overlay, cellSize))
+}
+
+func colorOf(c byte) color.RGBA {
+	switch c {
+	case ASCII_BARRIER:
+		return COLOR_BARRIER
+	case ASCII_PATH:
+		return COLOR_PATH
+	case ASCII_TREASURE:
+		return COLOR_TREASURE
+	case ASCII_START:
+		return COLOR_START
+	case ASCII_GOAL:
+		return COLOR_GOAL
+	default:
+		return COLOR_ROAD
+	}
+}
+
+//读取文本地图, 每行一个地图行, 可以是astar.PrintArray输出的"0 1 0"或ASCII输出的".#.",
+//ASCII中的'S'和'G'会作为起点和终点返回, '*'和'$'视为可走的格子
+func ParseGrid(r io.Reader) (m astar.Map, start *astar.Point, goal *astar.Point, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var row []int
+		for _, c := range strings.Replace(line, " ", "", -1) {
+			pt := astar.Point{X: len(row), Y: len(m)}
+			switch c {
+			case '0', ASCII_ROAD, ASCII_PATH, ASCII_TREASURE:
+				row = append(row, astar.ROAD)
+			case '1', ASCII_BARRIER:
+				row = append(row, astar.BARRIER)
+			case ASCII_START:
+				start = &pt
+				row = append(row, astar.ROAD)
+			case ASCII_GOAL:
+				goal = &pt
+				row = append(row, astar.ROAD)
+			default:
+				return nil, nil, nil, fmt.Errorf("unexpected %q at line %d", c, len(m)+1)
+			}
+		}
+		if len(m) > 0 && len(row) != len(m[0]) {
+			return nil, nil, nil, fmt.Errorf("line %d has %d cells, expected %d", len(m)+1, len(row), len(m[0]))
+		}
+		m = append(m, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(m) == 0 {
+		return nil, nil, nil, errors.New("empty map")
+	}
+	return m, start, goal, nil
+}
@@ -0,0 +1,50 @@
+package render
+
+import (
+	"AI/astar"
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestASCIIDoesNotTouchMap(t *testing.T) {
+	if _, _, _, err := ParseGrid(strings.NewReader("S.#\n..#\n...G\n")); err == nil {
+		t.Fatalf("expected an error for a ragged grid")
+	}
+	m, start, goal, err := ParseGrid(strings.NewReader("S.#.\n..#.\n...G\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := ASCII(m, Overlay{})
+	path, err := astar.AstarByStartAndGoalPoint(m, *start, *goal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := Overlay{
+		Start:     start,
+		Goal:      goal,
+		Treasures: []astar.Point{{X: 3, Y: 0}},
+		Path:      path,
+	}
+	got := ASCII(m, overlay)
+	want := "S.#$\n.*#.\n..*G\n"
+	if got != want {
+		t.Errorf("ASCII() = %q, want %q", got, want)
+	}
+	if after := ASCII(m, Overlay{}); after != before {
+		t.Errorf("map was modified: %q -> %q", before, after)
+	}
+
+	var buf bytes.Buffer
+	if err := PNG(&buf, m, overlay, 4); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 12 {
+		t.Errorf("unexpected image size %v", b)
+	}
+}
@@ -0,0 +1,288 @@
+//比赛录像: bot收到的BattleColliderInfo和下行帧以及发出的上行指令, 用于事后排查玩家反馈的问题.
+//
+//文件以MAGIC和uvarint的VERSION开头, 之后是一串记录, 每条记录为:
+//
+//	1字节Kind | uvarint的At(纳秒) | uvarint的数据长度 | 数据
+//
+//第一条记录总是KIND_META. 进程异常退出时末尾可能只写了半条记录, Reader会在此处返回io.ErrUnexpectedEOF.
+package replay
+
+import (
+	"AI/config"
+	pb "AI/pb_output"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	MAGIC   = "AIREPLAY"
+	VERSION = 1
+)
+
+const (
+	KIND_META                 byte = 1 //json编码的Meta
+	KIND_BATTLE_COLLIDER_INFO byte = 2 //uvarint的BoundRoomId, 之后是收到的pb.BattleColliderInfo原始字节
+	KIND_DOWNSYNC_FRAME       byte = 3 //收到的pb.RoomDownsyncFrame原始字节
+	KIND_UPSYNC               byte = 4 //8字节小端float64的dt(该tick距上一tick的秒数), 之后是pb.PlayerUpsyncCmd
+)
+
+//单条记录的数据超过此长度时视为文件损坏
+const maxRecordSize = 16 << 20
+
+var ErrBadMagic = errors.New("Not a replay file")
+
+type Meta struct {
+	BotName        string          `json:"botName"`
+	PlayerId       int32           `json:"playerId"`
+	UpsyncRate     int             `json:"upsyncRate"`
+	UpsyncEncoding string          `json:"upsyncEncoding"`
+	Ai             config.AiConfig `json:"ai"`
+	StartedAt      time.Time       `json:"startedAt"`
+}
+
+type Record struct {
+	Kind byte
+	At   time.Duration //距Meta.StartedAt的时间, 下行数据为收到的时间
+	Data []byte
+}
+
+//录像文件名, 不同bot和同一bot的多场比赛不会重名
+func FileName(botName string, playerId int32, startedAt time.Time) string {
+	return fmt.Sprintf("%s-%d-%s.replay", botName, playerId, startedAt.Format("20060102-150405.000"))
+}
+
+//不是并发安全的, 应由同一个goroutine写入. 写入出错后之后的写入都会被忽略, 错误由Close返回
+type Writer struct {
+	w      *bufio.Writer
+	closer io.Closer
+	start  time.Time
+	buf    [binary.MaxVarintLen64]byte
+	err    error
+}
+
+func NewWriter(w io.Writer, meta Meta) (*Writer, error) {
+	writer := &Writer{
+		w:     bufio.NewWriter(w),
+		start: meta.StartedAt,
+	}
+	if closer, ok := w.(io.Closer); ok {
+		writer.closer = closer
+	}
+	writer.w.WriteString(MAGIC)
+	writer.writeUvarint(VERSION)
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	writer.writeRecord(KIND_META, meta.StartedAt, metaBytes)
+	if writer.err != nil {
+		return nil, writer.err
+	}
+	return writer, nil
+}
+
+func Create(path string, meta Meta) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewWriter(f, meta)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) WriteBattleColliderInfo(at time.Time, boundRoomId int, raw []byte) error {
+	n := binary.PutUvarint(w.buf[:], uint64(boundRoomId))
+	data := make([]byte, 0, n+len(raw))
+	data = append(data, w.buf[:n]...)
+	data = append(data, raw...)
+	return w.writeRecord(KIND_BATTLE_COLLIDER_INFO, at, data)
+}
+
+func (w *Writer) WriteDownsyncFrame(at time.Time, raw []byte) error {
+	return w.writeRecord(KIND_DOWNSYNC_FRAME, at, raw)
+}
+
+func (w *Writer) WriteUpsync(at time.Time, dt float64, cmd *pb.PlayerUpsyncCmd) error {
+	cmdBytes, err := proto.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 8, 8+len(cmdBytes))
+	binary.LittleEndian.PutUint64(data, math.Float64bits(dt))
+	data = append(data, cmdBytes...)
+	return w.writeRecord(KIND_UPSYNC, at, data)
+}
+
+func (w *Writer) writeRecord(kind byte, at time.Time, data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	elapsed := at.Sub(w.start)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	w.w.WriteByte(kind)
+	w.writeUvarint(uint64(elapsed))
+	w.writeUvarint(uint64(len(data)))
+	_, w.err = w.w.Write(data)
+	return w.err
+}
+
+func (w *Writer) writeUvarint(v uint64) {
+	n := binary.PutUvarint(w.buf[:], v)
+	if _, err := w.w.Write(w.buf[:n]); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+//写出缓冲的数据, 并关闭NewWriter传入的io.Closer
+func (w *Writer) Close() error {
+	err := w.w.Flush()
+	if w.err == nil {
+		w.err = err
+	}
+	if w.closer != nil {
+		if err := w.closer.Close(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	return w.err
+}
+
+type Reader struct {
+	r    *bufio.Reader
+	Meta Meta
+}
+
+//读取文件头和Meta
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(MAGIC))
+	if _, err := io.ReadFull(reader.r, magic); err != nil || string(magic) != MAGIC {
+		return nil, ErrBadMagic
+	}
+	version, err := binary.ReadUvarint(reader.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if version != VERSION {
+		return nil, fmt.Errorf("Unsupported replay version %d", version)
+	}
+	record, err := reader.Next()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if record.Kind != KIND_META {
+		return nil, fmt.Errorf("Expected the meta record first, got kind %d", record.Kind)
+	}
+	if err := json.Unmarshal(record.Data, &reader.Meta); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+//读到文件末尾时返回io.EOF
+func (r *Reader) Next() (*Record, error) {
+	kind, err := r.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	at, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("Record of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, unexpected(err)
+	}
+	return &Record{Kind: kind, At: time.Duration(at), Data: data}, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+//读出整个文件, 末尾不完整时返回已读到的记录和io.ErrUnexpectedEOF
+func ReadFile(path string) (Meta, []*Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	defer f.Close()
+	reader, err := NewReader(f)
+	if err != nil {
+		return Meta{}, nil, err
+	}
+	var records []*Record
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return reader.Meta, records, nil
+		}
+		if err != nil {
+			return reader.Meta, records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func (r *Record) BattleColliderInfo() (int, *pb.BattleColliderInfo, error) {
+	if r.Kind != KIND_BATTLE_COLLIDER_INFO {
+		return 0, nil, fmt.Errorf("Record of kind %d is not a BattleColliderInfo", r.Kind)
+	}
+	boundRoomId, n := binary.Uvarint(r.Data)
+	if n <= 0 {
+		return 0, nil, errors.New("Bad BoundRoomId of BattleColliderInfo record")
+	}
+	info := new(pb.BattleColliderInfo)
+	if err := proto.Unmarshal(r.Data[n:], info); err != nil {
+		return 0, nil, err
+	}
+	return int(boundRoomId), info, nil
+}
+
+func (r *Record) DownsyncFrame() (*pb.RoomDownsyncFrame, error) {
+	if r.Kind != KIND_DOWNSYNC_FRAME {
+		return nil, fmt.Errorf("Record of kind %d is not a RoomDownsyncFrame", r.Kind)
+	}
+	frame := new(pb.RoomDownsyncFrame)
+	if err := proto.Unmarshal(r.Data, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func (r *Record) Upsync() (float64, *pb.PlayerUpsyncCmd, error) {
+	if r.Kind != KIND_UPSYNC || len(r.Data) < 8 {
+		return 0, nil, fmt.Errorf("Record of kind %d is not an upsync command", r.Kind)
+	}
+	dt := math.Float64frombits(binary.LittleEndian.Uint64(r.Data))
+	cmd := new(pb.PlayerUpsyncCmd)
+	if err := proto.Unmarshal(r.Data[8:], cmd); err != nil {
+		return 0, nil, err
+	}
+	return dt, cmd, nil
+}
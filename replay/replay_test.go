@@ -0,0 +1,108 @@
+package replay
+
+import (
+	"AI/config"
+	pb "AI/pb_output"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func writeSample(t *testing.T) (*bytes.Buffer, Meta) {
+	var buf bytes.Buffer
+	start := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	meta := Meta{BotName: "bot1", PlayerId: 7, UpsyncRate: 20, UpsyncEncoding: "pb", Ai: config.Default().Ai, StartedAt: start}
+	w, err := NewWriter(&buf, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := proto.Marshal(&pb.BattleColliderInfo{StageName: "pacman", StageDiscreteW: 8})
+	frame, _ := proto.Marshal(&pb.RoomDownsyncFrame{Id: 1, Players: map[int32]*pb.Player{7: {Id: 7, X: 10}}})
+	w.WriteBattleColliderInfo(start.Add(time.Millisecond), 5, info)
+	w.WriteDownsyncFrame(start.Add(2*time.Millisecond), frame)
+	w.WriteUpsync(start.Add(3*time.Millisecond), 0.05, &pb.PlayerUpsyncCmd{Id: 7, X: 12.5, AckingFrameId: 1})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, meta
+}
+
+func TestWriteAndRead(t *testing.T) {
+	buf, meta := writeSample(t)
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Meta.StartedAt.Equal(meta.StartedAt) || r.Meta.BotName != "bot1" || r.Meta.PlayerId != 7 || r.Meta.Ai != meta.Ai {
+		t.Errorf("unexpected meta %+v", r.Meta)
+	}
+
+	record, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roomId, info, err := record.BattleColliderInfo()
+	if err != nil || roomId != 5 || info.StageName != "pacman" || record.At != time.Millisecond {
+		t.Errorf("unexpected collider record %d %v %v at %v", roomId, info, err, record.At)
+	}
+	record, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := record.DownsyncFrame()
+	if err != nil || frame.Id != 1 || frame.Players[7].X != 10 || record.At != 2*time.Millisecond {
+		t.Errorf("unexpected frame %v %v", frame, err)
+	}
+	if _, _, err := record.Upsync(); err == nil {
+		t.Errorf("expected a kind mismatch error")
+	}
+	record, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dt, cmd, err := record.Upsync()
+	if err != nil || dt != 0.05 || cmd.X != 12.5 || cmd.AckingFrameId != 1 {
+		t.Errorf("unexpected upsync %v %v %v", dt, cmd, err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadTruncatedAndInvalid(t *testing.T) {
+	buf, _ := writeSample(t)
+	truncated := buf.Bytes()[:buf.Len()-3]
+	r, err := NewReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for {
+		_, err = r.Next()
+		if err != nil {
+			break
+		}
+		n++
+	}
+	if n != 2 || err != io.ErrUnexpectedEOF {
+		t.Errorf("expected 2 complete records and io.ErrUnexpectedEOF, got %d %v", n, err)
+	}
+
+	if _, err := NewReader(strings.NewReader("not a replay")); err != ErrBadMagic {
+		t.Errorf("expected ErrBadMagic, got %v", err)
+	}
+	if _, err := NewReader(strings.NewReader(MAGIC + "\x02")); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("expected an unsupported version error, got %v", err)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	name := FileName("bot1", 7, time.Date(2019, 5, 1, 12, 0, 0, 250e6, time.UTC))
+	if name != "bot1-7-20190501-120000.250.replay" {
+		t.Errorf("unexpected file name %s", name)
+	}
+}
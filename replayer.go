@@ -0,0 +1,101 @@
+package main
+
+import (
+	"AI/logging"
+	pb "AI/pb_output"
+	"AI/replay"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/golang/protobuf/proto"
+	"go.uber.org/zap"
+)
+
+//重放出的上行指令与录像中的第一处不同, Actual为nil表示重放时没有上行
+type replayMismatch struct {
+	Index    int //第几条上行指令, 从0开始
+	At       float64
+	Expected *pb.PlayerUpsyncCmd
+	Actual   *pb.PlayerUpsyncCmd
+}
+
+type replayReport struct {
+	Upsyncs  int //录像中的上行指令数
+	Mismatch *replayMismatch
+}
+
+//用录像中的下行数据驱动Client并比较产生的上行指令. 每条上行指令对应原来的一个tick: 与上一条之间的下行数据按录像顺序
+//在这个tick中处理, 录像中的dt作为虚拟时钟, 依次调用与上行goroutine相同的consumeDownsyncEvents, advance, upsyncCmd和rememberSentPosition.
+//最后一条上行指令之后的下行数据不影响结果, 直接忽略
+func replayRecords(meta replay.Meta, records []*replay.Record) (*replayReport, error) {
+	client := newClient(nil, meta.PlayerId, spawnBotOptions{
+		UpsyncEncoding: meta.UpsyncEncoding,
+		UpsyncRate:     meta.UpsyncRate,
+		Ai:             meta.Ai,
+	})
+	client.BotName = meta.BotName
+	client.setLogger(zap.L().With(logging.Bot(meta.BotName), logging.PlayerId(meta.PlayerId)))
+	//一个tick中的下行数据全部放进downsyncEvents, 不能阻塞
+	client.downsyncEvents = make(chan downsyncEvent, len(records))
+
+	report := &replayReport{}
+	for _, record := range records {
+		switch record.Kind {
+		case replay.KIND_BATTLE_COLLIDER_INFO:
+			boundRoomId, battleColliderInfo, err := record.BattleColliderInfo()
+			if err != nil {
+				return nil, err
+			}
+			client.pushDownsyncEvent(downsyncEvent{
+				BoundRoomId:        boundRoomId,
+				BattleColliderInfo: battleColliderInfo,
+			})
+		case replay.KIND_DOWNSYNC_FRAME:
+			if err := client.decodeProtoBuf(record.Data); err != nil {
+				return nil, fmt.Errorf("Downsync frame at %v: %v", record.At, err)
+			}
+		case replay.KIND_UPSYNC:
+			dt, expected, err := record.Upsync()
+			if err != nil {
+				return nil, err
+			}
+			client.consumeDownsyncEvents()
+			client.advance(int(math.Round(dt / client.Ticker.Interval.Seconds())))
+			actual := client.upsyncCmd()
+			if actual != nil {
+				client.rememberSentPosition()
+			}
+			if !proto.Equal(expected, actual) {
+				report.Mismatch = &replayMismatch{
+					Index:    report.Upsyncs,
+					At:       record.At.Seconds(),
+					Expected: expected,
+					Actual:   actual,
+				}
+				return report, nil
+			}
+			report.Upsyncs++
+		}
+	}
+	return report, nil
+}
+
+//-replay: 重放录像并打印结果, 上行指令不一致时返回错误
+func runReplay(path string, out io.Writer) error {
+	meta, records, err := replay.ReadFile(path)
+	if err == io.ErrUnexpectedEOF {
+		fmt.Fprintf(out, "%s is truncated, replaying %d complete records\n", path, len(records))
+	} else if err != nil {
+		return err
+	}
+	report, err := replayRecords(meta, records)
+	if err != nil {
+		return err
+	}
+	if mismatch := report.Mismatch; mismatch != nil {
+		return fmt.Errorf("Upsync %d at %.3fs of bot %s differs, recorded %v, replayed %v", mismatch.Index, mismatch.At, meta.BotName, mismatch.Expected, mismatch.Actual)
+	}
+	fmt.Fprintf(out, "replayed %d upsyncs of bot %s, player %d, all identical\n", report.Upsyncs, meta.BotName, meta.PlayerId)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"AI/replay"
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var updateGolden = flag.Bool("update", false, "re-record the golden replays in testdata/replays against the fake server")
+
+const goldenReplay = "testdata/replays/pacman.replay"
+
+func countUpsyncs(records []*replay.Record) int {
+	n := 0
+	for _, record := range records {
+		if record.Kind == replay.KIND_UPSYNC {
+			n++
+		}
+	}
+	return n
+}
+
+//录像时AI在真实的上下行goroutine中运行, 重放时应得到完全相同的上行指令
+func TestReplayReproducesRecordedMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	meta, records, err := replay.ReadFile(recordFakeMatch(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := replayRecords(meta, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Mismatch != nil {
+		t.Fatalf("upsync %d differs, recorded %v, replayed %v", report.Mismatch.Index, report.Mismatch.Expected, report.Mismatch.Actual)
+	}
+	if report.Upsyncs == 0 || report.Upsyncs != countUpsyncs(records) {
+		t.Errorf("expected all %d upsyncs to be replayed, got %d", countUpsyncs(records), report.Upsyncs)
+	}
+}
+
+func TestReplayDetectsDivergence(t *testing.T) {
+	meta, records, err := replay.ReadFile(goldenReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//把第10条上行指令的坐标挪开一点, 模拟AI的行为发生了变化
+	index := 0
+	for i, record := range records {
+		if record.Kind != replay.KIND_UPSYNC {
+			continue
+		}
+		if index == 10 {
+			dt, cmd, err := record.Upsync()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd.X += 0.01
+			var buf bytes.Buffer
+			w, _ := replay.NewWriter(&buf, meta)
+			w.WriteUpsync(meta.StartedAt.Add(record.At), dt, cmd)
+			w.Close()
+			r, _ := replay.NewReader(&buf)
+			if records[i], err = r.Next(); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+		index++
+	}
+	report, err := replayRecords(meta, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Mismatch == nil || report.Mismatch.Index != 10 || report.Upsyncs != 10 || proto.Equal(report.Mismatch.Expected, report.Mismatch.Actual) {
+		t.Errorf("expected upsync 10 to differ, got %+v", report)
+	}
+}
+
+//AI的行为改变后这里会失败, 确认改变符合预期后用"go test -run TestReplayGolden -update"重新录制
+func TestReplayGolden(t *testing.T) {
+	if *updateGolden {
+		dir, err := ioutil.TempDir("", "replays")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		recorded, err := ioutil.ReadFile(recordFakeMatch(t, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(goldenReplay), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(goldenReplay, recorded, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := filepath.Glob("testdata/replays/*.replay")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden replays: %v", err)
+	}
+	for _, path := range files {
+		var out bytes.Buffer
+		if err := runReplay(path, &out); err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if !strings.Contains(out.String(), "all identical") {
+			t.Errorf("%s: unexpected output %s", path, out.String())
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"AI/config"
+	"AI/logging"
+	"AI/login"
+	"AI/models"
+	"fmt"
+	"reflect"
+
+	"go.uber.org/zap"
+)
+
+//一个游戏服务器分片以及专门为它服务的bot池
+type shard struct {
+	config     config.ShardConfig
+	botManager *models.BotManager
+	login      *login.Client //token按分片缓存, 同一个手机号在不同分片上是不同的玩家
+
+	//以下只由loadBotPools读写, 它在启动时和SIGHUP的处理goroutine中依次调用, 不会并发
+	pool        *models.BotPoolConfig //最近一次生效的bot池
+	provisioned map[string]bool       //已经登录创建过账号的手机号, 重新加载时不再登录
+}
+
+func newShards(cfg *config.Config) []*shard {
+	shardConfigs := cfg.ShardList()
+	shards := make([]*shard, len(shardConfigs))
+	for i, shardConfig := range shardConfigs {
+		loginClient := login.NewClient(shardConfig.GameServer.BaseUrl())
+		loginClient.MaxAttempts = cfg.Login.MaxAttempts
+		loginClient.Backoff = cfg.Login.Backoff
+		loginClient.MaxBackoff = cfg.Login.MaxBackoff
+		loginClient.HttpClient.Timeout = cfg.Login.HttpTimeout
+		loginClient.Log = zap.L().With(logging.Shard(shardConfig.Name))
+		shards[i] = &shard{
+			config:      shardConfig,
+			botManager:  new(models.BotManager),
+			login:       loginClient,
+			provisioned: make(map[string]bool),
+		}
+	}
+	return shards
+}
+
+//加载所有分片的bot池, bot名字在所有分片间必须唯一, 因为/stopBot和telemetry等接口只以botName区分bot. 任一分片出错时都不生效.
+//SIGHUP也用于重新打开日志文件, 内容没有变化的bot池不重新生效, 避免每次日志轮转都重新登录所有账号
+func loadBotPools(shards []*shard) error {
+	configs := make([]*models.BotPoolConfig, len(shards))
+	owners := make(map[string]string)
+	for i, s := range shards {
+		poolConfig, err := models.LoadBotPoolConfig(s.config.BotPoolPath)
+		if err != nil {
+			return fmt.Errorf("shard %s: %v", s.config.Name, err)
+		}
+		for _, account := range poolConfig.Bots {
+			if owner, ok := owners[account.Name]; ok {
+				return fmt.Errorf("bot %s is configured in both shard %s and shard %s", account.Name, owner, s.config.Name)
+			}
+			owners[account.Name] = s.config.Name
+		}
+		configs[i] = poolConfig
+	}
+	for i, s := range shards {
+		if reflect.DeepEqual(s.pool, configs[i]) {
+			zap.L().Debug("Bot pool unchanged", logging.Shard(s.config.Name), zap.String("path", s.config.BotPoolPath))
+			continue
+		}
+		if configs[i].Provision {
+			s.provisionBots(configs[i].Bots)
+		}
+		s.botManager.SetAccounts(configs[i].Bots)
+		s.pool = configs[i]
+		zap.L().Info("Loaded bot pool", logging.Shard(s.config.Name), zap.Int("bots", len(configs[i].Bots)), zap.String("path", s.config.BotPoolPath))
+	}
+	return nil
+}
+
+//逐个登录以创建缺少的账号, 已经创建过的跳过, 失败的在下次加载时重试
+func (s *shard) provisionBots(accounts []models.BotAccount) {
+	for _, account := range accounts {
+		phone := account.PhoneCountryCode + " " + account.PhoneNum
+		if s.provisioned[phone] {
+			continue
+		}
+		token, err := s.login.Login(account.PhoneNum, account.PhoneCountryCode)
+		if err != nil {
+			zap.L().Warn("Provision bot", logging.Bot(account.Name), logging.Shard(s.config.Name), zap.String("phone", phone), zap.Error(err))
+		} else {
+			s.provisioned[phone] = true
+			zap.L().Info("Provisioned bot", logging.Bot(account.Name), logging.Shard(s.config.Name), logging.PlayerId(int32(token.PlayerId)))
+		}
+	}
+}
+
+//指定了name时按名字查找, 否则按roomId所在的范围推断, 只有一个分片时总是用它
+func findShard(shards []*shard, name string, roomId int) (*shard, error) {
+	if name != "" {
+		for _, s := range shards {
+			if s.config.Name == name {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown shard %s", name)
+	}
+	if len(shards) == 1 {
+		return shards[0], nil
+	}
+	for _, s := range shards {
+		if s.config.ContainsRoom(roomId) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no shard serves room %d, please specify one", roomId)
+}
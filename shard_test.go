@@ -0,0 +1,54 @@
+package main
+
+import (
+	"AI/login"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//日志轮转等原因发出的SIGHUP不应重新登录所有账号: 内容没变的bot池不重新生效, 已创建过的账号不再登录
+func TestLoadBotPoolsProvisionsOnlyChanges(t *testing.T) {
+	gameServer, gameHttpServer := startFakeServer(newFakeStage())
+	defer gameHttpServer.Close()
+	defer gameServer.Close()
+
+	dir, err := ioutil.TempDir("", "pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := newTestBotServer(t, gameHttpServer.URL)
+	s := server.shards[0]
+	s.config.BotPoolPath = filepath.Join(dir, "bot_pool.yaml")
+	writePool := func(content string) {
+		if err := ioutil.WriteFile(s.config.BotPoolPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writePool("provision: true\nbots:\n  - name: bot1\n  - name: bot2\n")
+	if err := loadBotPools(server.shards); err != nil {
+		t.Fatal(err)
+	}
+	if gameServer.SmsLoginCount() != 2 || len(s.botManager.Accounts()) != 2 {
+		t.Fatalf("expected both bots to be provisioned, got %d sms logins", gameServer.SmsLoginCount())
+	}
+	//token过期后也不会因为重新加载而再次登录
+	s.login.Invalidate("bot1", login.DEFAULT_PHONE_COUNTRY_CODE)
+	if err := loadBotPools(server.shards); err != nil {
+		t.Fatal(err)
+	}
+	if gameServer.SmsLoginCount() != 2 {
+		t.Errorf("expected an unchanged pool not to log in again, got %d sms logins", gameServer.SmsLoginCount())
+	}
+
+	writePool("provision: true\nbots:\n  - name: bot1\n  - name: bot2\n  - name: bot3\n")
+	if err := loadBotPools(server.shards); err != nil {
+		t.Fatal(err)
+	}
+	if gameServer.SmsLoginCount() != 3 || len(s.botManager.Accounts()) != 3 {
+		t.Errorf("expected only bot3 to be provisioned, got %d sms logins and accounts %v", gameServer.SmsLoginCount(), s.botManager.Accounts())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var errShuttingDown = errors.New("The bot server is shutting down")
+
+//占用n个spawn名额, 开始退出后返回errShuttingDown. 每个名额由spawnBot结束时归还
+func (server *botServer) beginSpawn(n int) error {
+	server.spawnMutex.Lock()
+	defer server.spawnMutex.Unlock()
+	if server.draining {
+		return errShuttingDown
+	}
+	server.spawns.Add(n)
+	return nil
+}
+
+func (server *botServer) isDraining() bool {
+	server.spawnMutex.Lock()
+	defer server.spawnMutex.Unlock()
+	return server.draining
+}
+
+//不再接受新的spawn, 通知所有bot正常断开并最多等待deadline, 返回到期时仍未退出而被强制关闭连接的bot
+func (server *botServer) shutdown(deadline time.Duration) []string {
+	server.spawnMutex.Lock()
+	server.draining = true
+	server.spawnMutex.Unlock()
+	server.cancel()
+
+	drained := make(chan struct{})
+	go func() {
+		server.spawns.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-time.After(deadline):
+	}
+
+	//包括还在登录或连接中的bot
+	var terminated []string
+	for _, s := range server.shards {
+		for _, lease := range s.botManager.Leases() {
+			terminated = append(terminated, lease.BotName)
+		}
+	}
+	for _, running := range server.registry.all() {
+		running.client.forceClose()
+	}
+	sort.Strings(terminated)
+	return terminated
+}
@@ -0,0 +1,518 @@
+//离线对局模拟器: 在进程内按服务器帧率推进关卡, 让多个Strategy互相对抗并统计得分, 不需要后端和网络
+package sim
+
+import (
+	"AI/astar"
+	"AI/fakeserver"
+	"AI/models"
+	pb "AI/pb_output"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/Tarliton/collision2d"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	DEFAULT_FRAME_RATE                = fakeserver.DEFAULT_FRAME_RATE
+	DEFAULT_PLAYER_SPEED              = fakeserver.DEFAULT_PLAYER_SPEED
+	DEFAULT_DURATION                  = 60 * time.Second
+	DEFAULT_TRAP_RADIUS               = 24
+	DEFAULT_STUN_DURATION             = 2 * time.Second
+	DEFAULT_GUARD_TOWER_RANGE         = 400
+	DEFAULT_GUARD_TOWER_FIRE_INTERVAL = 3 * time.Second
+	DEFAULT_BULLET_SPEED              = 400
+	DEFAULT_BULLET_HIT_RADIUS         = 24
+	DEFAULT_RANDOM_TREASURE_SCORE     = fakeserver.DEFAULT_TREASURE_SCORE
+
+	//浮点误差, 略超过单帧最大步长的移动不截断
+	stepTolerance = 1.001
+)
+
+var ErrNoBots = errors.New("At least one bot is required")
+
+//时间都是模拟时间, 与实际耗时无关
+type Config struct {
+	FrameRate    int
+	Duration     time.Duration
+	PlayerSpeed  int32
+	PickupRadius float64 //<=0时与fakeserver一致
+
+	TrapRadius             float64
+	StunDuration           time.Duration //踩到陷阱或被子弹击中后不能移动的时间
+	GuardTowerRange        float64
+	GuardTowerFireInterval time.Duration
+	BulletSpeed            float64
+	BulletHitRadius        float64
+
+	//在关卡自带的之外, 随机放在空地上的宝物和陷阱
+	RandomTreasures int
+	RandomTraps     int
+	Seed            int64
+
+	RoomId int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		FrameRate:              DEFAULT_FRAME_RATE,
+		Duration:               DEFAULT_DURATION,
+		PlayerSpeed:            DEFAULT_PLAYER_SPEED,
+		TrapRadius:             DEFAULT_TRAP_RADIUS,
+		StunDuration:           DEFAULT_STUN_DURATION,
+		GuardTowerRange:        DEFAULT_GUARD_TOWER_RANGE,
+		GuardTowerFireInterval: DEFAULT_GUARD_TOWER_FIRE_INTERVAL,
+		BulletSpeed:            DEFAULT_BULLET_SPEED,
+		BulletHitRadius:        DEFAULT_BULLET_HIT_RADIUS,
+		RoomId:                 1,
+	}
+}
+
+//对局的静态信息, Strategy不应修改
+type MatchInfo struct {
+	RoomId     int
+	Stage      *fakeserver.Stage
+	Tmx        *models.TmxMap //已初始化ContinuousPosMap
+	CollideMap astar.Map
+	FrameRate  int
+}
+
+//bot每帧看到的世界
+type View struct {
+	//与后端下行帧格式一致: 第一帧是全量帧, 之后Treasures只包含上一帧之后被吃掉的宝物; 玩家, 陷阱, 子弹和守卫塔每帧都是全量的
+	Frame     *pb.RoomDownsyncFrame
+	Self      *pb.Player
+	Treasures map[int32]*pb.Treasure //尚未被吃掉的全部宝物
+	Stunned   bool
+	Dt        float64 //距上一帧的秒数
+	MaxStep   float64 //这一帧最多能移动的距离
+}
+
+//一个bot的决策逻辑, 每场对局使用新的实例, View中的内容只读
+type Strategy interface {
+	//对局开始前调用一次
+	Init(match *MatchInfo, playerId int32)
+	//每帧调用一次, 返回希望移动到的坐标, 超出MaxStep的部分会被截断
+	Step(view *View) models.Vec2D
+}
+
+type Bot struct {
+	Name     string
+	Strategy Strategy
+}
+
+type BotResult struct {
+	Name      string  `json:"name"`
+	PlayerId  int32   `json:"playerId"`
+	Score     int32   `json:"score"`
+	Treasures int     `json:"treasures"`
+	Stuns     int     `json:"stuns"`
+	Blocked   int     `json:"blocked"` //目标在障碍物内而没有移动的帧数
+	Distance  float64 `json:"distance"`
+}
+
+type Result struct {
+	StageName          string        `json:"stageName"`
+	Seed               int64         `json:"seed"`
+	Frames             int32         `json:"frames"`
+	Duration           time.Duration `json:"duration"`
+	RemainingTreasures int           `json:"remainingTreasures"`
+	Bots               []BotResult   `json:"bots"` //与传入的bots顺序一致
+}
+
+type player struct {
+	bot          Bot
+	player       *pb.Player
+	result       *BotResult
+	stunnedUntil int32 //在该帧之前(含)不能移动
+}
+
+type world struct {
+	cfg           Config
+	match         *MatchInfo
+	barriers      []collision2d.Polygon
+	dt            float64
+	stunFrames    int32
+	fireFrames    int32
+	frameId       int32
+	players       []*player
+	treasures     map[int32]*pb.Treasure
+	removed       []*pb.Treasure //上一帧之后被吃掉的宝物
+	traps         map[int32]*pb.Trap
+	guardTowers   []*pb.GuardTower //按id排序
+	bullets       map[int32]*pb.Bullet
+	lastBulletId  int32
+	sentFullFrame bool
+}
+
+func framesOf(d time.Duration, frameRate int) int32 {
+	return int32(math.Ceil(d.Seconds() * float64(frameRate)))
+}
+
+//按Config推进一场对局, 所有宝物被吃完或到达Duration时结束
+func Run(stage *fakeserver.Stage, cfg Config, bots []Bot) (*Result, error) {
+	if len(bots) == 0 {
+		return nil, ErrNoBots
+	}
+	if cfg.FrameRate <= 0 || cfg.Duration <= 0 || cfg.PlayerSpeed <= 0 {
+		return nil, errors.New("FrameRate, Duration and PlayerSpeed must be positive")
+	}
+	if cfg.PickupRadius <= 0 {
+		cfg.PickupRadius = stage.PickupRadius()
+	}
+
+	tmx := stage.Tmx
+	tmx.InitContinuousPosMap()
+	match := &MatchInfo{
+		RoomId:     cfg.RoomId,
+		Stage:      stage,
+		Tmx:        &tmx,
+		CollideMap: models.InitCollideMapNeo(&tmx, stage.ColliderInfo.StrToPolygon2DListMap),
+		FrameRate:  cfg.FrameRate,
+	}
+	w := &world{
+		cfg:        cfg,
+		match:      match,
+		dt:         1 / float64(cfg.FrameRate),
+		stunFrames: framesOf(cfg.StunDuration, cfg.FrameRate),
+		fireFrames: framesOf(cfg.GuardTowerFireInterval, cfg.FrameRate),
+		treasures:  make(map[int32]*pb.Treasure),
+		traps:      make(map[int32]*pb.Trap),
+		bullets:    make(map[int32]*pb.Bullet),
+	}
+	for _, polygon := range stage.ColliderInfo.StrToPolygon2DListMap[fakeserver.COLLIDER_INFO_BARRIER_POLYGON_KEY].GetPolygon2DList() {
+		points := make([]float64, 0, len(polygon.Points)*2)
+		for _, pt := range polygon.Points {
+			points = append(points, pt.X+polygon.Anchor.X, pt.Y+polygon.Anchor.Y)
+		}
+		w.barriers = append(w.barriers, collision2d.NewPolygon(collision2d.NewVector(0, 0), collision2d.NewVector(0, 0), 0, points))
+	}
+	w.spawn(rand.New(rand.NewSource(cfg.Seed)))
+
+	result := &Result{
+		StageName: stage.Name,
+		Seed:      cfg.Seed,
+		Bots:      make([]BotResult, len(bots)),
+	}
+	for i, bot := range bots {
+		playerId := int32(i + 1)
+		pos := stage.StartingPosition(i + 1)
+		result.Bots[i] = BotResult{Name: bot.Name, PlayerId: playerId}
+		w.players = append(w.players, &player{
+			bot: bot,
+			player: &pb.Player{
+				Id:          playerId,
+				X:           pos.X,
+				Y:           pos.Y,
+				Dir:         &pb.Direction{Dx: 0, Dy: 1},
+				Speed:       cfg.PlayerSpeed,
+				BattleState: 1,
+				JoinIndex:   playerId,
+			},
+			result: &result.Bots[i],
+		})
+		bot.Strategy.Init(match, playerId)
+	}
+
+	totalFrames := framesOf(cfg.Duration, cfg.FrameRate)
+	for w.frameId < totalFrames && len(w.treasures) > 0 {
+		w.step(totalFrames)
+	}
+	result.Frames = w.frameId
+	result.Duration = time.Duration(w.frameId) * time.Second / time.Duration(cfg.FrameRate)
+	result.RemainingTreasures = len(w.treasures)
+	return result, nil
+}
+
+//放置关卡自带的和随机生成的宝物, 陷阱, 守卫塔
+func (w *world) spawn(r *rand.Rand) {
+	stage := w.match.Stage
+	var lastTreasureId, lastTrapId int32
+	for _, treasure := range stage.Treasures {
+		w.treasures[treasure.Id] = proto.Clone(treasure).(*pb.Treasure)
+		if treasure.Id > lastTreasureId {
+			lastTreasureId = treasure.Id
+		}
+	}
+	for _, trap := range stage.Traps {
+		w.traps[trap.Id] = proto.Clone(trap).(*pb.Trap)
+		if trap.Id > lastTrapId {
+			lastTrapId = trap.Id
+		}
+	}
+	for _, guardTower := range stage.GuardTowers {
+		w.guardTowers = append(w.guardTowers, proto.Clone(guardTower).(*pb.GuardTower))
+	}
+	sort.Slice(w.guardTowers, func(i, j int) bool { return w.guardTowers[i].Id < w.guardTowers[j].Id })
+
+	var roads []models.Vec2D
+	for i, row := range w.match.CollideMap {
+		for j, value := range row {
+			if value != astar.BARRIER {
+				roads = append(roads, w.match.Tmx.ContinuousPosMap[i][j])
+			}
+		}
+	}
+	if len(roads) == 0 {
+		return
+	}
+	for i := 0; i < w.cfg.RandomTreasures; i++ {
+		pos := roads[r.Intn(len(roads))]
+		lastTreasureId++
+		w.treasures[lastTreasureId] = &pb.Treasure{
+			Id:              lastTreasureId,
+			LocalIdInBattle: lastTreasureId,
+			Score:           DEFAULT_RANDOM_TREASURE_SCORE,
+			Type:            fakeserver.DEFAULT_TREASURE_TYPE,
+			X:               pos.X,
+			Y:               pos.Y,
+		}
+	}
+	for i := 0; i < w.cfg.RandomTraps; i++ {
+		pos := roads[r.Intn(len(roads))]
+		lastTrapId++
+		w.traps[lastTrapId] = &pb.Trap{
+			Id:              lastTrapId,
+			LocalIdInBattle: lastTrapId,
+			Type:            fakeserver.DEFAULT_TRAP_TYPE,
+			X:               pos.X,
+			Y:               pos.Y,
+		}
+	}
+}
+
+//所有bot看到同一帧后再依次移动, 移动的先后顺序每帧轮换, 避免同时到达宝物时总是同一个bot吃到
+func (w *world) step(totalFrames int32) {
+	w.frameId++
+	frame := w.frame(totalFrames)
+	treasures := make(map[int32]*pb.Treasure, len(w.treasures))
+	for id, treasure := range w.treasures {
+		treasures[id] = treasure
+	}
+	targets := make([]models.Vec2D, len(w.players))
+	for i, p := range w.players {
+		targets[i] = p.bot.Strategy.Step(&View{
+			Frame:     frame,
+			Self:      frame.Players[p.player.Id],
+			Treasures: treasures,
+			Stunned:   w.isStunned(p),
+			Dt:        w.dt,
+			MaxStep:   float64(p.player.Speed) * w.dt,
+		})
+	}
+
+	n := len(w.players)
+	for k := 0; k < n; k++ {
+		i := (k + int(w.frameId)) % n
+		p := w.players[i]
+		w.move(p, targets[i])
+		w.pickUp(p)
+		w.triggerTraps(p)
+	}
+	w.fireGuardTowers()
+	w.moveBullets()
+}
+
+func (w *world) frame(totalFrames int32) *pb.RoomDownsyncFrame {
+	frame := &pb.RoomDownsyncFrame{
+		Id:             w.frameId,
+		RefFrameId:     w.frameId - 1,
+		SentAt:         int64(w.frameId) * 1000 / int64(w.cfg.FrameRate),
+		CountdownNanos: int64(totalFrames-w.frameId) * int64(time.Second) / int64(w.cfg.FrameRate),
+		Players:        make(map[int32]*pb.Player, len(w.players)),
+		Treasures:      make(map[int32]*pb.Treasure),
+		Traps:          make(map[int32]*pb.Trap, len(w.traps)),
+		Bullets:        make(map[int32]*pb.Bullet, len(w.bullets)),
+		GuardTowers:    make(map[int32]*pb.GuardTower, len(w.guardTowers)),
+	}
+	for _, p := range w.players {
+		frame.Players[p.player.Id] = proto.Clone(p.player).(*pb.Player)
+	}
+	if !w.sentFullFrame {
+		w.sentFullFrame = true
+		frame.RefFrameId = 0
+		for id, treasure := range w.treasures {
+			frame.Treasures[id] = treasure
+		}
+	} else {
+		for _, treasure := range w.removed {
+			frame.Treasures[treasure.Id] = treasure
+		}
+	}
+	w.removed = nil
+	for id, trap := range w.traps {
+		frame.Traps[id] = trap
+	}
+	for id, bullet := range w.bullets {
+		frame.Bullets[id] = proto.Clone(bullet).(*pb.Bullet)
+	}
+	for _, guardTower := range w.guardTowers {
+		frame.GuardTowers[guardTower.Id] = guardTower
+	}
+	return frame
+}
+
+//按id顺序遍历, 使同一Seed的对局结果可以复现
+func sortIds(ids []int32) []int32 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (w *world) trapIds() []int32 {
+	ids := make([]int32, 0, len(w.traps))
+	for id := range w.traps {
+		ids = append(ids, id)
+	}
+	return sortIds(ids)
+}
+
+func (w *world) bulletIds() []int32 {
+	ids := make([]int32, 0, len(w.bullets))
+	for id := range w.bullets {
+		ids = append(ids, id)
+	}
+	return sortIds(ids)
+}
+
+func (w *world) isStunned(p *player) bool {
+	return w.frameId <= p.stunnedUntil
+}
+
+func (w *world) stun(p *player) {
+	p.stunnedUntil = w.frameId + w.stunFrames
+	p.result.Stuns++
+}
+
+//只判断玩家中心是否进入障碍物, CollideMap按玩家半径计算, 相邻两个可走格子之间的连线仍可能擦到障碍物
+func (w *world) isBlocked(pos models.Vec2D) bool {
+	point := collision2d.NewVector(pos.X, pos.Y)
+	for _, barrier := range w.barriers {
+		if collision2d.PointInPolygon(point, barrier) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *world) move(p *player, target models.Vec2D) {
+	if w.isStunned(p) {
+		return
+	}
+	from := models.Vec2D{X: p.player.X, Y: p.player.Y}
+	dist := models.Distance(&from, &target)
+	if dist == 0 {
+		return
+	}
+	maxStep := float64(p.player.Speed) * w.dt
+	if dist > maxStep*stepTolerance {
+		target.X = from.X + (target.X-from.X)*maxStep/dist
+		target.Y = from.Y + (target.Y-from.Y)*maxStep/dist
+		dist = maxStep
+	}
+	if w.isBlocked(target) {
+		p.result.Blocked++
+		return
+	}
+	p.player.X = target.X
+	p.player.Y = target.Y
+	p.player.Dir = &pb.Direction{Dx: (target.X - from.X) / dist, Dy: (target.Y - from.Y) / dist}
+	p.result.Distance += dist
+}
+
+func (w *world) pickUp(p *player) {
+	pos := models.Vec2D{X: p.player.X, Y: p.player.Y}
+	for id, treasure := range w.treasures {
+		treasurePos := models.Vec2D{X: treasure.X, Y: treasure.Y}
+		if models.Distance(&pos, &treasurePos) <= w.cfg.PickupRadius {
+			delete(w.treasures, id)
+			removed := proto.Clone(treasure).(*pb.Treasure)
+			removed.Removed = true
+			w.removed = append(w.removed, removed)
+			p.player.Score += treasure.Score
+			p.result.Score += treasure.Score
+			p.result.Treasures++
+		}
+	}
+}
+
+//陷阱被踩到一次后消失
+func (w *world) triggerTraps(p *player) {
+	if w.isStunned(p) {
+		return
+	}
+	pos := models.Vec2D{X: p.player.X, Y: p.player.Y}
+	for _, id := range w.trapIds() {
+		trap := w.traps[id]
+		trapPos := models.Vec2D{X: trap.X, Y: trap.Y}
+		if models.Distance(&pos, &trapPos) <= w.cfg.TrapRadius {
+			delete(w.traps, id)
+			w.stun(p)
+			return
+		}
+	}
+}
+
+//每隔GuardTowerFireInterval, 每个守卫塔向射程内最近的未被击晕的玩家开火, 子弹飞向开火时玩家所在的位置
+func (w *world) fireGuardTowers() {
+	if w.fireFrames <= 0 || w.frameId%w.fireFrames != 0 {
+		return
+	}
+	for _, guardTower := range w.guardTowers {
+		towerPos := models.Vec2D{X: guardTower.X, Y: guardTower.Y}
+		var target *player
+		minDistance := w.cfg.GuardTowerRange
+		for _, p := range w.players {
+			pos := models.Vec2D{X: p.player.X, Y: p.player.Y}
+			if dist := models.Distance(&towerPos, &pos); dist <= minDistance && !w.isStunned(p) {
+				minDistance = dist
+				target = p
+			}
+		}
+		if target == nil {
+			continue
+		}
+		w.lastBulletId++
+		w.bullets[w.lastBulletId] = &pb.Bullet{
+			LocalIdInBattle: w.lastBulletId,
+			LinearSpeed:     w.cfg.BulletSpeed,
+			X:               towerPos.X,
+			Y:               towerPos.Y,
+			StartAtPoint:    &pb.Vec2D{X: towerPos.X, Y: towerPos.Y},
+			EndAtPoint:      &pb.Vec2D{X: target.player.X, Y: target.player.Y},
+		}
+	}
+}
+
+//子弹击中第一个碰到的玩家或到达终点后消失
+func (w *world) moveBullets() {
+	for _, id := range w.bulletIds() {
+		bullet := w.bullets[id]
+		pos := models.Vec2D{X: bullet.X, Y: bullet.Y}
+		end := models.Vec2D{X: bullet.EndAtPoint.X, Y: bullet.EndAtPoint.Y}
+		dist := models.Distance(&pos, &end)
+		step := bullet.LinearSpeed * w.dt
+		if dist <= step {
+			pos = end
+		} else {
+			pos.X += (end.X - pos.X) * step / dist
+			pos.Y += (end.Y - pos.Y) * step / dist
+		}
+		bullet.X = pos.X
+		bullet.Y = pos.Y
+		hit := false
+		for _, p := range w.players {
+			playerPos := models.Vec2D{X: p.player.X, Y: p.player.Y}
+			if !w.isStunned(p) && models.Distance(&pos, &playerPos) <= w.cfg.BulletHitRadius {
+				w.stun(p)
+				hit = true
+				break
+			}
+		}
+		if hit || dist <= step {
+			delete(w.bullets, id)
+		}
+	}
+}
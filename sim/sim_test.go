@@ -0,0 +1,200 @@
+package sim
+
+import (
+	"AI/fakeserver"
+	"AI/models"
+	pb "AI/pb_output"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//8x8的空地图, 障碍物远离所有格子
+func newOpenStage(barriers ...*pb.Polygon2D) *fakeserver.Stage {
+	if len(barriers) == 0 {
+		barriers = []*pb.Polygon2D{{
+			Anchor: &pb.Vec2D{X: 100000, Y: 100000},
+			Points: []*pb.Vec2D{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}, {X: 0, Y: 10}},
+		}}
+	}
+	colliderInfo := &pb.BattleColliderInfo{
+		StageName:      "open",
+		StageDiscreteW: 8,
+		StageDiscreteH: 8,
+		StageTileW:     64,
+		StageTileH:     32,
+		StrToPolygon2DListMap: map[string]*pb.Polygon2DList{
+			fakeserver.COLLIDER_INFO_BARRIER_POLYGON_KEY: {Polygon2DList: barriers},
+		},
+	}
+	return fakeserver.NewStage(colliderInfo, nil, nil)
+}
+
+func treasureAtGid(stage *fakeserver.Stage, id int32, gid int) *pb.Treasure {
+	x, y := stage.Tmx.GetCoordByGid(gid)
+	return &pb.Treasure{Id: id, LocalIdInBattle: id, Score: 100, X: x, Y: y}
+}
+
+//记录收到的每一帧
+type recorder struct {
+	Strategy
+	frames []*pb.RoomDownsyncFrame
+}
+
+func (r *recorder) Step(view *View) models.Vec2D {
+	r.frames = append(r.frames, view.Frame)
+	return r.Strategy.Step(view)
+}
+
+func TestRunCollectsTreasures(t *testing.T) {
+	stage := newOpenStage()
+	stage.Treasures = []*pb.Treasure{treasureAtGid(stage, 1, 9), treasureAtGid(stage, 2, 63)}
+	straight := &recorder{Strategy: new(Straight)}
+	result, err := Run(stage, DefaultConfig(), []Bot{{"straight", straight}, {"idle", new(Idle)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RemainingTreasures != 0 || result.Duration >= DEFAULT_DURATION {
+		t.Errorf("expected the match to end once all treasures are picked up, got %+v", result)
+	}
+	if bot := result.Bots[0]; bot.Score != 200 || bot.Treasures != 2 || bot.Distance == 0 {
+		t.Errorf("unexpected straight result %+v", bot)
+	}
+	if bot := result.Bots[1]; bot.Score != 0 || bot.Distance != 0 {
+		t.Errorf("unexpected idle result %+v", bot)
+	}
+
+	//第一帧是全量帧, 之后只带被吃掉的宝物
+	frames := straight.frames
+	if first := frames[0]; first.Id != 1 || first.RefFrameId != 0 || len(first.Treasures) != 2 || len(first.Players) != 2 {
+		t.Errorf("unexpected first frame %v", first)
+	}
+	removed := 0
+	for _, frame := range frames[1:] {
+		if frame.RefFrameId != frame.Id-1 {
+			t.Fatalf("frame %d refers to %d", frame.Id, frame.RefFrameId)
+		}
+		for _, treasure := range frame.Treasures {
+			if !treasure.Removed {
+				t.Errorf("frame %d carries treasure %d which is not removed", frame.Id, treasure.Id)
+			}
+			removed++
+		}
+	}
+	if removed != 1 {
+		t.Errorf("expected the first removal to be sent in a later frame, got %d", removed)
+	}
+}
+
+//每一步不超过MaxStep
+func TestRunLimitsSpeed(t *testing.T) {
+	stage := newOpenStage()
+	stage.Treasures = []*pb.Treasure{treasureAtGid(stage, 1, 63)}
+	straight := &recorder{Strategy: new(Straight)}
+	cfg := DefaultConfig()
+	cfg.Duration = time.Second
+	result, err := Run(stage, cfg, []Bot{{"straight", straight}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxDistance := float64(cfg.PlayerSpeed) * cfg.Duration.Seconds()
+	if result.Bots[0].Distance > maxDistance*stepTolerance || result.Bots[0].Distance < maxDistance*0.9 {
+		t.Errorf("expected to move about %.0f in %v, got %.2f", maxDistance, cfg.Duration, result.Bots[0].Distance)
+	}
+	for i := 1; i < len(straight.frames); i++ {
+		prev, cur := straight.frames[i-1].Players[1], straight.frames[i].Players[1]
+		if d := models.Distance(&models.Vec2D{X: prev.X, Y: prev.Y}, &models.Vec2D{X: cur.X, Y: cur.Y}); d > float64(cfg.PlayerSpeed)/float64(cfg.FrameRate)*stepTolerance {
+			t.Fatalf("moved %.2f between frame %d and %d", d, i, i+1)
+		}
+	}
+}
+
+func TestRunBlocksBarriers(t *testing.T) {
+	stage := newOpenStage()
+	start := stage.StartingPosition(1)
+	treasure := treasureAtGid(stage, 1, 63)
+	//出生点和宝物之间的一堵墙
+	mid := models.Vec2D{X: (start.X + treasure.X) / 2, Y: (start.Y + treasure.Y) / 2}
+	stage = newOpenStage(&pb.Polygon2D{
+		Anchor: &pb.Vec2D{X: mid.X, Y: mid.Y},
+		Points: []*pb.Vec2D{{X: -200, Y: -200}, {X: 200, Y: -200}, {X: 200, Y: 200}, {X: -200, Y: 200}},
+	})
+	stage.Treasures = []*pb.Treasure{treasure}
+	result, err := Run(stage, DefaultConfig(), []Bot{{"straight", new(Straight)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot := result.Bots[0]; bot.Score != 0 || bot.Blocked == 0 {
+		t.Errorf("expected the straight bot to be stopped by the barrier, got %+v", bot)
+	}
+}
+
+func TestTrapsAndGuardTowersStunPlayers(t *testing.T) {
+	stage := newOpenStage()
+	stage.Treasures = []*pb.Treasure{treasureAtGid(stage, 1, 63)}
+	trapX, trapY := stage.Tmx.GetCoordByGid(27)
+	stage.Traps = []*pb.Trap{{Id: 1, LocalIdInBattle: 1, X: trapX, Y: trapY}}
+	cfg := DefaultConfig()
+	cfg.TrapRadius = 1000
+	cfg.GuardTowerRange = 0
+	result, err := Run(stage, cfg, []Bot{{"straight", new(Straight)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot := result.Bots[0]; bot.Stuns != 1 {
+		t.Errorf("expected to be stunned by the trap once, got %+v", bot)
+	}
+
+	stage.Traps = nil
+	start := stage.StartingPosition(1)
+	stage.GuardTowers = []*pb.GuardTower{{Id: 1, LocalIdInBattle: 1, X: start.X + 100, Y: start.Y}}
+	cfg = DefaultConfig()
+	cfg.Duration = 5 * time.Second
+	cfg.GuardTowerFireInterval = time.Second
+	idle := &recorder{Strategy: new(Idle)}
+	result, err = Run(stage, cfg, []Bot{{"idle", idle}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot := result.Bots[0]; bot.Stuns < 2 {
+		t.Errorf("expected to be hit by bullets, got %+v", bot)
+	}
+	sawBullet := false
+	for _, frame := range idle.frames {
+		if len(frame.Bullets) > 0 && len(frame.GuardTowers) == 1 {
+			sawBullet = true
+		}
+	}
+	if !sawBullet {
+		t.Errorf("expected bullets in the downsync frames")
+	}
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	stage, err := fakeserver.LoadStage("../map/map/pacman/map.tmx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Duration = 20 * time.Second
+	cfg.RandomTreasures = 20
+	cfg.RandomTraps = 10
+	cfg.Seed = 42
+	run := func() *Result {
+		result, err := Run(stage, cfg, []Bot{{"a", new(Straight)}, {"b", new(Straight)}, {"c", new(Idle)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	first, second := run(), run()
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave different results:\n%+v\n%+v", first, second)
+	}
+}
+
+func TestRunRejectsNoBots(t *testing.T) {
+	if _, err := Run(newOpenStage(), DefaultConfig(), nil); err != ErrNoBots {
+		t.Errorf("expected ErrNoBots, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package sim
+
+import (
+	"AI/models"
+)
+
+//内置的对照组strategy, 线上bot的AI在main包中包装
+const (
+	STRATEGY_IDLE     = "idle"
+	STRATEGY_STRAIGHT = "straight"
+)
+
+//name不是内置strategy时返回false
+func NewBuiltinStrategy(name string) (Strategy, bool) {
+	switch name {
+	case STRATEGY_IDLE:
+		return new(Idle), true
+	case STRATEGY_STRAIGHT:
+		return new(Straight), true
+	}
+	return nil, false
+}
+
+//站在出生点不动
+type Idle struct{}
+
+func (s *Idle) Init(match *MatchInfo, playerId int32) {}
+
+func (s *Idle) Step(view *View) models.Vec2D {
+	return models.Vec2D{X: view.Self.X, Y: view.Self.Y}
+}
+
+//不寻路, 直线走向最近的宝物, 会被障碍物挡住
+type Straight struct{}
+
+func (s *Straight) Init(match *MatchInfo, playerId int32) {}
+
+func (s *Straight) Step(view *View) models.Vec2D {
+	pos := models.Vec2D{X: view.Self.X, Y: view.Self.Y}
+	target := pos
+	minDistance := -1.0
+	for _, treasure := range view.Treasures {
+		treasurePos := models.Vec2D{X: treasure.X, Y: treasure.Y}
+		if dist := models.Distance(&pos, &treasurePos); minDistance < 0 || dist < minDistance || (dist == minDistance && treasurePos.X < target.X) {
+			minDistance = dist
+			target = treasurePos
+		}
+	}
+	return target
+}
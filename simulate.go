@@ -0,0 +1,147 @@
+package main
+
+import (
+	"AI/config"
+	"AI/fakeserver"
+	"AI/models"
+	"AI/sim"
+	"AI/tournament"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+//线上bot实际使用的AI
+const STRATEGY_CLIENT = "client"
+
+//把Client的controller/checkReFindPath包装成sim.Strategy, 离线评估的就是线上运行的同一套代码
+type clientStrategy struct {
+	ai     config.AiConfig
+	client *Client
+}
+
+func (s *clientStrategy) Init(match *sim.MatchInfo, playerId int32) {
+	s.client = newClient(nil, playerId, spawnBotOptions{
+		UpsyncRate: match.FrameRate,
+		Ai:         s.ai,
+	})
+	s.client.Id = match.RoomId
+	s.client.initBattleCollider(match.Stage.ColliderInfo)
+}
+
+//与upsyncLoop中每个tick的处理顺序一致
+func (s *clientStrategy) Step(view *sim.View) models.Vec2D {
+	client := s.client
+	client.applyRoomDownsyncFrame(view.Frame)
+	client.think(view.Dt)
+	client.rememberSentPosition()
+	return models.Vec2D{
+		X: client.Player.X,
+		Y: client.Player.Y,
+	}
+}
+
+//client和配置文件strategies中的变体都是线上AI, 只是参数不同
+func newStrategy(name string, cfg *config.Config) (sim.Strategy, error) {
+	if name == STRATEGY_CLIENT {
+		return &clientStrategy{ai: cfg.Ai}, nil
+	}
+	if ai, ok := cfg.Strategies[name]; ok {
+		return &clientStrategy{ai: ai}, nil
+	}
+	if strategy, ok := sim.NewBuiltinStrategy(name); ok {
+		return strategy, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q", name)
+}
+
+//strategies形如"client,client,straight", 每个bot以"序号-strategy"命名
+func newSimBots(strategies string, cfg *config.Config) ([]sim.Bot, error) {
+	var bots []sim.Bot
+	for i, name := range splitStrategies(strategies) {
+		strategy, err := newStrategy(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		bots = append(bots, sim.Bot{
+			Name:     fmt.Sprintf("%d-%s", i+1, name),
+			Strategy: strategy,
+		})
+	}
+	return bots, nil
+}
+
+func splitStrategies(strategies string) []string {
+	var names []string
+	for _, name := range strings.Split(strategies, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+func runSimulation(tmxPath string, strategies string, simConfig sim.Config, cfg *config.Config, out io.Writer) error {
+	stage, err := fakeserver.LoadStage(tmxPath)
+	if err != nil {
+		return err
+	}
+	bots, err := newSimBots(strategies, cfg)
+	if err != nil {
+		return err
+	}
+	result, err := sim.Run(stage, simConfig, bots)
+	if err != nil {
+		return err
+	}
+	printSimResult(out, result)
+	return nil
+}
+
+func printSimResult(out io.Writer, result *sim.Result) {
+	fmt.Fprintf(out, "stage %s, seed %d, %d frames (%v), %d treasures left\n", result.StageName, result.Seed, result.Frames, result.Duration, result.RemainingTreasures)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "bot\tscore\ttreasures\tstuns\tblocked\tdistance")
+	for _, bot := range result.Bots {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.0f\n", bot.Name, bot.Score, bot.Treasures, bot.Stuns, bot.Blocked, bot.Distance)
+	}
+	w.Flush()
+}
+
+//进行循环赛并把结果累积到resultsPath, 每场对局后都保存一次, 中途退出也不会丢失已完成的对局
+func runTournament(tmxPath string, tournamentConfig tournament.Config, resultsPath string, cfg *config.Config, out io.Writer) error {
+	stage, err := fakeserver.LoadStage(tmxPath)
+	if err != nil {
+		return err
+	}
+	results, err := tournament.LoadResults(resultsPath)
+	if err != nil {
+		return err
+	}
+	var saveErr error
+	tournamentConfig.OnMatch = func(match tournament.MatchRecord) {
+		fmt.Fprintf(out, "round %d seed %d: %s %d vs %s %d, winner %q\n", match.Round, match.Seed, match.Strategies[0], match.Scores[0], match.Strategies[1], match.Scores[1], match.Winner)
+		if err := results.Save(resultsPath); err != nil && saveErr == nil {
+			saveErr = err
+		}
+	}
+	err = tournament.Run(stage, tournamentConfig, func(name string) (sim.Strategy, error) {
+		return newStrategy(name, cfg)
+	}, results)
+	if err != nil {
+		return err
+	}
+	if saveErr != nil {
+		return saveErr
+	}
+	printLeaderboard(out, results)
+	return nil
+}
+
+func printLeaderboard(out io.Writer, results *tournament.Results) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "strategy\trating\tmatches\twins\tlosses\tdraws")
+	for _, standing := range results.Leaderboard() {
+		fmt.Fprintf(w, "%s\t%.1f\t%d\t%d\t%d\t%d\n", standing.Name, standing.Rating.Rating, standing.Matches, standing.Wins, standing.Losses, standing.Draws)
+	}
+	w.Flush()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"AI/config"
+	"AI/sim"
+	"AI/tournament"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//线上AI在模拟器里应能吃到宝物, 且不会被判定为穿墙
+func TestClientStrategyInSimulator(t *testing.T) {
+	simConfig := sim.DefaultConfig()
+	simConfig.Duration = 20 * time.Second
+	var out bytes.Buffer
+	if err := runSimulation("map/map/pacman/map.tmx", "client, idle", simConfig, config.Default(), &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "stage pacman") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+	client, idle := strings.Fields(lines[2]), strings.Fields(lines[3])
+	if client[0] != "1-client" || client[1] == "0" || client[4] != "0" {
+		t.Errorf("expected the client to score without hitting barriers, got %v", client)
+	}
+	if idle[0] != "2-idle" || idle[1] != "0" {
+		t.Errorf("expected idle to score nothing, got %v", idle)
+	}
+}
+
+func TestNewSimBotsRejectsUnknownStrategy(t *testing.T) {
+	if _, err := newSimBots("client,nope", config.Default()); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("expected an unknown strategy error, got %v", err)
+	}
+}
+
+func TestRunTournamentWithConfigStrategies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tournament")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	resultsPath := filepath.Join(dir, "results.json")
+
+	cfg := config.Default()
+	patient := cfg.Ai
+	patient.StuckFrames = 40
+	cfg.Strategies = map[string]config.AiConfig{"patient": patient}
+	if strategy, err := newStrategy("patient", cfg); err != nil || strategy.(*clientStrategy).ai.StuckFrames != 40 {
+		t.Fatalf("expected the patient variant of the client, got %v %v", strategy, err)
+	}
+
+	tournamentConfig := tournament.Config{
+		Strategies: []string{"patient", sim.STRATEGY_IDLE},
+		Rounds:     1,
+		Sim:        sim.DefaultConfig(),
+	}
+	tournamentConfig.Sim.Duration = 10 * time.Second
+	var out bytes.Buffer
+	if err := runTournament("map/map/pacman/map.tmx", tournamentConfig, resultsPath, cfg, &out); err != nil {
+		t.Fatal(err)
+	}
+	results, err := tournament.LoadResults(resultsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Matches) != 2 || results.Ratings["patient"].Wins != 2 {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if !strings.Contains(out.String(), "strategy  rating") {
+		t.Errorf("expected a leaderboard, got:\n%s", out.String())
+	}
+}
@@ -17,5 +17,6 @@ PID_FILE="$basedir/treasure-hunter-x-bot-server.pid"
 sudo su - root -c "touch $LOG_PATH" 
 sudo su - root -c "chown $OS_USER:$OS_USER $LOG_PATH" 
 
-ServerEnv=$ServerEnv $basedir/AI >$LOG_PATH 2>&1 &
-echo $! > $PID_FILE
+# The binary rotates and compresses $LOG_PATH itself (see "log" in configs/config.yaml) and writes/removes $PID_FILE.
+# Crash traces and anything else written to stdout/stderr are appended to $PID_FILE.stderr.
+AI_LOG_OUTPUT=$LOG_PATH ServerEnv=$ServerEnv $basedir/AI -daemon -pidFile $PID_FILE -config $basedir/configs/config.yaml -botPool $basedir/configs/bot_pool.yaml
@@ -10,8 +10,11 @@ if [ -f $PID_FILE ]; then
   else 
     echo "Killing process of id $pid."
     kill $pid 
-    echo "Removing PidFile $PID_FILE."
-    rm $PID_FILE
+    # The process removes its own PidFile once all bots are disconnected.
+    while kill -0 $pid 2>/dev/null; do
+      sleep 1
+    done
+    echo "Process of id $pid exited."
   fi
 else 
   echo "There's no PidFile $PID_FILE."
@@ -0,0 +1,96 @@
+package telemetry
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//每个订阅者最多缓存的事件数, 消费太慢时丢弃新事件而不是阻塞bot
+const subscriberBufferSize = 256
+
+const (
+	KIND_WORLD_VIEW = "worldView"
+	KIND_TARGET     = "target"
+	KIND_PATH       = "path"
+	KIND_UPSYNC     = "upsync"
+)
+
+//Data在发布后不能再被修改, 它会在订阅者的goroutine中被序列化
+type Event struct {
+	Kind    string      `json:"kind"`
+	BotName string      `json:"botName"`
+	RoomId  int         `json:"roomId"`
+	At      int64       `json:"at"` //毫秒
+	Data    interface{} `json:"data"`
+}
+
+type Subscriber struct {
+	C       chan Event
+	filter  func(Event) bool
+	dropped int64
+}
+
+//被丢弃的事件数
+func (s *Subscriber) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+//nil的*Hub可以安全地调用所有方法, 相当于没有订阅者
+type Hub struct {
+	mutex       sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+	count       int32
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+//filter为nil时接收所有事件
+func (h *Hub) Subscribe(filter func(Event) bool) *Subscriber {
+	s := &Subscriber{
+		C:      make(chan Event, subscriberBufferSize),
+		filter: filter,
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.subscribers[s] = struct{}{}
+	atomic.StoreInt32(&h.count, int32(len(h.subscribers)))
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subscribers, s)
+	atomic.StoreInt32(&h.count, int32(len(h.subscribers)))
+}
+
+//用于在没有订阅者时跳过构造事件
+func (h *Hub) HasSubscribers() bool {
+	return h != nil && atomic.LoadInt32(&h.count) > 0
+}
+
+func (h *Hub) Publish(e Event) {
+	if !h.HasSubscribers() {
+		return
+	}
+	if e.At == 0 {
+		e.At = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for s := range h.subscribers {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.C <- e:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
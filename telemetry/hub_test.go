@@ -0,0 +1,126 @@
+package telemetry
+
+import (
+	"sync"
+	"testing"
+)
+
+func receive(s *Subscriber) []Event {
+	var events []Event
+	for {
+		select {
+		case e := <-s.C:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestHubFiltersByBotAndRoom(t *testing.T) {
+	hub := NewHub()
+	all := hub.Subscribe(nil)
+	bot := hub.Subscribe(func(e Event) bool { return e.BotName == "bot1" })
+	room := hub.Subscribe(func(e Event) bool { return e.RoomId == 7 })
+
+	hub.Publish(Event{Kind: KIND_UPSYNC, BotName: "bot1", RoomId: 7})
+	hub.Publish(Event{Kind: KIND_PATH, BotName: "bot2", RoomId: 7})
+	hub.Publish(Event{Kind: KIND_TARGET, BotName: "bot1", RoomId: 8, At: 42})
+
+	cases := []struct {
+		name       string
+		subscriber *Subscriber
+		kinds      []string
+	}{
+		{"all", all, []string{KIND_UPSYNC, KIND_PATH, KIND_TARGET}},
+		{"bot", bot, []string{KIND_UPSYNC, KIND_TARGET}},
+		{"room", room, []string{KIND_UPSYNC, KIND_PATH}},
+	}
+	for _, c := range cases {
+		events := receive(c.subscriber)
+		if len(events) != len(c.kinds) {
+			t.Errorf("%s: expected %v, got %+v", c.name, c.kinds, events)
+			continue
+		}
+		for i, e := range events {
+			if e.Kind != c.kinds[i] || e.At == 0 {
+				t.Errorf("%s: expected %s with a timestamp, got %+v", c.name, c.kinds[i], e)
+			}
+		}
+	}
+	if events := receive(all); len(events) != 0 {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+//消费太慢时丢弃新事件, 不阻塞发布者
+func TestHubDropsWhenFull(t *testing.T) {
+	hub := NewHub()
+	s := hub.Subscribe(nil)
+	for i := 0; i < subscriberBufferSize+10; i++ {
+		hub.Publish(Event{Kind: KIND_WORLD_VIEW, RoomId: i})
+	}
+	events := receive(s)
+	if len(events) != subscriberBufferSize || s.Dropped() != 10 {
+		t.Fatalf("expected %d events and 10 dropped, got %d and %d", subscriberBufferSize, len(events), s.Dropped())
+	}
+	//保留的是最早的事件
+	if events[0].RoomId != 0 || events[len(events)-1].RoomId != subscriberBufferSize-1 {
+		t.Errorf("unexpected events kept, from %d to %d", events[0].RoomId, events[len(events)-1].RoomId)
+	}
+	hub.Publish(Event{Kind: KIND_WORLD_VIEW})
+	if len(receive(s)) != 1 || s.Dropped() != 10 {
+		t.Errorf("expected new events to be delivered once drained")
+	}
+}
+
+func TestHubUnsubscribe(t *testing.T) {
+	hub := NewHub()
+	if hub.HasSubscribers() {
+		t.Fatal("expected no subscribers")
+	}
+	first := hub.Subscribe(nil)
+	second := hub.Subscribe(nil)
+	hub.Unsubscribe(first)
+	if !hub.HasSubscribers() {
+		t.Fatal("expected the second subscriber to be kept")
+	}
+	hub.Publish(Event{Kind: KIND_UPSYNC})
+	if len(receive(first)) != 0 || len(receive(second)) != 1 {
+		t.Errorf("expected only the remaining subscriber to receive the event")
+	}
+	hub.Unsubscribe(second)
+	if hub.HasSubscribers() {
+		t.Errorf("expected no subscribers after unsubscribing all")
+	}
+
+	var nilHub *Hub
+	if nilHub.HasSubscribers() {
+		t.Errorf("expected a nil hub to have no subscribers")
+	}
+	nilHub.Publish(Event{Kind: KIND_UPSYNC})
+}
+
+//用-race运行: 发布与订阅, 退订并发进行
+func TestHubConcurrentPublish(t *testing.T) {
+	hub := NewHub()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				hub.Publish(Event{Kind: KIND_UPSYNC, RoomId: j})
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		s := hub.Subscribe(nil)
+		receive(s)
+		hub.Unsubscribe(s)
+	}
+	wg.Wait()
+	if hub.HasSubscribers() {
+		t.Errorf("expected every subscriber to be removed")
+	}
+}
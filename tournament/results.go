@@ -0,0 +1,147 @@
+package tournament
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	INITIAL_RATING   = 1500
+	DEFAULT_K_FACTOR = 32
+)
+
+type Rating struct {
+	Rating  float64 `json:"rating"`
+	Matches int     `json:"matches"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	Draws   int     `json:"draws"`
+}
+
+//一场1v1对局, Strategies按加入房间的顺序
+type MatchRecord struct {
+	Round         int           `json:"round"`
+	Stage         string        `json:"stage"`
+	Seed          int64         `json:"seed"`
+	Strategies    [2]string     `json:"strategies"`
+	Scores        [2]int32      `json:"scores"`
+	Winner        string        `json:"winner"` //平局时为空
+	Duration      time.Duration `json:"duration"`
+	RatingChanges [2]float64    `json:"ratingChanges"`
+	PlayedAt      time.Time     `json:"playedAt"`
+}
+
+//保存在结果文件中, 多次运行锦标赛时累积
+type Results struct {
+	Ratings map[string]*Rating `json:"ratings"`
+	Matches []MatchRecord      `json:"matches"`
+}
+
+//文件不存在时返回空的结果
+func LoadResults(path string) (*Results, error) {
+	results := &Results{Ratings: make(map[string]*Rating)}
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, results); err != nil {
+		return nil, err
+	}
+	if results.Ratings == nil {
+		results.Ratings = make(map[string]*Rating)
+	}
+	return results, nil
+}
+
+//先写临时文件再rename, 中途退出不会留下半个文件
+func (r *Results) Save(path string) error {
+	bytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *Results) rating(name string) *Rating {
+	rating, ok := r.Ratings[name]
+	if !ok {
+		rating = &Rating{Rating: INITIAL_RATING}
+		r.Ratings[name] = rating
+	}
+	return rating
+}
+
+//ratingA对ratingB的期望得分
+func ExpectedScore(ratingA, ratingB float64) float64 {
+	return 1 / (1 + math.Pow(10, (ratingB-ratingA)/400))
+}
+
+//按Elo更新双方的等级分并记录对局, 得分高者胜
+func (r *Results) Record(match MatchRecord, kFactor float64) MatchRecord {
+	a, b := r.rating(match.Strategies[0]), r.rating(match.Strategies[1])
+	actual := 0.5
+	match.Winner = ""
+	switch {
+	case match.Scores[0] > match.Scores[1]:
+		actual = 1
+		match.Winner = match.Strategies[0]
+		a.Wins++
+		b.Losses++
+	case match.Scores[0] < match.Scores[1]:
+		actual = 0
+		match.Winner = match.Strategies[1]
+		a.Losses++
+		b.Wins++
+	default:
+		a.Draws++
+		b.Draws++
+	}
+	change := kFactor * (actual - ExpectedScore(a.Rating, b.Rating))
+	a.Rating += change
+	b.Rating -= change
+	a.Matches++
+	b.Matches++
+	match.RatingChanges = [2]float64{change, -change}
+	r.Matches = append(r.Matches, match)
+	return match
+}
+
+type Standing struct {
+	Name string `json:"name"`
+	Rating
+}
+
+//按等级分从高到低
+func (r *Results) Leaderboard() []Standing {
+	standings := make([]Standing, 0, len(r.Ratings))
+	for name, rating := range r.Ratings {
+		standings = append(standings, Standing{Name: name, Rating: *rating})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Rating.Rating != standings[j].Rating.Rating {
+			return standings[i].Rating.Rating > standings[j].Rating.Rating
+		}
+		return standings[i].Name < standings[j].Name
+	})
+	return standings
+}
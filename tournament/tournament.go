@@ -0,0 +1,92 @@
+//在离线模拟器中让多个strategy两两对局, 以Elo等级分排名
+package tournament
+
+import (
+	"AI/fakeserver"
+	"AI/sim"
+	"errors"
+	"time"
+)
+
+type Config struct {
+	Strategies []string
+	Rounds     int   //每轮中每对strategy交换出生点各打一场
+	Seed       int64 //第i轮(从0开始)使用Seed+i, 同一轮中所有对局的随机宝物和陷阱相同
+	KFactor    float64
+	Sim        sim.Config
+
+	OnMatch func(match MatchRecord) //每场对局记录后调用, 可为nil
+	Now     func() time.Time        //为nil时取time.Now
+}
+
+//每场对局都创建新的strategy实例
+type StrategyFactory func(name string) (sim.Strategy, error)
+
+//按轮次进行循环赛, 结果累积到results中, 出错时已完成的对局仍保留在results中
+func Run(stage *fakeserver.Stage, cfg Config, newStrategy StrategyFactory, results *Results) error {
+	if len(cfg.Strategies) < 2 {
+		return errors.New("A tournament needs at least 2 strategies")
+	}
+	seen := make(map[string]bool)
+	for _, name := range cfg.Strategies {
+		if seen[name] {
+			return errors.New("Duplicated strategy " + name)
+		}
+		seen[name] = true
+	}
+	if cfg.KFactor <= 0 {
+		cfg.KFactor = DEFAULT_K_FACTOR
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	for round := 0; round < cfg.Rounds; round++ {
+		simConfig := cfg.Sim
+		simConfig.Seed = cfg.Seed + int64(round)
+		for i := range cfg.Strategies {
+			for j := i + 1; j < len(cfg.Strategies); j++ {
+				pairs := [][2]string{
+					{cfg.Strategies[i], cfg.Strategies[j]},
+					{cfg.Strategies[j], cfg.Strategies[i]},
+				}
+				for _, pair := range pairs {
+					match, err := play(stage, simConfig, newStrategy, pair)
+					if err != nil {
+						return err
+					}
+					match.Round = round
+					match.PlayedAt = now()
+					match = results.Record(match, cfg.KFactor)
+					if cfg.OnMatch != nil {
+						cfg.OnMatch(match)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func play(stage *fakeserver.Stage, simConfig sim.Config, newStrategy StrategyFactory, pair [2]string) (MatchRecord, error) {
+	var bots []sim.Bot
+	for _, name := range pair {
+		strategy, err := newStrategy(name)
+		if err != nil {
+			return MatchRecord{}, err
+		}
+		bots = append(bots, sim.Bot{Name: name, Strategy: strategy})
+	}
+	result, err := sim.Run(stage, simConfig, bots)
+	if err != nil {
+		return MatchRecord{}, err
+	}
+	return MatchRecord{
+		Stage:      result.StageName,
+		Seed:       result.Seed,
+		Strategies: pair,
+		Scores:     [2]int32{result.Bots[0].Score, result.Bots[1].Score},
+		Duration:   result.Duration,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package tournament
+
+import (
+	"AI/fakeserver"
+	pb "AI/pb_output"
+	"AI/sim"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpectedScoreAndRecord(t *testing.T) {
+	if e := ExpectedScore(1500, 1500); e != 0.5 {
+		t.Errorf("expected 0.5 between equal ratings, got %f", e)
+	}
+	if e := ExpectedScore(1900, 1500) + ExpectedScore(1500, 1900); math.Abs(e-1) > 1e-9 {
+		t.Errorf("expected scores should add up to 1, got %f", e)
+	}
+
+	results := &Results{Ratings: make(map[string]*Rating)}
+	match := results.Record(MatchRecord{Strategies: [2]string{"a", "b"}, Scores: [2]int32{300, 100}}, 32)
+	if match.Winner != "a" || match.RatingChanges != [2]float64{16, -16} {
+		t.Errorf("unexpected record %+v", match)
+	}
+	match = results.Record(MatchRecord{Strategies: [2]string{"b", "a"}, Scores: [2]int32{100, 100}}, 32)
+	if match.Winner != "" || match.RatingChanges[0] <= 0 {
+		t.Errorf("a draw against a stronger opponent should gain rating, got %+v", match)
+	}
+	a, b := results.Ratings["a"], results.Ratings["b"]
+	if a.Matches != 2 || a.Wins != 1 || a.Draws != 1 || b.Losses != 1 || b.Draws != 1 || a.Rating+b.Rating != 2*INITIAL_RATING {
+		t.Errorf("unexpected ratings a %+v b %+v", a, b)
+	}
+	if board := results.Leaderboard(); len(board) != 2 || board[0].Name != "a" {
+		t.Errorf("unexpected leaderboard %+v", board)
+	}
+}
+
+func TestResultsSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tournament")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.json")
+
+	results, err := LoadResults(path)
+	if err != nil || len(results.Ratings) != 0 || len(results.Matches) != 0 {
+		t.Fatalf("expected empty results for a missing file, got %+v %v", results, err)
+	}
+	results.Record(MatchRecord{Strategies: [2]string{"a", "b"}, Scores: [2]int32{1, 0}, PlayedAt: time.Unix(1, 0).UTC()}, 32)
+	if err := results.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadResults(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Ratings["a"].Rating != results.Ratings["a"].Rating || len(loaded.Matches) != 1 || !loaded.Matches[0].PlayedAt.Equal(time.Unix(1, 0)) {
+		t.Errorf("unexpected loaded results %+v", loaded)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected no temporary files to be left, got %d files", len(files))
+	}
+}
+
+func newOpenStage() *fakeserver.Stage {
+	colliderInfo := &pb.BattleColliderInfo{
+		StageName:      "open",
+		StageDiscreteW: 8,
+		StageDiscreteH: 8,
+		StageTileW:     64,
+		StageTileH:     32,
+		StrToPolygon2DListMap: map[string]*pb.Polygon2DList{
+			fakeserver.COLLIDER_INFO_BARRIER_POLYGON_KEY: {Polygon2DList: []*pb.Polygon2D{{
+				Anchor: &pb.Vec2D{X: 100000, Y: 100000},
+				Points: []*pb.Vec2D{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}},
+			}}},
+		},
+	}
+	stage := fakeserver.NewStage(colliderInfo, nil, nil)
+	for i, gid := range []int{9, 36, 63} {
+		x, y := stage.Tmx.GetCoordByGid(gid)
+		id := int32(i + 1)
+		stage.Treasures = append(stage.Treasures, &pb.Treasure{Id: id, LocalIdInBattle: id, Score: 100, X: x, Y: y})
+	}
+	return stage
+}
+
+func newBuiltinStrategy(name string) (sim.Strategy, error) {
+	if strategy, ok := sim.NewBuiltinStrategy(name); ok {
+		return strategy, nil
+	}
+	return nil, errors.New("unknown strategy " + name)
+}
+
+func TestRunRoundRobin(t *testing.T) {
+	cfg := Config{
+		Strategies: []string{sim.STRATEGY_STRAIGHT, sim.STRATEGY_IDLE},
+		Rounds:     2,
+		Seed:       7,
+		Sim:        sim.DefaultConfig(),
+		Now:        func() time.Time { return time.Unix(100, 0) },
+	}
+	cfg.Sim.Duration = 10 * time.Second
+	var played []MatchRecord
+	cfg.OnMatch = func(match MatchRecord) {
+		played = append(played, match)
+	}
+	results := &Results{Ratings: make(map[string]*Rating)}
+	if err := Run(newOpenStage(), cfg, newBuiltinStrategy, results); err != nil {
+		t.Fatal(err)
+	}
+	//每轮交换出生点各打一场
+	if len(played) != 4 || len(results.Matches) != 4 {
+		t.Fatalf("expected 4 matches, got %d", len(played))
+	}
+	for i, match := range played {
+		if match.Round != i/2 || match.Seed != cfg.Seed+int64(i/2) || match.Stage != "open" || !match.PlayedAt.Equal(time.Unix(100, 0)) {
+			t.Errorf("unexpected match %d %+v", i, match)
+		}
+		if match.Winner != sim.STRATEGY_STRAIGHT {
+			t.Errorf("expected straight to beat idle, got %+v", match)
+		}
+	}
+	if played[0].Strategies != [2]string{sim.STRATEGY_STRAIGHT, sim.STRATEGY_IDLE} || played[1].Strategies != [2]string{sim.STRATEGY_IDLE, sim.STRATEGY_STRAIGHT} {
+		t.Errorf("expected swapped starting positions, got %v and %v", played[0].Strategies, played[1].Strategies)
+	}
+	board := results.Leaderboard()
+	if board[0].Name != sim.STRATEGY_STRAIGHT || board[0].Wins != 4 || board[1].Losses != 4 {
+		t.Errorf("unexpected leaderboard %+v", board)
+	}
+
+	//再次运行时在已有的等级分上累积
+	before := board[0].Rating.Rating
+	if err := Run(newOpenStage(), cfg, newBuiltinStrategy, results); err != nil {
+		t.Fatal(err)
+	}
+	if after := results.Ratings[sim.STRATEGY_STRAIGHT]; after.Matches != 8 || after.Rating <= before {
+		t.Errorf("expected ratings to accumulate, got %+v", after)
+	}
+}
+
+func TestRunRejectsInvalidStrategies(t *testing.T) {
+	results := &Results{Ratings: make(map[string]*Rating)}
+	for _, strategies := range [][]string{{"idle"}, {"idle", "idle"}} {
+		if err := Run(newOpenStage(), Config{Strategies: strategies, Rounds: 1, Sim: sim.DefaultConfig()}, newBuiltinStrategy, results); err == nil {
+			t.Errorf("expected %v to be rejected", strategies)
+		}
+	}
+	if err := Run(newOpenStage(), Config{Strategies: []string{"idle", "nope"}, Rounds: 1, Sim: sim.DefaultConfig()}, newBuiltinStrategy, results); err == nil {
+		t.Errorf("expected an unknown strategy to fail the tournament")
+	}
+}